@@ -0,0 +1,214 @@
+package aria
+
+// ARIA block cipher - RFC 5794 (Korean standard KS X 1213).
+//
+// A straightforward pure Go implementation intended for use with aesccm.  It
+// favours clarity over speed and makes no attempt to be constant time beyond what
+// table lookups allow.
+//
+// MIT Licensed.
+
+import (
+	"crypto/cipher"
+	"errors"
+)
+
+const BlockSize = 16
+
+var ErrKeySize = errors.New("ARIA: key must be 16, 24 or 32 bytes")
+
+// Key schedule constants C1, C2, C3
+var ck = [3][16]byte{
+	{0x51, 0x7c, 0xc1, 0xb7, 0x27, 0x22, 0x0a, 0x94, 0xfe, 0x13, 0xab, 0xe8, 0xfa, 0x9a, 0x6e, 0xe0},
+	{0x6d, 0xb1, 0x4a, 0xcc, 0x9e, 0x21, 0xc8, 0x20, 0xff, 0x28, 0xb1, 0xd5, 0xef, 0x5d, 0xe2, 0xb0},
+	{0xdb, 0x92, 0x37, 0x1d, 0x21, 0x26, 0xe9, 0x70, 0x03, 0x24, 0x97, 0x75, 0x04, 0xe8, 0xc9, 0x0e},
+}
+
+// SB2 - SB1 is the AES S-box, SB3 and SB4 are the inverses of SB1 and SB2 and are
+// built in init.
+var sb2 = [256]byte{
+	0xe2, 0x4e, 0x54, 0xfc, 0x94, 0xc2, 0x4a, 0xcc, 0x62, 0x0d, 0x6a, 0x46, 0x3c, 0x4d, 0x8b, 0xd1,
+	0x5e, 0xfa, 0x64, 0xcb, 0xb4, 0x97, 0xbe, 0x2b, 0xbc, 0x77, 0x2e, 0x03, 0xd3, 0x19, 0x59, 0xc1,
+	0x1d, 0x06, 0x41, 0x6b, 0x55, 0xf0, 0x99, 0x69, 0xea, 0x9c, 0x18, 0xae, 0x63, 0xdf, 0xe7, 0xbb,
+	0x00, 0x73, 0x66, 0xfb, 0x96, 0x4c, 0x85, 0xe4, 0x3a, 0x09, 0x45, 0xaa, 0x0f, 0xee, 0x10, 0xeb,
+	0x2d, 0x7f, 0xf4, 0x29, 0xac, 0xcf, 0xad, 0x91, 0x8d, 0x78, 0xc8, 0x95, 0xf9, 0x2f, 0xce, 0xcd,
+	0x08, 0x7a, 0x88, 0x38, 0x5c, 0x83, 0x2a, 0x28, 0x47, 0xdb, 0xb8, 0xc7, 0x93, 0xa4, 0x12, 0x53,
+	0xff, 0x87, 0x0e, 0x31, 0x36, 0x21, 0x58, 0x48, 0x01, 0x8e, 0x37, 0x74, 0x32, 0xca, 0xe9, 0xb1,
+	0xb7, 0xab, 0x0c, 0xd7, 0xc4, 0x56, 0x42, 0x26, 0x07, 0x98, 0x60, 0xd9, 0xb6, 0xb9, 0x11, 0x40,
+	0xec, 0x20, 0x8c, 0xbd, 0xa0, 0xc9, 0x84, 0x04, 0x49, 0x23, 0xf1, 0x4f, 0x50, 0x1f, 0x13, 0xdc,
+	0xd8, 0xc0, 0x9e, 0x57, 0xe3, 0xc3, 0x7b, 0x65, 0x3b, 0x02, 0x8f, 0x3e, 0xe8, 0x25, 0x92, 0xe5,
+	0x15, 0xdd, 0xfd, 0x17, 0xa9, 0xbf, 0xd4, 0x9a, 0x7e, 0xc5, 0x39, 0x67, 0xfe, 0x76, 0x9d, 0x43,
+	0xa7, 0xe1, 0xd0, 0xf5, 0x68, 0xf2, 0x1b, 0x34, 0x70, 0x05, 0xa3, 0x8a, 0xd5, 0x79, 0x86, 0xa8,
+	0x30, 0xc6, 0x51, 0x4b, 0x1e, 0xa6, 0x27, 0xf6, 0x35, 0xd2, 0x6e, 0x24, 0x16, 0x82, 0x5f, 0xda,
+	0xe6, 0x75, 0xa2, 0xef, 0x2c, 0xb2, 0x1c, 0x9f, 0x5d, 0x6f, 0x80, 0x0a, 0x72, 0x44, 0x9b, 0x6c,
+	0x90, 0x0b, 0x5b, 0x33, 0x7d, 0x5a, 0x52, 0xf3, 0x61, 0xa1, 0xf7, 0xb0, 0xd6, 0x3f, 0x7c, 0x6d,
+	0xed, 0x14, 0xe0, 0xa5, 0x3d, 0x22, 0xb3, 0xf8, 0x89, 0xde, 0x71, 0x1a, 0xaf, 0xba, 0xb5, 0x81,
+}
+
+var sb1, sb3, sb4 [256]byte
+
+func init() {
+	// The AES S-box: multiplicative inverse in GF(2^8) followed by the affine map.
+	p, q := byte(1), byte(1)
+	for {
+		p = p ^ p<<1 ^ byte(int8(p)>>7)&0x1b // p *= 3
+		q ^= q << 1                          // q /= 3
+		q ^= q << 2
+		q ^= q << 4
+		q ^= byte(int8(q)>>7) & 0x09
+		x := q ^ (q<<1 | q>>7) ^ (q<<2 | q>>6) ^ (q<<3 | q>>5) ^ (q<<4 | q>>4)
+		sb1[p] = x ^ 0x63
+		if p == 1 {
+			break
+		}
+	}
+	sb1[0] = 0x63
+	for i := 0; i < 256; i++ {
+		sb3[sb1[i]] = byte(i)
+		sb4[sb2[i]] = byte(i)
+	}
+}
+
+type ariaCipher struct {
+	rounds int
+	ek     [17][16]byte // encryption round keys
+	dk     [17][16]byte // decryption round keys
+}
+
+// NewCipher creates and returns a new cipher.Block.  The key must be 16, 24 or 32
+// bytes long.
+func NewCipher(key []byte) (cipher.Block, error) {
+	c := &ariaCipher{}
+	var c1, c2, c3 int
+	switch len(key) {
+	case 16:
+		c.rounds, c1, c2, c3 = 12, 0, 1, 2
+	case 24:
+		c.rounds, c1, c2, c3 = 14, 1, 2, 0
+	case 32:
+		c.rounds, c1, c2, c3 = 16, 2, 0, 1
+	default:
+		return nil, ErrKeySize
+	}
+	var w0, w1, w2, w3, kr [16]byte
+	copy(w0[:], key[:16])
+	copy(kr[:], key[16:])
+	w1 = xor(fo(w0, ck[c1]), kr)
+	w2 = xor(fe(w1, ck[c2]), w0)
+	w3 = xor(fo(w2, ck[c3]), w1)
+
+	rk := [][2]*[16]byte{{&w0, &w1}, {&w1, &w2}, {&w2, &w3}, {&w3, &w0}}
+	for i := 0; i <= c.rounds; i++ {
+		var rot int
+		switch i / 4 {
+		case 0:
+			rot = 128 - 19
+		case 1:
+			rot = 128 - 31
+		case 2:
+			rot = 61
+		case 3:
+			rot = 31
+		default:
+			rot = 19
+		}
+		a, b := rk[i%4][0], rk[i%4][1]
+		c.ek[i] = xor(*a, rotl(*b, rot))
+	}
+
+	c.dk[0] = c.ek[c.rounds]
+	for i := 1; i < c.rounds; i++ {
+		c.dk[i] = diffuse(c.ek[c.rounds-i])
+	}
+	c.dk[c.rounds] = c.ek[0]
+	return c, nil
+}
+
+func (c *ariaCipher) BlockSize() int { return BlockSize }
+
+func xor(a, b [16]byte) (out [16]byte) {
+	for i := range out {
+		out[i] = a[i] ^ b[i]
+	}
+	return
+}
+
+// rotl rotates the 128 bit big endian value x left by n bits.
+func rotl(x [16]byte, n int) (out [16]byte) {
+	q, r := n/8, uint(n%8)
+	for i := range out {
+		hi := x[(i+q)%16]
+		lo := x[(i+q+1)%16]
+		if r == 0 {
+			out[i] = hi
+		} else {
+			out[i] = hi<<r | lo>>(8-r)
+		}
+	}
+	return
+}
+
+// sl1 and sl2 are the two substitution layers.
+func sl1(x [16]byte) (y [16]byte) {
+	for i := 0; i < 16; i += 4 {
+		y[i], y[i+1], y[i+2], y[i+3] = sb1[x[i]], sb2[x[i+1]], sb3[x[i+2]], sb4[x[i+3]]
+	}
+	return
+}
+
+func sl2(x [16]byte) (y [16]byte) {
+	for i := 0; i < 16; i += 4 {
+		y[i], y[i+1], y[i+2], y[i+3] = sb3[x[i]], sb4[x[i+1]], sb1[x[i+2]], sb2[x[i+3]]
+	}
+	return
+}
+
+// diffuse is the diffusion layer A, an involution.
+func diffuse(x [16]byte) (y [16]byte) {
+	y[0] = x[3] ^ x[4] ^ x[6] ^ x[8] ^ x[9] ^ x[13] ^ x[14]
+	y[1] = x[2] ^ x[5] ^ x[7] ^ x[8] ^ x[9] ^ x[12] ^ x[15]
+	y[2] = x[1] ^ x[4] ^ x[6] ^ x[10] ^ x[11] ^ x[12] ^ x[15]
+	y[3] = x[0] ^ x[5] ^ x[7] ^ x[10] ^ x[11] ^ x[13] ^ x[14]
+	y[4] = x[0] ^ x[2] ^ x[5] ^ x[8] ^ x[11] ^ x[14] ^ x[15]
+	y[5] = x[1] ^ x[3] ^ x[4] ^ x[9] ^ x[10] ^ x[14] ^ x[15]
+	y[6] = x[0] ^ x[2] ^ x[7] ^ x[9] ^ x[10] ^ x[12] ^ x[13]
+	y[7] = x[1] ^ x[3] ^ x[6] ^ x[8] ^ x[11] ^ x[12] ^ x[13]
+	y[8] = x[0] ^ x[1] ^ x[4] ^ x[7] ^ x[10] ^ x[13] ^ x[15]
+	y[9] = x[0] ^ x[1] ^ x[5] ^ x[6] ^ x[11] ^ x[12] ^ x[14]
+	y[10] = x[2] ^ x[3] ^ x[5] ^ x[6] ^ x[8] ^ x[13] ^ x[15]
+	y[11] = x[2] ^ x[3] ^ x[4] ^ x[7] ^ x[9] ^ x[12] ^ x[14]
+	y[12] = x[1] ^ x[2] ^ x[6] ^ x[7] ^ x[9] ^ x[11] ^ x[12]
+	y[13] = x[0] ^ x[3] ^ x[6] ^ x[7] ^ x[8] ^ x[10] ^ x[13]
+	y[14] = x[0] ^ x[3] ^ x[4] ^ x[5] ^ x[9] ^ x[11] ^ x[14]
+	y[15] = x[1] ^ x[2] ^ x[4] ^ x[5] ^ x[8] ^ x[10] ^ x[15]
+	return
+}
+
+// fo and fe are the odd and even round functions.
+func fo(d, rk [16]byte) [16]byte { return diffuse(sl1(xor(d, rk))) }
+func fe(d, rk [16]byte) [16]byte { return diffuse(sl2(xor(d, rk))) }
+
+func (c *ariaCipher) crypt(dst, src []byte, rk *[17][16]byte) {
+	if len(src) < BlockSize || len(dst) < BlockSize {
+		panic("aria: input not full block")
+	}
+	var p [16]byte
+	copy(p[:], src)
+	for i := 0; i < c.rounds-1; i++ {
+		if i%2 == 0 {
+			p = fo(p, rk[i])
+		} else {
+			p = fe(p, rk[i])
+		}
+	}
+	p = xor(sl2(xor(p, rk[c.rounds-1])), rk[c.rounds])
+	copy(dst, p[:])
+}
+
+// Encrypt encrypts the first block in src into dst.
+func (c *ariaCipher) Encrypt(dst, src []byte) { c.crypt(dst, src, &c.ek) }
+
+// Decrypt decrypts the first block in src into dst.
+func (c *ariaCipher) Decrypt(dst, src []byte) { c.crypt(dst, src, &c.dk) }
+
+/* vim: set noai ts=4 sw=4: */
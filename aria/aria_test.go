@@ -0,0 +1,43 @@
+package aria
+
+import (
+	"encoding/hex"
+	"testing"
+)
+
+// Test vectors from RFC 5794 Appendix A.
+func TestARIA(t *testing.T) {
+	var testData = []struct {
+		key        string
+		plaintext  string
+		ciphertext string
+	}{
+		{key: "000102030405060708090a0b0c0d0e0f", plaintext: "00112233445566778899aabbccddeeff", ciphertext: "d718fbd6ab644c739da95f3be6451778"},
+		{key: "000102030405060708090a0b0c0d0e0f1011121314151617", plaintext: "00112233445566778899aabbccddeeff", ciphertext: "26449c1805dbe7aa25a468ce263a9e79"},
+		{key: "000102030405060708090a0b0c0d0e0f101112131415161718191a1b1c1d1e1f", plaintext: "00112233445566778899aabbccddeeff", ciphertext: "f92bd7c79fb72e2f2b8f80c1972d24fc"},
+	}
+
+	for ii, vv := range testData {
+		key, _ := hex.DecodeString(vv.key)
+		pt, _ := hex.DecodeString(vv.plaintext)
+		c, err := NewCipher(key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		out := make([]byte, BlockSize)
+		c.Encrypt(out, pt)
+		if got := hex.EncodeToString(out); got != vv.ciphertext {
+			t.Errorf("Test %d: Encrypt got %s, expected %s", ii, got, vv.ciphertext)
+		}
+		c.Decrypt(out, out)
+		if got := hex.EncodeToString(out); got != vv.plaintext {
+			t.Errorf("Test %d: Decrypt got %s, expected %s", ii, got, vv.plaintext)
+		}
+	}
+
+	if _, err := NewCipher(make([]byte, 15)); err != ErrKeySize {
+		t.Errorf("NewCipher with a 15 byte key: expected ErrKeySize, got %v", err)
+	}
+}
+
+/* vim: set noai ts=4 sw=4: */
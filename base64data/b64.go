@@ -22,7 +22,7 @@ func (b *Base64Data) UnmarshalText(text []byte) error {
 	if n := base64.StdEncoding.DecodedLen(len(text)); cap(*b) < n {
 		*b = make([]byte, n)
 	}
-	n, err := base64.StdEncoding.Decode(*b, text)
+	n, err := base64.StdEncoding.Decode((*b)[:cap(*b)], text)
 	*b = (*b)[:n]
 	return err
 }
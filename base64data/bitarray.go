@@ -0,0 +1,124 @@
+package base64data
+
+// SJCL's codecs: bitArray, hex and UTF-8 string.
+//
+// SJCL holds binary data as a bitArray, an array of numbers each carrying 32
+// bits.  Full words are what JavaScript's bitwise operators give, signed 32 bit
+// values.  A last word with fewer bits is sjcl.bitArray.partial(len, x): the bits
+// moved to the top of a signed 32 bit value, plus len * 0x10000000000 to record
+// how many there are.  So the bytes 01 02 03 04 05 are [16909060, 8796176908288],
+// and getPartial recovers the 8 as Math.round(x / 0x10000000000).
+//
+// The functions here give exactly what sjcl.codec.bytes, sjcl.codec.hex and
+// sjcl.codec.utf8String give, so bitArrays can be passed to and from JavaScript
+// as JSON arrays of numbers, and debug output compared line for line.
+//
+// MIT Licensed
+
+import (
+	"encoding/hex"
+	"fmt"
+	"math"
+	"strings"
+	"unicode/utf8"
+)
+
+const partialUnit = 0x10000000000 // sjcl.bitArray.partial's length multiplier
+
+// ToBitArray returns b as sjcl.codec.bytes.toBits makes it.
+func (b Base64Data) ToBitArray() []int64 {
+	a := make([]int64, 0, (len(b)+3)/4)
+	var tmp int32
+	for i, c := range b {
+		tmp = tmp<<8 | int32(c)
+		if i&3 == 3 {
+			a = append(a, int64(tmp))
+			tmp = 0
+		}
+	}
+	if n := len(b) & 3; n != 0 {
+		a = append(a, int64(tmp<<(32-8*n))+int64(8*n)*partialUnit)
+	}
+	return a
+}
+
+// FromBitArray returns the bytes of a bitArray, as sjcl.codec.bytes.fromBits
+// does.  A bitArray whose length is not whole bytes has its last byte filled
+// out with zero bits.  Words that SJCL could not have made are an error.
+func FromBitArray(a []int64) (Base64Data, error) {
+	if len(a) == 0 {
+		return Base64Data{}, nil
+	}
+	for i, x := range a[:len(a)-1] {
+		if x < math.MinInt32 || x > math.MaxUint32 {
+			return nil, fmt.Errorf("%w: word %d is %d", ErrBitArray, i, x)
+		}
+	}
+	last := a[len(a)-1]
+	partial := bitLength(last)
+	if partial < 1 || partial > 32 || (partial == 32 && (last < math.MinInt32 || last > math.MaxUint32)) {
+		return nil, fmt.Errorf("%w: last word is %d", ErrBitArray, last)
+	}
+	n := (32*(len(a)-1) + partial + 7) / 8
+	b := make(Base64Data, n)
+	for i := range b {
+		b[i] = byte(uint32(a[i/4]) >> (24 - 8*(i&3)))
+	}
+	return b, nil
+}
+
+// bitLength is sjcl.bitArray.getPartial: the number of bits in the last word.
+func bitLength(x int64) int {
+	n := int(math.Round(float64(x) / partialUnit))
+	if n == 0 {
+		return 32
+	}
+	return n
+}
+
+// BitArrayString prints the bitArray of b the way the JavaScript console does.
+func (b Base64Data) BitArrayString() string {
+	a := b.ToBitArray()
+	s := make([]string, len(a))
+	for i, x := range a {
+		s[i] = fmt.Sprint(x)
+	}
+	return "[" + strings.Join(s, ", ") + "]"
+}
+
+// Hex returns b in lower case hex, as sjcl.codec.hex.fromBits does.
+func (b Base64Data) Hex() string {
+	return hex.EncodeToString(b)
+}
+
+// FromHex decodes hex as sjcl.codec.hex.toBits does: white space and "0x" are
+// dropped, and an odd number of digits leaves the low half of the last byte
+// zero.
+func FromHex(s string) (Base64Data, error) {
+	s = strings.ReplaceAll(strings.Join(strings.Fields(s), ""), "0x", "")
+	if len(s)%2 == 1 {
+		s += "0"
+	}
+	return hex.DecodeString(s)
+}
+
+// UTF8String returns b as a string, as sjcl.codec.utf8String.fromBits does.  SJCL
+// throws on bytes that are not UTF-8, so they are an error here.
+func (b Base64Data) UTF8String() (string, error) {
+	if !utf8.Valid(b) {
+		return "", ErrUTF8
+	}
+	return string(b), nil
+}
+
+// FromUTF8String returns the UTF-8 bytes of s, as sjcl.codec.utf8String.toBits
+// does.  A Go string may hold bytes that are not UTF-8, where JavaScript would
+// have thrown on the lone surrogate; those are an error.
+func FromUTF8String(s string) (Base64Data, error) {
+	if !utf8.ValidString(s) {
+		return nil, ErrUTF8
+	}
+	return Base64Data(s), nil
+}
+
+/* vim: set noai ts=4 sw=4: */
@@ -0,0 +1,94 @@
+package base64data
+
+import (
+	"encoding/hex"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+// Expected values from sjcl.codec.bytes.toBits and sjcl.codec.hex in node.
+func TestBitArray(t *testing.T) {
+	var testData = []struct {
+		hex  string
+		bits []int64
+	}{
+		{hex: "", bits: []int64{}},
+		{hex: "01", bits: []int64{8796109799424}},
+		{hex: "0102", bits: []int64{17592202952704}},
+		{hex: "010203", bits: []int64{26388295975680}},
+		{hex: "01020304", bits: []int64{16909060}},
+		{hex: "0102030405", bits: []int64{16909060, 8796176908288}},
+		{hex: "ff", bits: []int64{8796076244992}},
+		{hex: "fffe", bits: []int64{17592185913344}},
+		{hex: "fffefd", bits: []int64{26388279000320}},
+		{hex: "fffefdfc", bits: []int64{-66052}},
+		{hex: "fffefdfcfb", bits: []int64{-66052, 8796009136128}},
+		{hex: "80000000ff80", bits: []int64{-2147483648, 17592177655808}},
+		{hex: "deadbeefcafe01", bits: []int64{-559038737, 26387389743360}},
+	}
+
+	for ii, vv := range testData {
+		b, _ := hex.DecodeString(vv.hex)
+		if got := Base64Data(b).ToBitArray(); !reflect.DeepEqual(got, vv.bits) {
+			t.Errorf("Test %d: ToBitArray got %v, expected %v", ii, got, vv.bits)
+		}
+		back, err := FromBitArray(vv.bits)
+		if err != nil || back.Hex() != vv.hex {
+			t.Errorf("Test %d: FromBitArray got %s %v", ii, back.Hex(), err)
+		}
+		fromHex, err := FromHex(vv.hex)
+		if err != nil || fromHex.Hex() != vv.hex {
+			t.Errorf("Test %d: FromHex got %s %v", ii, fromHex.Hex(), err)
+		}
+	}
+
+	if got := (Base64Data{1, 2, 3, 4, 0xff}).BitArrayString(); got != "[16909060, 8796076244992]" {
+		t.Errorf("BitArrayString got %s", got)
+	}
+
+	// sjcl.codec.hex.toBits("abc") is 12 bits, filled out to two bytes.
+	if b, err := FromBitArray([]int64{13192726052864}); err != nil || b.Hex() != "abc0" {
+		t.Errorf("12 bit array got %s %v", b.Hex(), err)
+	}
+	for _, bad := range [][]int64{{1 << 32, 0}, {-1<<31 - 1, 0}, {33 * partialUnit}, {1 << 32}} {
+		if _, err := FromBitArray(bad); !errors.Is(err, ErrBitArray) {
+			t.Errorf("FromBitArray(%v) got %v", bad, err)
+		}
+	}
+}
+
+func TestHexAndUTF8(t *testing.T) {
+	var testData = []struct {
+		hex    string
+		expect string
+	}{
+		{hex: "abc", expect: "abc0"},
+		{hex: "0xab cd\n0xef", expect: "abcdef"},
+		{hex: "F", expect: "f0"},
+	}
+	for ii, vv := range testData {
+		if b, err := FromHex(vv.hex); err != nil || b.Hex() != vv.expect {
+			t.Errorf("Test %d: FromHex(%q) got %s %v", ii, vv.hex, b.Hex(), err)
+		}
+	}
+	if _, err := FromHex("xyz"); err == nil {
+		t.Errorf("FromHex should reject non-hex")
+	}
+
+	b, err := FromUTF8String("héllo ☃")
+	if err != nil || b.Hex() != "68c3a96c6c6f20e29883" {
+		t.Errorf("FromUTF8String got %s %v", b.Hex(), err)
+	}
+	if s, err := b.UTF8String(); err != nil || s != "héllo ☃" {
+		t.Errorf("UTF8String got %q %v", s, err)
+	}
+	if _, err := FromUTF8String("\xff"); err != ErrUTF8 {
+		t.Errorf("FromUTF8String of bad UTF-8 got %v", err)
+	}
+	if _, err := (Base64Data{0xc3}).UTF8String(); err != ErrUTF8 {
+		t.Errorf("UTF8String of bad UTF-8 got %v", err)
+	}
+}
+
+/* vim: set noai ts=4 sw=4: */
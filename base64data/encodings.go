@@ -0,0 +1,176 @@
+package base64data
+
+// The other Base64 encodings, and the lenient decoder the types here use.
+//
+// Each type writes its own encoding: Base64Data the standard alphabet with
+// padding, as SJCL does, Base64URLData the URL-safe alphabet ("-" and "_" for
+// "+" and "/"), and the Raw types the same without "=" padding.  Reading, the
+// types in this file take any of the four; Base64Data stays strict, as it
+// always was, so existing callers see no change.  SJCL output travels through query strings and
+// clients that strip the padding or swap the alphabet, and sjcl.codec.base64
+// itself ignores white space and padding, so insisting on one form only turns
+// away data that decodes to the same bytes.
+//
+// MIT Licensed
+
+import (
+	"encoding/base64"
+	"io"
+)
+
+// Base64URLData is Base64Data written with the URL-safe alphabet.
+type Base64URLData []byte
+
+// RawBase64Data is Base64Data written without padding.
+type RawBase64Data []byte
+
+// RawBase64URLData is Base64Data written with the URL-safe alphabet and without padding.
+type RawBase64URLData []byte
+
+func (b Base64URLData) MarshalText() ([]byte, error) {
+	return encode(base64.URLEncoding, b), nil
+}
+
+func (b *Base64URLData) UnmarshalText(text []byte) (err error) {
+	*b, err = AppendDecodeLenient((*b)[:0], text)
+	return err
+}
+
+func (b RawBase64Data) MarshalText() ([]byte, error) {
+	return encode(base64.RawStdEncoding, b), nil
+}
+
+func (b *RawBase64Data) UnmarshalText(text []byte) (err error) {
+	*b, err = AppendDecodeLenient((*b)[:0], text)
+	return err
+}
+
+func (b RawBase64URLData) MarshalText() ([]byte, error) {
+	return encode(base64.RawURLEncoding, b), nil
+}
+
+func (b *RawBase64URLData) UnmarshalText(text []byte) (err error) {
+	*b, err = AppendDecodeLenient((*b)[:0], text)
+	return err
+}
+
+func encode(enc *base64.Encoding, b []byte) []byte {
+	text := make([]byte, enc.EncodedLen(len(b)))
+	enc.Encode(text, b)
+	return text
+}
+
+// DecodeLenient decodes Base64 in the standard or the URL-safe alphabet, with
+// or without padding.  White space is dropped, and a space is read as "+", what
+// a "+" becomes when a query string is decoded as a form.  An error is returned
+// if both alphabets are used, or anything but padding follows the padding.
+func DecodeLenient(text []byte) ([]byte, error) {
+	return AppendDecodeLenient(nil, text)
+}
+
+// AppendDecodeLenient is DecodeLenient appending the bytes to dst.
+func AppendDecodeLenient(dst, text []byte) ([]byte, error) {
+	var l lenient
+	clean := make([]byte, 0, len(text))
+	for _, c := range text {
+		c, keep, err := l.clean(c)
+		if err != nil {
+			return dst, err
+		}
+		if keep {
+			clean = append(clean, c)
+		}
+	}
+	n := len(dst)
+	if need := n + base64.RawStdEncoding.DecodedLen(len(clean)); cap(dst) < need {
+		dst = append(make([]byte, 0, need), dst...)
+	}
+	m, err := base64.RawStdEncoding.Decode(dst[n:cap(dst)], clean)
+	return dst[:n+m], err
+}
+
+// NewDecoder returns a reader that decodes the Base64 read from r as
+// DecodeLenient does, for data too large to hold in memory.
+func NewDecoder(r io.Reader) io.Reader {
+	l := &lenientReader{r: r}
+	return &decoder{l, base64.NewDecoder(base64.RawStdEncoding, l)}
+}
+
+// decoder reports lenientReader's errors, and those of the reader under it,
+// ahead of the base64.CorruptInputError the decoder makes of the bytes before
+// them.
+type decoder struct {
+	l *lenientReader
+	d io.Reader
+}
+
+func (d *decoder) Read(p []byte) (int, error) {
+	n, err := d.d.Read(p)
+	if d.l.err != nil {
+		return n, d.l.err
+	}
+	return n, err
+}
+
+// lenient is what the lenient decoders have seen so far.
+type lenient struct {
+	std, url, padded bool
+}
+
+// clean maps c to the standard alphabet without padding; keep is false for the
+// white space and padding that are dropped.
+func (l *lenient) clean(c byte) (_ byte, keep bool, err error) {
+	switch {
+	case c == '\r' || c == '\n' || c == '\t':
+		return c, false, nil
+	case c == '=':
+		l.padded = true
+		return c, false, nil
+	case l.padded:
+		return c, false, ErrPadding
+	case c == ' ' || c == '+':
+		c, l.std = '+', true
+	case c == '/':
+		l.std = true
+	case c == '-':
+		c, l.url = '+', true
+	case c == '_':
+		c, l.url = '/', true
+	}
+	if l.std && l.url {
+		return c, false, ErrMixedAlphabet
+	}
+	return c, true, nil
+}
+
+type lenientReader struct {
+	r   io.Reader
+	err error
+	lenient
+}
+
+func (l *lenientReader) Read(p []byte) (int, error) {
+	for {
+		n, err := l.r.Read(p)
+		j := 0
+		for _, c := range p[:n] {
+			c, keep, err := l.clean(c)
+			if err != nil {
+				l.err = err
+				return j, err
+			}
+			if keep {
+				p[j] = c
+				j++
+			}
+		}
+		if err != nil && err != io.EOF {
+			l.err = err
+		}
+		if j > 0 || err != nil {
+			return j, err
+		}
+	}
+}
+
+/* vim: set noai ts=4 sw=4: */
@@ -0,0 +1,141 @@
+package base64data
+
+import (
+	"bytes"
+	"encoding"
+	"encoding/json"
+	"io"
+	"strings"
+	"testing"
+	"testing/iotest"
+)
+
+// Every type writes its own encoding and, all but Base64Data, reads back what
+// any of them wrote.  Base64Data reads only its own.
+func TestEncodingsRoundTrip(t *testing.T) {
+	data := []byte{0xfb, 0xff, 0xbf, 0x00, 0x3e, 0x3f, 0xfe}
+	var testData = []struct {
+		value  encoding.TextMarshaler
+		expect string
+	}{
+		{value: Base64Data(data), expect: "+/+/AD4//g=="},
+		{value: Base64URLData(data), expect: "-_-_AD4__g=="},
+		{value: RawBase64Data(data), expect: "+/+/AD4//g"},
+		{value: RawBase64URLData(data), expect: "-_-_AD4__g"},
+	}
+	readers := func() []interface{} {
+		return []interface{}{new(Base64URLData), new(RawBase64Data), new(RawBase64URLData)}
+	}
+
+	for ii, vv := range testData {
+		text, err := vv.value.MarshalText()
+		if err != nil || string(text) != vv.expect {
+			t.Errorf("Test %d: MarshalText got %s %v, expected %s", ii, text, err, vv.expect)
+		}
+		for jj, r := range readers() {
+			if err := r.(encoding.TextUnmarshaler).UnmarshalText(text); err != nil {
+				t.Errorf("Test %d: reader %d: %s", ii, jj, err)
+			}
+			if got := bytesOf(r); !bytes.Equal(got, data) {
+				t.Errorf("Test %d: reader %d got %x", ii, jj, got)
+			}
+		}
+		var b Base64Data
+		if err := b.UnmarshalText(text); (err == nil) != (ii == 0) {
+			t.Errorf("Test %d: Base64Data got error %v", ii, err)
+		} else if err == nil && !bytes.Equal(b, data) {
+			t.Errorf("Test %d: Base64Data got %x", ii, []byte(b))
+		}
+	}
+
+	// Every length, through JSON.
+	for n := 0; n < 20; n++ {
+		b := bytes.Repeat([]byte{0xfa}, n)
+		type fields struct {
+			Std    Base64Data
+			URL    Base64URLData
+			Raw    RawBase64Data
+			RawURL RawBase64URLData
+		}
+		buf, err := json.Marshal(fields{b, b, b, b})
+		if err != nil {
+			t.Fatal(err)
+		}
+		var back fields
+		if err := json.Unmarshal(buf, &back); err != nil {
+			t.Fatalf("length %d: %s %s", n, buf, err)
+		}
+		if !bytes.Equal(back.Std, b) || !bytes.Equal(back.URL, b) || !bytes.Equal(back.Raw, b) || !bytes.Equal(back.RawURL, b) {
+			t.Errorf("length %d: %s read back as %+v", n, buf, back)
+		}
+	}
+}
+
+func bytesOf(r interface{}) []byte {
+	switch v := r.(type) {
+	case *Base64Data:
+		return *v
+	case *Base64URLData:
+		return *v
+	case *RawBase64Data:
+		return *v
+	case *RawBase64URLData:
+		return *v
+	}
+	return nil
+}
+
+func TestDecodeLenient(t *testing.T) {
+	var testData = []struct {
+		text    string
+		expect  string
+		err     error
+		corrupt bool // any base64.CorruptInputError
+	}{
+		{text: "aGVsbG8=", expect: "hello"},
+		{text: "aGVsbG8", expect: "hello"},
+		{text: "aGVs\r\nbG8=\n", expect: "hello"},
+		{text: "+/+/", expect: "\xfb\xff\xbf"},
+		{text: " / /", expect: "\xfb\xff\xbf"}, // "+" read back from a query string
+		{text: "-_-_", expect: "\xfb\xff\xbf"},
+		{text: "", expect: ""},
+		{text: "+_", err: ErrMixedAlphabet},
+		{text: "aGVsbG8=aGVs", err: ErrPadding},
+		{text: "aGVsb", corrupt: true},
+		{text: "aGV*bG8=", corrupt: true},
+	}
+
+	for ii, vv := range testData {
+		got, err := DecodeLenient([]byte(vv.text))
+		switch {
+		case vv.corrupt && err == nil, !vv.corrupt && err != vv.err:
+			t.Errorf("Test %d: %q got error %v, expected %v", ii, vv.text, err, vv.err)
+		case err == nil && string(got) != vv.expect:
+			t.Errorf("Test %d: %q got %q, expected %q", ii, vv.text, got, vv.expect)
+		}
+
+		// The same through NewDecoder, a byte at a time.
+		got, err = io.ReadAll(NewDecoder(iotest.OneByteReader(strings.NewReader(vv.text))))
+		switch {
+		case vv.corrupt && err == nil, !vv.corrupt && err != vv.err:
+			t.Errorf("Test %d: NewDecoder %q got error %v, expected %v", ii, vv.text, err, vv.err)
+		case err == nil && string(got) != vv.expect:
+			t.Errorf("Test %d: NewDecoder %q got %q, expected %q", ii, vv.text, got, vv.expect)
+		}
+	}
+
+	// An error from the reader comes out as it is, not as the bad Base64 of
+	// what was cut short.
+	if _, err := io.ReadAll(NewDecoder(io.MultiReader(strings.NewReader("aGVsb"), iotest.ErrReader(iotest.ErrTimeout)))); err != iotest.ErrTimeout {
+		t.Errorf("NewDecoder of a failing reader got error %v", err)
+	}
+
+	// The capacity already there is reused.
+	b := make(Base64Data, 0, 16)
+	p := &b[:1][0]
+	if err := b.UnmarshalText([]byte("aGVsbG8=")); err != nil || string(b) != "hello" || &b[0] != p {
+		t.Errorf("UnmarshalText did not reuse the buffer: %q %v", b, err)
+	}
+}
+
+/* vim: set noai ts=4 sw=4: */
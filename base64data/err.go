@@ -0,0 +1,10 @@
+package base64data
+
+import "errors"
+
+var ErrMixedAlphabet = errors.New("BASE64DATA: both the standard and the URL-safe alphabet used")
+var ErrPadding = errors.New("BASE64DATA: data after the padding")
+var ErrBitArray = errors.New("BASE64DATA: not an SJCL bitArray")
+var ErrUTF8 = errors.New("BASE64DATA: not valid UTF-8")
+
+/* vim: set noai ts=4 sw=4: */
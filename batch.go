@@ -0,0 +1,105 @@
+// Sealing and opening many messages in one call.
+//
+// For short messages the fixed cost of a call - checking lengths, building B_0
+// and A_0, allocating the output - is a large part of the work.  SealBatch and
+// OpenBatch run a slice of messages under one key, carve every output that needs
+// new memory out of a single allocation and can spread the items over several
+// goroutines.  Each item reports its own error.
+//
+// MIT Licensed
+//
+
+package aesccm
+
+import (
+	"sync"
+)
+
+// BatchItem is one message of a batch.
+type BatchItem struct {
+	Nonce []byte // truncated to NonceSize like Seal and Open do
+	In    []byte // plaintext for SealBatch, ciphertext || tag for OpenBatch
+	Adata []byte //
+	Out   []byte // result, written over Out[:0] - keep it to reuse the memory next batch
+	Err   error  // nil if this item succeeded
+}
+
+// SealBatch seals every item.  Out may be In[:0] if In has room for the tag.
+// With workers > 1 the items are split between that many goroutines.  It
+// returns ErrBatchFailed if any item has an error.
+func (ccmt *CCMType) SealBatch(items []BatchItem, workers int) error {
+	return ccmt.batch(items, workers, false)
+}
+
+// OpenBatch opens every item.  Out may be In[:0].  On failure an item's Err is
+// set and its Out is empty.  It returns ErrBatchFailed if any item has an error.
+func (ccmt *CCMType) OpenBatch(items []BatchItem, workers int) error {
+	return ccmt.batch(items, workers, true)
+}
+
+func (ccmt *CCMType) batch(items []BatchItem, workers int, open bool) error {
+	outLen := func(it *BatchItem) int {
+		if !open {
+			return len(it.In) + int(ccmt.M)
+		}
+		return max(len(it.In)-int(ccmt.M), 0)
+	}
+
+	// One allocation for every output that does not fit in the item's Out.
+	need := 0
+	for i := range items {
+		if n := outLen(&items[i]); cap(items[i].Out) < n {
+			need += n
+		}
+	}
+	buf := make([]byte, need)
+	for i := range items {
+		if n := outLen(&items[i]); cap(items[i].Out) < n {
+			items[i].Out, buf = buf[:0:n], buf[n:]
+		}
+	}
+
+	run := func(items []BatchItem) {
+		st := new(ccmState)
+		for i := range items {
+			it := &items[i]
+			var out []byte
+			if open {
+				out, it.Err = ccmt.openState(st, it.Out[:0], it.Nonce, it.In, it.Adata)
+			} else {
+				out, it.Err = ccmt.sealState(st, it.Out[:0], it.Nonce, it.In, it.Adata)
+			}
+			if it.Err != nil {
+				out = it.Out[:0]
+			}
+			it.Out = out
+		}
+	}
+
+	if workers > len(items) {
+		workers = len(items)
+	}
+	if workers <= 1 {
+		run(items)
+	} else {
+		var wg sync.WaitGroup
+		per := (len(items) + workers - 1) / workers
+		for lo := 0; lo < len(items); lo += per {
+			wg.Add(1)
+			go func(part []BatchItem) {
+				defer wg.Done()
+				run(part)
+			}(items[lo:min(lo+per, len(items))])
+		}
+		wg.Wait()
+	}
+
+	for i := range items {
+		if items[i].Err != nil {
+			return ErrBatchFailed
+		}
+	}
+	return nil
+}
+
+/* vim: set noai ts=4 sw=4: */
@@ -0,0 +1,135 @@
+package aesccm
+
+import (
+	"bytes"
+	"crypto/aes"
+	"encoding/binary"
+	"runtime"
+	"testing"
+)
+
+func newBatch(n, size int) []BatchItem {
+	items := make([]BatchItem, n)
+	for i := range items {
+		items[i].Nonce = binary.BigEndian.AppendUint64(make([]byte, 5), uint64(i))
+		items[i].In = bytes.Repeat([]byte{byte(i)}, size)
+		items[i].Adata = []byte("telemetry")
+	}
+	return items
+}
+
+func TestBatch(t *testing.T) {
+	blk, _ := aes.NewCipher(make([]byte, 16))
+	ccm, _ := newCCMType(blk, 8, 13)
+
+	for _, workers := range []int{0, 1, 3, 100} {
+		items := newBatch(50, 40)
+		items[7].Nonce = items[7].Nonce[:5] // too short
+		if err := ccm.SealBatch(items, workers); err != ErrBatchFailed {
+			t.Errorf("Workers %d: SealBatch expected ErrBatchFailed, got %v", workers, err)
+		}
+		for ii, vv := range items {
+			if ii == 7 {
+				if vv.Err != ErrNonceSize || len(vv.Out) != 0 {
+					t.Errorf("Workers %d: item 7 got %x %v", workers, vv.Out, vv.Err)
+				}
+				continue
+			}
+			if expect := ccm.Seal(nil, vv.Nonce, vv.In, vv.Adata); vv.Err != nil || !bytes.Equal(vv.Out, expect) {
+				t.Errorf("Workers %d: item %d got %x %v, expected %x", workers, ii, vv.Out, vv.Err, expect)
+			}
+		}
+
+		opens := make([]BatchItem, len(items))
+		for i := range items {
+			opens[i] = BatchItem{Nonce: items[i].Nonce, In: items[i].Out, Adata: items[i].Adata}
+		}
+		opens[7].In = nil
+		opens[9].In = append([]byte(nil), opens[9].In...)
+		opens[9].In[0] ^= 1
+		if err := ccm.OpenBatch(opens, workers); err != ErrBatchFailed {
+			t.Errorf("Workers %d: OpenBatch expected ErrBatchFailed, got %v", workers, err)
+		}
+		for ii, vv := range opens {
+			switch ii {
+			case 7:
+				if vv.Err != ErrCiphertextTooShort {
+					t.Errorf("Workers %d: item 7 got %v", workers, vv.Err)
+				}
+			case 9:
+				if vv.Err != ErrOpenError || len(vv.Out) != 0 {
+					t.Errorf("Workers %d: item 9 got %x %v", workers, vv.Out, vv.Err)
+				}
+			default:
+				if vv.Err != nil || !bytes.Equal(vv.Out, items[ii].In) {
+					t.Errorf("Workers %d: item %d got %x %v", workers, ii, vv.Out, vv.Err)
+				}
+			}
+		}
+	}
+}
+
+// A second batch with the same items reuses the outputs of the first.
+func TestBatchReuse(t *testing.T) {
+	blk, _ := aes.NewCipher(make([]byte, 16))
+	ccm, _ := newCCMType(blk, 8, 13)
+	items := newBatch(100, 40)
+	if err := ccm.SealBatch(items, 1); err != nil {
+		t.Fatal(err)
+	}
+	first := &items[0].Out[0]
+	if allocs := testing.AllocsPerRun(10, func() { ccm.SealBatch(items, 1) }); allocs > 2 {
+		t.Errorf("SealBatch allocated %v times with reusable outputs", allocs)
+	}
+	if &items[0].Out[0] != first {
+		t.Errorf("SealBatch did not reuse Out")
+	}
+
+	// In place: Out is In[:0] with room for the tag.
+	pt := append(make([]byte, 0, 48), items[1].In...)
+	expect := ccm.Seal(nil, items[1].Nonce, pt, items[1].Adata)
+	one := []BatchItem{{Nonce: items[1].Nonce, In: pt, Adata: items[1].Adata, Out: pt[:0]}}
+	if err := ccm.SealBatch(one, 1); err != nil || !bytes.Equal(one[0].Out, expect) || &one[0].Out[0] != &pt[:1][0] {
+		t.Errorf("In place SealBatch: got %x %v", one[0].Out, err)
+	}
+}
+
+func benchmarkBatch(b *testing.B, workers int, open bool) {
+	blk, _ := aes.NewCipher(make([]byte, 16))
+	ccm, _ := newCCMType(blk, 8, 13)
+	items := newBatch(1024, 40)
+	if open {
+		ccm.SealBatch(items, 1)
+		for i := range items {
+			items[i].In, items[i].Out = items[i].Out, nil
+		}
+	}
+	b.SetBytes(int64(len(items) * 40))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		switch {
+		case workers < 0 && open:
+			for j := range items {
+				items[j].Out, _ = ccm.Open(items[j].Out[:0], items[j].Nonce, items[j].In, items[j].Adata)
+			}
+		case workers < 0:
+			for j := range items {
+				items[j].Out = ccm.Seal(items[j].Out[:0], items[j].Nonce, items[j].In, items[j].Adata)
+			}
+		case open:
+			ccm.OpenBatch(items, workers)
+		default:
+			ccm.SealBatch(items, workers)
+		}
+	}
+}
+
+// 1024 messages of 40 bytes per op, one at a time and as a batch.
+func BenchmarkSeal40(b *testing.B)         { benchmarkBatch(b, -1, false) }
+func BenchmarkSealBatch40(b *testing.B)    { benchmarkBatch(b, 1, false) }
+func BenchmarkSealBatch40Par(b *testing.B) { benchmarkBatch(b, runtime.GOMAXPROCS(0), false) }
+func BenchmarkOpen40(b *testing.B)         { benchmarkBatch(b, -1, true) }
+func BenchmarkOpenBatch40(b *testing.B)    { benchmarkBatch(b, 1, true) }
+func BenchmarkOpenBatch40Par(b *testing.B) { benchmarkBatch(b, runtime.GOMAXPROCS(0), true) }
+
+/* vim: set noai ts=4 sw=4: */
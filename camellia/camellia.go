@@ -0,0 +1,264 @@
+package camellia
+
+// Camellia block cipher - RFC 3713.
+//
+// A straightforward pure Go implementation intended for use with aesccm (RFC 5528
+// Camellia-CCM).  It favours clarity over speed and makes no attempt to be
+// constant time beyond what table lookups allow.
+//
+// MIT Licensed.
+
+import (
+	"crypto/cipher"
+	"encoding/binary"
+	"errors"
+	"math/bits"
+)
+
+const BlockSize = 16
+
+var ErrKeySize = errors.New("CAMELLIA: key must be 16, 24 or 32 bytes")
+
+// Key schedule constants Sigma1 ... Sigma6
+var sigma = [6]uint64{
+	0xa09e667f3bcc908b,
+	0xb67ae8584caa73b2,
+	0xc6ef372fe94f82be,
+	0x54ff53a5f1d36f1c,
+	0x10e527fade682d1d,
+	0xb05688c2b3e6c1fd,
+}
+
+// SBOX1 - SBOX2, SBOX3 and SBOX4 are rotations of it.
+var sbox1 = [256]uint8{
+	0x70, 0x82, 0x2c, 0xec, 0xb3, 0x27, 0xc0, 0xe5, 0xe4, 0x85, 0x57, 0x35, 0xea, 0x0c, 0xae, 0x41,
+	0x23, 0xef, 0x6b, 0x93, 0x45, 0x19, 0xa5, 0x21, 0xed, 0x0e, 0x4f, 0x4e, 0x1d, 0x65, 0x92, 0xbd,
+	0x86, 0xb8, 0xaf, 0x8f, 0x7c, 0xeb, 0x1f, 0xce, 0x3e, 0x30, 0xdc, 0x5f, 0x5e, 0xc5, 0x0b, 0x1a,
+	0xa6, 0xe1, 0x39, 0xca, 0xd5, 0x47, 0x5d, 0x3d, 0xd9, 0x01, 0x5a, 0xd6, 0x51, 0x56, 0x6c, 0x4d,
+	0x8b, 0x0d, 0x9a, 0x66, 0xfb, 0xcc, 0xb0, 0x2d, 0x74, 0x12, 0x2b, 0x20, 0xf0, 0xb1, 0x84, 0x99,
+	0xdf, 0x4c, 0xcb, 0xc2, 0x34, 0x7e, 0x76, 0x05, 0x6d, 0xb7, 0xa9, 0x31, 0xd1, 0x17, 0x04, 0xd7,
+	0x14, 0x58, 0x3a, 0x61, 0xde, 0x1b, 0x11, 0x1c, 0x32, 0x0f, 0x9c, 0x16, 0x53, 0x18, 0xf2, 0x22,
+	0xfe, 0x44, 0xcf, 0xb2, 0xc3, 0xb5, 0x7a, 0x91, 0x24, 0x08, 0xe8, 0xa8, 0x60, 0xfc, 0x69, 0x50,
+	0xaa, 0xd0, 0xa0, 0x7d, 0xa1, 0x89, 0x62, 0x97, 0x54, 0x5b, 0x1e, 0x95, 0xe0, 0xff, 0x64, 0xd2,
+	0x10, 0xc4, 0x00, 0x48, 0xa3, 0xf7, 0x75, 0xdb, 0x8a, 0x03, 0xe6, 0xda, 0x09, 0x3f, 0xdd, 0x94,
+	0x87, 0x5c, 0x83, 0x02, 0xcd, 0x4a, 0x90, 0x33, 0x73, 0x67, 0xf6, 0xf3, 0x9d, 0x7f, 0xbf, 0xe2,
+	0x52, 0x9b, 0xd8, 0x26, 0xc8, 0x37, 0xc6, 0x3b, 0x81, 0x96, 0x6f, 0x4b, 0x13, 0xbe, 0x63, 0x2e,
+	0xe9, 0x79, 0xa7, 0x8c, 0x9f, 0x6e, 0xbc, 0x8e, 0x29, 0xf5, 0xf9, 0xb6, 0x2f, 0xfd, 0xb4, 0x59,
+	0x78, 0x98, 0x06, 0x6a, 0xe7, 0x46, 0x71, 0xba, 0xd4, 0x25, 0xab, 0x42, 0x88, 0xa2, 0x8d, 0xfa,
+	0x72, 0x07, 0xb9, 0x55, 0xf8, 0xee, 0xac, 0x0a, 0x36, 0x49, 0x2a, 0x68, 0x3c, 0x38, 0xf1, 0xa4,
+	0x40, 0x28, 0xd3, 0x7b, 0xbb, 0xc9, 0x43, 0xc1, 0x15, 0xe3, 0xad, 0xf4, 0x77, 0xc7, 0x80, 0x9e,
+}
+
+func sbox2(x uint8) uint8 { return bits.RotateLeft8(sbox1[x], 1) }
+func sbox3(x uint8) uint8 { return bits.RotateLeft8(sbox1[x], 7) }
+func sbox4(x uint8) uint8 { return sbox1[bits.RotateLeft8(x, 1)] }
+
+type camelliaCipher struct {
+	grand bool      // 192 or 256 bit key - 24 rounds and 3 FL layers
+	kw    [4]uint64 // whitening keys
+	k     [24]uint64
+	ke    [6]uint64
+	dkw   [4]uint64 // the same keys in decryption order
+	dk    [24]uint64
+	dke   [6]uint64
+}
+
+// NewCipher creates and returns a new cipher.Block.  The key must be 16, 24 or 32
+// bytes long.
+func NewCipher(key []byte) (cipher.Block, error) {
+	c := &camelliaCipher{}
+	var kl, kr [2]uint64
+	switch len(key) {
+	case 16:
+	case 24:
+		kr[0] = binary.BigEndian.Uint64(key[16:])
+		kr[1] = ^kr[0]
+		c.grand = true
+	case 32:
+		kr[0] = binary.BigEndian.Uint64(key[16:])
+		kr[1] = binary.BigEndian.Uint64(key[24:])
+		c.grand = true
+	default:
+		return nil, ErrKeySize
+	}
+	kl[0] = binary.BigEndian.Uint64(key[0:])
+	kl[1] = binary.BigEndian.Uint64(key[8:])
+	c.expandKey(kl, kr)
+	return c, nil
+}
+
+func (c *camelliaCipher) BlockSize() int { return BlockSize }
+
+// rot128 rotates the 128 bit value x left by n bits.
+func rot128(x [2]uint64, n uint) [2]uint64 {
+	for n >= 64 {
+		x[0], x[1] = x[1], x[0]
+		n -= 64
+	}
+	if n == 0 {
+		return x
+	}
+	return [2]uint64{x[0]<<n | x[1]>>(64-n), x[1]<<n | x[0]>>(64-n)}
+}
+
+func (c *camelliaCipher) expandKey(kl, kr [2]uint64) {
+	d1, d2 := kl[0]^kr[0], kl[1]^kr[1]
+	d2 ^= f(d1, sigma[0])
+	d1 ^= f(d2, sigma[1])
+	d1 ^= kl[0]
+	d2 ^= kl[1]
+	d2 ^= f(d1, sigma[2])
+	d1 ^= f(d2, sigma[3])
+	ka := [2]uint64{d1, d2}
+	d1, d2 = ka[0]^kr[0], ka[1]^kr[1]
+	d2 ^= f(d1, sigma[4])
+	d1 ^= f(d2, sigma[5])
+	kb := [2]uint64{d1, d2}
+
+	var t [2]uint64
+	if !c.grand {
+		c.kw[0], c.kw[1] = kl[0], kl[1]
+		c.k[0], c.k[1] = ka[0], ka[1]
+		t = rot128(kl, 15)
+		c.k[2], c.k[3] = t[0], t[1]
+		t = rot128(ka, 15)
+		c.k[4], c.k[5] = t[0], t[1]
+		t = rot128(ka, 30)
+		c.ke[0], c.ke[1] = t[0], t[1]
+		t = rot128(kl, 45)
+		c.k[6], c.k[7] = t[0], t[1]
+		t = rot128(ka, 45)
+		c.k[8] = t[0]
+		t = rot128(kl, 60)
+		c.k[9] = t[1]
+		t = rot128(ka, 60)
+		c.k[10], c.k[11] = t[0], t[1]
+		t = rot128(kl, 77)
+		c.ke[2], c.ke[3] = t[0], t[1]
+		t = rot128(kl, 94)
+		c.k[12], c.k[13] = t[0], t[1]
+		t = rot128(ka, 94)
+		c.k[14], c.k[15] = t[0], t[1]
+		t = rot128(kl, 111)
+		c.k[16], c.k[17] = t[0], t[1]
+		t = rot128(ka, 111)
+		c.kw[2], c.kw[3] = t[0], t[1]
+	} else {
+		c.kw[0], c.kw[1] = kl[0], kl[1]
+		c.k[0], c.k[1] = kb[0], kb[1]
+		t = rot128(kr, 15)
+		c.k[2], c.k[3] = t[0], t[1]
+		t = rot128(ka, 15)
+		c.k[4], c.k[5] = t[0], t[1]
+		t = rot128(kr, 30)
+		c.ke[0], c.ke[1] = t[0], t[1]
+		t = rot128(kb, 30)
+		c.k[6], c.k[7] = t[0], t[1]
+		t = rot128(kl, 45)
+		c.k[8], c.k[9] = t[0], t[1]
+		t = rot128(ka, 45)
+		c.k[10], c.k[11] = t[0], t[1]
+		t = rot128(kl, 60)
+		c.ke[2], c.ke[3] = t[0], t[1]
+		t = rot128(kr, 60)
+		c.k[12], c.k[13] = t[0], t[1]
+		t = rot128(kb, 60)
+		c.k[14], c.k[15] = t[0], t[1]
+		t = rot128(kl, 77)
+		c.k[16], c.k[17] = t[0], t[1]
+		t = rot128(ka, 77)
+		c.ke[4], c.ke[5] = t[0], t[1]
+		t = rot128(kr, 94)
+		c.k[18], c.k[19] = t[0], t[1]
+		t = rot128(ka, 94)
+		c.k[20], c.k[21] = t[0], t[1]
+		t = rot128(kl, 111)
+		c.k[22], c.k[23] = t[0], t[1]
+		t = rot128(kb, 111)
+		c.kw[2], c.kw[3] = t[0], t[1]
+	}
+
+	// Decryption is encryption with the subkeys in reverse order.
+	nk, nke := c.rounds()
+	c.dkw = [4]uint64{c.kw[2], c.kw[3], c.kw[0], c.kw[1]}
+	for i := 0; i < nk; i++ {
+		c.dk[i] = c.k[nk-1-i]
+	}
+	for i := 0; i < nke; i++ {
+		c.dke[i] = c.ke[nke-1-i]
+	}
+}
+
+// rounds returns the number of rounds and of FL/FL^-1 subkeys.
+func (c *camelliaCipher) rounds() (int, int) {
+	if c.grand {
+		return 24, 6
+	}
+	return 18, 4
+}
+
+// f is the round function F.
+func f(in, ke uint64) uint64 {
+	x := in ^ ke
+	t1 := sbox1[uint8(x>>56)]
+	t2 := sbox2(uint8(x >> 48))
+	t3 := sbox3(uint8(x >> 40))
+	t4 := sbox4(uint8(x >> 32))
+	t5 := sbox2(uint8(x >> 24))
+	t6 := sbox3(uint8(x >> 16))
+	t7 := sbox4(uint8(x >> 8))
+	t8 := sbox1[uint8(x)]
+	y1 := t1 ^ t3 ^ t4 ^ t6 ^ t7 ^ t8
+	y2 := t1 ^ t2 ^ t4 ^ t5 ^ t7 ^ t8
+	y3 := t1 ^ t2 ^ t3 ^ t5 ^ t6 ^ t8
+	y4 := t2 ^ t3 ^ t4 ^ t5 ^ t6 ^ t7
+	y5 := t1 ^ t2 ^ t6 ^ t7 ^ t8
+	y6 := t2 ^ t3 ^ t5 ^ t7 ^ t8
+	y7 := t3 ^ t4 ^ t5 ^ t6 ^ t8
+	y8 := t1 ^ t4 ^ t5 ^ t6 ^ t7
+	return uint64(y1)<<56 | uint64(y2)<<48 | uint64(y3)<<40 | uint64(y4)<<32 |
+		uint64(y5)<<24 | uint64(y6)<<16 | uint64(y7)<<8 | uint64(y8)
+}
+
+func fl(in, ke uint64) uint64 {
+	x1, x2 := uint32(in>>32), uint32(in)
+	k1, k2 := uint32(ke>>32), uint32(ke)
+	x2 ^= bits.RotateLeft32(x1&k1, 1)
+	x1 ^= x2 | k2
+	return uint64(x1)<<32 | uint64(x2)
+}
+
+func flinv(in, ke uint64) uint64 {
+	y1, y2 := uint32(in>>32), uint32(in)
+	k1, k2 := uint32(ke>>32), uint32(ke)
+	y1 ^= y2 | k2
+	y2 ^= bits.RotateLeft32(y1&k1, 1)
+	return uint64(y1)<<32 | uint64(y2)
+}
+
+func (c *camelliaCipher) crypt(dst, src []byte, kw *[4]uint64, k *[24]uint64, ke *[6]uint64) {
+	if len(src) < BlockSize || len(dst) < BlockSize {
+		panic("camellia: input not full block")
+	}
+	d1 := binary.BigEndian.Uint64(src[0:]) ^ kw[0]
+	d2 := binary.BigEndian.Uint64(src[8:]) ^ kw[1]
+	nk, _ := c.rounds()
+	for i := 0; i < nk; i += 2 {
+		if i > 0 && i%6 == 0 {
+			d1 = fl(d1, ke[i/3-2])
+			d2 = flinv(d2, ke[i/3-1])
+		}
+		d2 ^= f(d1, k[i])
+		d1 ^= f(d2, k[i+1])
+	}
+	binary.BigEndian.PutUint64(dst[0:], d2^kw[2])
+	binary.BigEndian.PutUint64(dst[8:], d1^kw[3])
+}
+
+// Encrypt encrypts the first block in src into dst.
+func (c *camelliaCipher) Encrypt(dst, src []byte) { c.crypt(dst, src, &c.kw, &c.k, &c.ke) }
+
+// Decrypt decrypts the first block in src into dst.
+func (c *camelliaCipher) Decrypt(dst, src []byte) { c.crypt(dst, src, &c.dkw, &c.dk, &c.dke) }
+
+/* vim: set noai ts=4 sw=4: */
@@ -0,0 +1,43 @@
+package camellia
+
+import (
+	"encoding/hex"
+	"testing"
+)
+
+// Test vectors from RFC 3713 Appendix A.
+func TestCamellia(t *testing.T) {
+	var testData = []struct {
+		key        string
+		plaintext  string
+		ciphertext string
+	}{
+		{key: "0123456789abcdeffedcba9876543210", plaintext: "0123456789abcdeffedcba9876543210", ciphertext: "67673138549669730857065648eabe43"},
+		{key: "0123456789abcdeffedcba98765432100011223344556677", plaintext: "0123456789abcdeffedcba9876543210", ciphertext: "b4993401b3e996f84ee5cee7d79b09b9"},
+		{key: "0123456789abcdeffedcba987654321000112233445566778899aabbccddeeff", plaintext: "0123456789abcdeffedcba9876543210", ciphertext: "9acc237dff16d76c20ef7c919e3a7509"},
+	}
+
+	for ii, vv := range testData {
+		key, _ := hex.DecodeString(vv.key)
+		pt, _ := hex.DecodeString(vv.plaintext)
+		c, err := NewCipher(key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		out := make([]byte, BlockSize)
+		c.Encrypt(out, pt)
+		if got := hex.EncodeToString(out); got != vv.ciphertext {
+			t.Errorf("Test %d: Encrypt got %s, expected %s", ii, got, vv.ciphertext)
+		}
+		c.Decrypt(out, out)
+		if got := hex.EncodeToString(out); got != vv.plaintext {
+			t.Errorf("Test %d: Decrypt got %s, expected %s", ii, got, vv.plaintext)
+		}
+	}
+
+	if _, err := NewCipher(make([]byte, 15)); err != ErrKeySize {
+		t.Errorf("NewCipher with a 15 byte key: expected ErrKeySize, got %v", err)
+	}
+}
+
+/* vim: set noai ts=4 sw=4: */
@@ -31,7 +31,9 @@ type CCMType struct {
 	blk cipher.Block //
 	M   uint64       // # of octets(bytes) in authentication field	(field size 3) == (M-2)/2
 	L   uint64       // # of octets(bytes) in length field			(field size 3) == L-1
-	err error
+
+	parallel int // messages this long or longer take the parallel path, 0 for never - see SetParallel
+	workers  int // goroutines running the keystream on the parallel path
 }
 
 // ok - from spec
@@ -204,34 +206,45 @@ func CalculateNonceLengthFromMessageLength(lenOfPlaintext int) int {
 
 // One XOR and Encrypt pass of a block
 func (ccmt *CCMType) cbcOneBLock(mac, data []byte) {
-	xorBytes(mac, mac[0:CcmBlockSize], data[0:CcmBlockSize])
+	subtle.XORBytes(mac[:CcmBlockSize], mac[:CcmBlockSize], data[:CcmBlockSize])
 	ccmt.blk.Encrypt(mac, mac)
 }
 
-// Calculate a CBC for the data
+// Calculate a CBC for the data, the last block padded with zeros
 func (ccmt *CCMType) cbcString(mac, data []byte) {
-	var block [CcmBlockSize]byte
-	var i int
-	for i = 0; i < len(data)-CcmBlockSize; i += CcmBlockSize {
-		ccmt.cbcOneBLock(mac, data[i:i+CcmBlockSize])
+	for len(data) >= CcmBlockSize {
+		ccmt.cbcOneBLock(mac, data)
+		data = data[CcmBlockSize:]
 	}
-	if i < len(data) {
-		copy(block[:], data[i:])
-		ccmt.cbcOneBLock(mac, block[:])
+	if len(data) > 0 {
+		subtle.XORBytes(mac, mac, data) // same as XOR with the zero padded block
+		ccmt.blk.Encrypt(mac, mac)
 	}
 }
 
-func (ccmt *CCMType) calculateCcmTag(nonce, plaintext, adata []byte) ([]byte, error) {
-	var i int
+// ccmState holds the blocks a Seal or Open works on.  Handing them to the
+// cipher.Block interface moves them to the heap, so they are allocated together,
+// once per call - or once per goroutine in a batch.
+type ccmState struct {
+	mac [CcmBlockSize]byte // CBC-MAC, T at the end
+	ctr [CcmBlockSize]byte // counter block A_i
+	s0  [CcmBlockSize]byte // S_0, encrypts the tag
+	ks  [CcmBlockSize]byte // keystream block S_i
+	tmp [CcmBlockSize]byte // B_1 - l(a) and the start of adata
+	tag [CcmBlockSize]byte // tag from the sender of the message
+}
 
-	if len(plaintext) > ccmt.MaxLength() {
-		return nil, ErrPlaintextTooLong
+// macStart runs the CBC-MAC over B_0 and the additional data into st.mac.  The
+// message itself is added by sealBlocks or openBlocks.
+func (ccmt *CCMType) macStart(st *ccmState, nonce []byte, plen int, adata []byte) error {
+	if plen > ccmt.MaxLength() {
+		return ErrPlaintextTooLong
 	}
 	if len(nonce) != ccmt.NonceSize() {
-		return nil, ErrNonceSize
+		return ErrNonceSize
 	}
-
-	var mac [CcmBlockSize]byte
+	mac, tmp := &st.mac, &st.tmp
+	*mac, *tmp = [CcmBlockSize]byte{}, [CcmBlockSize]byte{}
 
 	/*
 	   The first block B_0 is formatted as follows, where l(m) is encoded in
@@ -278,7 +291,7 @@ func (ccmt *CCMType) calculateCcmTag(nonce, plaintext, adata []byte) ([]byte, er
 	}
 
 	// Copy to mac, 8 bytes, len of plaintext
-	binary.BigEndian.PutUint64(mac[8:], uint64(len(plaintext))) // https://golang.org/src/encoding/binary/binary.go
+	binary.BigEndian.PutUint64(mac[8:], uint64(plen)) // https://golang.org/src/encoding/binary/binary.go
 	copy(mac[1:CcmBlockSize-ccmt.L], nonce)
 	ccmt.blk.Encrypt(mac[:], mac[:])
 
@@ -309,88 +322,190 @@ func (ccmt *CCMType) calculateCcmTag(nonce, plaintext, adata []byte) ([]byte, er
 
 	*/
 	if n := uint64(len(adata)); n > 0 {
-		var tmp [CcmBlockSize]byte
+		var i int
 		switch {
 		case n <= 0xfeff:
 			i = 2
 			binary.BigEndian.PutUint16(tmp[:i], uint16(n))
-		case n > 0xfeff && n < uint64(1<<32):
+		case n < uint64(1<<32):
 			i = 6 // 2 + 4 for len
-			binary.BigEndian.PutUint16(tmp[0:], uint16(0xfeff))
-			binary.BigEndian.PutUint64(tmp[2:i], uint64(n))
+			binary.BigEndian.PutUint16(tmp[0:], 0xfffe)
+			binary.BigEndian.PutUint32(tmp[2:i], uint32(n))
 		default:
 			i = 10 // 2 + 8 for len
-			binary.BigEndian.PutUint16(tmp[0:], uint16(0xfeff))
-			binary.BigEndian.PutUint64(tmp[2:i], uint64(n))
+			binary.BigEndian.PutUint16(tmp[0:], 0xffff)
+			binary.BigEndian.PutUint64(tmp[2:i], n)
 		}
 		i = copy(tmp[i:], adata)
 		ccmt.cbcOneBLock(mac[:], tmp[:])  // add in tmp
 		ccmt.cbcString(mac[:], adata[i:]) // add in adata
 	}
+	return nil
+}
 
-	if len(plaintext) > 0 {
-		ccmt.cbcString(mac[:], plaintext)
-	}
+/*
+
+   The message is encrypted by XORing the octets of message m with the
+   first l(m) octets of the concatenation of S_1, S_2, S_3, ... .  Note
+   that S_0 is not used to encrypt the message.
+
+   The authentication value U is computed by encrypting T with the key
+   stream block S_0 and truncating it to the desired length.
+
+      U := T XOR first-M-bytes( S_0 )
 
-	return mac[:ccmt.M], nil
+   The final result c consists of the encrypted message followed by the
+   encrypted authentication value U.
+
+*/
+
+// counterStart sets st.ctr to A_0 and st.s0 to S_0.  The counter lives in the
+// low L bytes; the length limit keeps it from ever carrying into the nonce, so
+// nextCounter counts in the low 8 bytes.
+func (ccmt *CCMType) counterStart(st *ccmState, nonce []byte) {
+	st.ctr = [CcmBlockSize]byte{}
+	st.ctr[0] = uint8(ccmt.L - 1)
+	copy(st.ctr[1:CcmBlockSize-ccmt.L], nonce)
+	ccmt.blk.Encrypt(st.s0[:], st.ctr[:])
 }
 
-func (ccmt *CCMType) calcCcmTag(nonce, aTag []byte, InitializationVector *[CcmBlockSize]byte) {
-	InitializationVector[0] = uint8(ccmt.L - 1)
-	copy(InitializationVector[1:CcmBlockSize-ccmt.L], nonce)
-	var tmpTag [CcmBlockSize]byte
-	ccmt.blk.Encrypt(tmpTag[:], InitializationVector[:])
-	for i := 0; i < int(ccmt.M); i++ {
-		aTag[i] ^= tmpTag[i]
+// ccmChunk is how much of the message is run through the keystream and the
+// CBC-MAC at a time on the bulk path.  Small enough to stay in L1 between the
+// two, large enough that the CTR stream gets to encrypt several counter blocks
+// per call - crypto/aes does that 8 blocks wide where the hardware allows.
+const ccmChunk = 512
+
+// sealBlocks adds plaintext to the CBC-MAC and encrypts it into out in a single
+// pass.  The MAC is a serial chain, every Encrypt waits on the one before, while
+// the keystream blocks are independent.  Short messages issue one of each per
+// block so the keystream Encrypt runs in the shadow of the MAC Encrypt; longer
+// ones alternate chunks of MAC with chunks of bulk CTR.  out and plaintext may
+// alias exactly.  st.ctr is left at the last counter block used, so a message
+// can be passed in pieces, all but the last a whole number of blocks.
+func (ccmt *CCMType) sealBlocks(st *ccmState, out, plaintext []byte) {
+	if ccmt.parallel > 0 && len(plaintext) >= ccmt.parallel {
+		ccmt.parallelBlocks(st, out, plaintext, false)
+		return
+	}
+	mac, ctr, ks := &st.mac, &st.ctr, &st.ks
+	if len(plaintext) >= ccmChunk {
+		ccmt.nextCounter(ctr)
+		stream := cipher.NewCTR(ccmt.blk, ctr[:])
+		ccmt.skipCounter(ctr, (len(plaintext)-1)/CcmBlockSize)
+		for len(plaintext) > 0 {
+			n := min(ccmChunk, len(plaintext))
+			ccmt.cbcString(mac[:], plaintext[:n]) // before out overwrites it
+			stream.XORKeyStream(out[:n], plaintext[:n])
+			out, plaintext = out[n:], plaintext[n:]
+		}
+		return
+	}
+	for len(plaintext) > 0 {
+		n := min(CcmBlockSize, len(plaintext))
+		ccmt.nextCounter(ctr)
+		subtle.XORBytes(mac[:], mac[:], plaintext[:n]) // same as XOR with the zero padded block
+		ccmt.blk.Encrypt(mac[:], mac[:])
+		ccmt.blk.Encrypt(ks[:], ctr[:])
+		subtle.XORBytes(out[:n], plaintext[:n], ks[:])
+		out, plaintext = out[n:], plaintext[n:]
 	}
-	InitializationVector[len(InitializationVector)-1] |= 1 //
+}
+
+// openBlocks is sealBlocks in reverse, decrypting ciphertext into out and adding
+// the plaintext to the CBC-MAC.  out and ciphertext may alias exactly, and
+// st.ctr is left as sealBlocks leaves it.
+func (ccmt *CCMType) openBlocks(st *ccmState, out, ciphertext []byte) {
+	if ccmt.parallel > 0 && len(ciphertext) >= ccmt.parallel {
+		ccmt.parallelBlocks(st, out, ciphertext, true)
+		return
+	}
+	mac, ctr, ks := &st.mac, &st.ctr, &st.ks
+	if len(ciphertext) >= ccmChunk {
+		ccmt.nextCounter(ctr)
+		stream := cipher.NewCTR(ccmt.blk, ctr[:])
+		ccmt.skipCounter(ctr, (len(ciphertext)-1)/CcmBlockSize)
+		for len(ciphertext) > 0 {
+			n := min(ccmChunk, len(ciphertext))
+			stream.XORKeyStream(out[:n], ciphertext[:n])
+			ccmt.cbcString(mac[:], out[:n])
+			out, ciphertext = out[n:], ciphertext[n:]
+		}
+		return
+	}
+	// The keystream runs a block ahead so its Encrypt does not wait on the MAC.
+	if len(ciphertext) > 0 {
+		ccmt.nextCounter(ctr)
+		ccmt.blk.Encrypt(ks[:], ctr[:])
+	}
+	for len(ciphertext) > 0 {
+		n := min(CcmBlockSize, len(ciphertext))
+		subtle.XORBytes(out[:n], ciphertext[:n], ks[:])
+		subtle.XORBytes(mac[:], mac[:], out[:n])
+		ccmt.blk.Encrypt(mac[:], mac[:])
+		if len(ciphertext) > n {
+			ccmt.nextCounter(ctr)
+			ccmt.blk.Encrypt(ks[:], ctr[:])
+		}
+		out, ciphertext = out[n:], ciphertext[n:]
+	}
+}
+
+// nextCounter steps ctr to the next counter block.
+func (ccmt *CCMType) nextCounter(ctr *[CcmBlockSize]byte) {
+	binary.BigEndian.PutUint64(ctr[8:], binary.BigEndian.Uint64(ctr[8:])+1)
+}
+
+// skipCounter steps ctr on n counter blocks.
+func (ccmt *CCMType) skipCounter(ctr *[CcmBlockSize]byte, n int) {
+	binary.BigEndian.PutUint64(ctr[8:], binary.BigEndian.Uint64(ctr[8:])+uint64(n))
 }
 
 // Seal - adds the CCM tag to the plaintext.   The data is encrypted
 // and the results are added to 'dst'.  The nonce is used and therefore
-// must be NonceSize() long.
+// must be NonceSize() long.  Seal returns nil if the message cannot be
+// sealed.  It changes nothing in ccmt, so one CCMType can seal on several
+// goroutines at once.
 func (ccmt *CCMType) Seal(dst, nonce, plaintext, adata []byte) (rv []byte) {
-	var InitializationVector [CcmBlockSize]byte // CcmBlockSize == 16
+	rv, _ = ccmt.seal(dst, nonce, plaintext, adata)
+	return
+}
 
-	ccmt.err = nil // No errors yet
+// seal is Seal returning its error.
+func (ccmt *CCMType) seal(dst, nonce, plaintext, adata []byte) ([]byte, error) {
+	return ccmt.sealState(new(ccmState), dst, nonce, plaintext, adata)
+}
 
-	// if nonce is too long then truncate it.
-	NonceLength := CalculateNonceLengthFromMessageLength(len(plaintext))
-	if len(nonce) > NonceLength {
+func (ccmt *CCMType) sealState(st *ccmState, dst, nonce, plaintext, adata []byte) ([]byte, error) {
+	// if nonce is too long then truncate it (SJCL passes a 16 byte IV and uses the front of it).
+	// The plaintext length is checked against `L` in macStart.
+	if NonceLength := ccmt.NonceSize(); len(nonce) > NonceLength {
 		nonce = nonce[0:NonceLength]
 	}
 
-	if ll := 15 - NonceLength; ll != int(ccmt.L) {
-		// godebug.Printf(db1, "****************** l=%d ccmt.L=%d\n", ll, ccmt.L)
-		ccmt.err = ErrInvalidNonceLength
-		return
-	}
-
-	aTag, err := ccmt.calculateCcmTag(nonce, plaintext, adata)
-	if err != nil {
-		ccmt.err = err
-		return
+	if err := ccmt.macStart(st, nonce, len(plaintext), adata); err != nil {
+		return nil, err
 	}
 
-	ccmt.calcCcmTag(nonce, aTag, &InitializationVector)
-	stream := cipher.NewCTR(ccmt.blk, InitializationVector[:])  //
-	ret, out := sliceForAppend(dst, len(plaintext)+int(ccmt.M)) //	<<<<<<<<<<<<<<<<<<<<<<<<<<<<<<< diff >>>>>>>>>>>>>>>>>>>>>>>>>
-	stream.XORKeyStream(out, plaintext)                         // do the encrypt of plaintext
+	ccmt.counterStart(st, nonce)
+	ret, out := sliceForAppend(dst, len(plaintext)+int(ccmt.M))
+	ccmt.sealBlocks(st, out, plaintext) // do the encrypt of plaintext
 
-	copy(out[len(plaintext):], aTag) // stick tag on end, after encrypted plaintext	 -- was aTag
-	return ret
+	subtle.XORBytes(out[len(plaintext):], st.mac[:ccmt.M], st.s0[:]) // stick tag on end, after encrypted plaintext
+	return ret, nil
 }
 
 // Open is the complement operation to Seal.  This is what you do on the
 // receiving end when you have a CCM sealed and encrypted  message.
 // It calculates the CCM based on the nonce, cypher text and adata
 // then performs a compare to verify that the data matches the
-// original.
+// original.  ct is not modified unless dst aliases it; if the tags do
+// not match the plaintext written to dst is zeroed.
 func (ccmt *CCMType) Open(dst, nonce, ct, adata []byte) ([]byte, error) {
-	var InitializationVector [CcmBlockSize]byte
+	return ccmt.openState(new(ccmState), dst, nonce, ct, adata)
+}
 
-	NonceLength := CalculateNonceLengthFromMessageLength(len(ct) - int(ccmt.M))
-	if len(nonce) > NonceLength {
+func (ccmt *CCMType) openState(st *ccmState, dst, nonce, ct, adata []byte) ([]byte, error) {
+	if NonceLength := ccmt.NonceSize(); len(nonce) > NonceLength {
 		nonce = nonce[0:NonceLength] // Truncate if too long
 	}
 
@@ -402,24 +517,23 @@ func (ccmt *CCMType) Open(dst, nonce, ct, adata []byte) ([]byte, error) {
 		return nil, ErrCiphertextTooShort
 	}
 
-	CipherText := ct[:len(ct)-int(ccmt.M)]     //
-	aTag := ct[len(ct)-int(ccmt.M):]           // Tag from Sender of Message
-	PlainText := make([]byte, len(CipherText)) //
-
-	ccmt.calcCcmTag(nonce, aTag, &InitializationVector)        // Generate the tag from the data - so can compare and validate tags.
-	stream := cipher.NewCTR(ccmt.blk, InitializationVector[:]) //
-	stream.XORKeyStream(PlainText, CipherText)
+	CipherText := ct[:len(ct)-int(ccmt.M)]  //
+	copy(st.tag[:], ct[len(CipherText):]) // Tag from Sender of Message, before dst can overwrite it
 
-	expectedTag, err := ccmt.calculateCcmTag(nonce, PlainText, adata)
-	if err != nil {
+	if err := ccmt.macStart(st, nonce, len(CipherText), adata); err != nil {
 		return nil, err
 	}
 
-	// fmt.Printf("Tag in message[%x] Expected[%x], %s\n", SenderOrigTag, expectedTag, godebug.LF())
+	ccmt.counterStart(st, nonce)
+	ret, out := sliceForAppend(dst, len(CipherText))
+	ccmt.openBlocks(st, out, CipherText)
+	subtle.XORBytes(st.mac[:ccmt.M], st.mac[:ccmt.M], st.s0[:])
+
 	// if the orignal tag and the current tag match then we are golden!
-	if subtle.ConstantTimeCompare(expectedTag, aTag) == 1 {
-		return append(dst, PlainText...), nil
+	if subtle.ConstantTimeCompare(st.mac[:ccmt.M], st.tag[:ccmt.M]) == 1 {
+		return ret, nil
 	}
+	clear(out)
 	return nil, ErrOpenError
 }
 
@@ -258,6 +258,46 @@ func Test_NonceLength(t *testing.T) {
 
 }
 
+// Nonces shorter than 13 bytes are valid for short messages - they are not limited
+// to the nonce length SJCL would pick.  Test vectors from NIST SP 800-38C Appendix C.
+func Test_NonceSizes(t *testing.T) {
+	var testData = []struct {
+		nonce      string
+		adata      string
+		plaintext  string
+		ciphertext string
+	}{
+		{nonce: "10111213141516", adata: "0001020304050607", plaintext: "20212223", ciphertext: "7162015b4dac255d"},
+		{nonce: "1011121314151617", adata: "000102030405060708090a0b0c0d0e0f", plaintext: "202122232425262728292a2b2c2d2e2f", ciphertext: "d2a1f0e051ea5f62081a7792073d593d1fc64fbfaccd"},
+		{nonce: "101112131415161718191a1b", adata: "000102030405060708090a0b0c0d0e0f10111213", plaintext: "202122232425262728292a2b2c2d2e2f3031323334353637", ciphertext: "e3b201a9f5b71a7a9b1ceaeccd97e70b6176aad9a4428aa5484392fbc1b09951"},
+	}
+
+	key, _ := hex.DecodeString("404142434445464748494a4b4c4d4e4f")
+	Aes, err := aes.NewCipher(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for ii, vv := range testData {
+		nonce, _ := hex.DecodeString(vv.nonce)
+		adata, _ := hex.DecodeString(vv.adata)
+		plaintext, _ := hex.DecodeString(vv.plaintext)
+
+		AesCCM, err := NewCCM(Aes, hex.DecodedLen(len(vv.ciphertext))-len(plaintext), len(nonce))
+		if err != nil {
+			t.Fatal(err)
+		}
+		ct := AesCCM.Seal(nil, nonce, plaintext, adata)
+		if got := fmt.Sprintf("%x", ct); got != vv.ciphertext {
+			t.Errorf("Test %d: got %s, expected %s", ii, got, vv.ciphertext)
+			continue
+		}
+		if pt, err := AesCCM.Open(nil, nonce, ct, adata); err != nil || !bytes.Equal(pt, plaintext) {
+			t.Errorf("Test %d: Open failed, err=%v", ii, err)
+		}
+	}
+}
+
 func BenchmarkAESCCMSeal(b *testing.B) {
 	var key [aes.BlockSize]byte
 	var nonce [13]byte
@@ -280,6 +320,135 @@ func BenchmarkAESCCMSeal(b *testing.B) {
 	}
 }
 
+// Additional data of 2^16-2^8 bytes and up has its length written after 0xfffe.
+// Ciphertexts from OpenSSL.
+func Test_LongAdata(t *testing.T) {
+	var testData = []struct {
+		adataLen   int
+		ciphertext string
+	}{
+		{adataLen: 0xfeff, ciphertext: "21d513e2552e0859782f0d8163"},
+		{adataLen: 0xff00, ciphertext: "21d513e2556fe98a3b80b247c5"},
+		{adataLen: 70000, ciphertext: "21d513e2553b1914097b2d9684"},
+	}
+
+	key, _ := hex.DecodeString("404142434445464748494a4b4c4d4e4f")
+	nonce, _ := hex.DecodeString("101112131415161718191a1b1c")
+	Aes, _ := aes.NewCipher(key)
+	AesCCM, err := NewCCM(Aes, 8, len(nonce))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for ii, vv := range testData {
+		adata := make([]byte, vv.adataLen)
+		for i := range adata {
+			adata[i] = byte(i)
+		}
+		ct := AesCCM.Seal(nil, nonce, []byte("hello"), adata)
+		if got := fmt.Sprintf("%x", ct); got != vv.ciphertext {
+			t.Errorf("Test %d: got %s, expected %s", ii, got, vv.ciphertext)
+			continue
+		}
+		if pt, err := AesCCM.Open(nil, nonce, ct, adata); err != nil || string(pt) != "hello" {
+			t.Errorf("Test %d: Open failed, err=%v", ii, err)
+		}
+	}
+}
+
+// Open leaves the ciphertext alone, works in place and clears its output when the
+// tag does not match.
+func Test_OpenInPlace(t *testing.T) {
+	key, _ := hex.DecodeString("404142434445464748494a4b4c4d4e4f")
+	nonce := make([]byte, 13)
+	Aes, _ := aes.NewCipher(key)
+	AesCCM, _ := NewCCM(Aes, 16, 13)
+
+	for _, n := range []int{0, 1, 15, 16, 17, 100} {
+		plaintext := bytes.Repeat([]byte{'p'}, n)
+		ct := AesCCM.Seal(nil, nonce, plaintext, nil)
+		saved := append([]byte(nil), ct...)
+
+		if pt, err := AesCCM.Open(nil, nonce, ct, nil); err != nil || !bytes.Equal(pt, plaintext) {
+			t.Errorf("Len %d: Open failed, err=%v", n, err)
+		}
+		if !bytes.Equal(ct, saved) {
+			t.Errorf("Len %d: Open modified the ciphertext", n)
+		}
+
+		sealed := AesCCM.Seal(plaintext[:0], nonce, plaintext, nil)
+		if !bytes.Equal(sealed, saved) {
+			t.Errorf("Len %d: in place Seal got %x", n, sealed)
+		}
+		if pt, err := AesCCM.Open(sealed[:0], nonce, sealed, nil); err != nil || !bytes.Equal(pt, bytes.Repeat([]byte{'p'}, n)) {
+			t.Errorf("Len %d: in place Open failed, err=%v", n, err)
+		}
+
+		bad := append([]byte(nil), saved...)
+		bad[len(bad)-1] ^= 1
+		dst := make([]byte, 0, n)
+		if _, err := AesCCM.Open(dst, nonce, bad, nil); err != ErrOpenError {
+			t.Errorf("Len %d: expected ErrOpenError, got %v", n, err)
+		}
+		if n > 0 && !bytes.Equal(dst[:n], make([]byte, n)) {
+			t.Errorf("Len %d: plaintext left in dst after a failed Open", n)
+		}
+	}
+}
+
+var benchSizes = []struct {
+	name string
+	size int
+}{
+	{"64B", 64},
+	{"1KiB", 1 << 10},
+	{"16KiB", 16 << 10},
+	{"1MiB", 1 << 20},
+}
+
+func BenchmarkSeal(b *testing.B) {
+	key, _ := hex.DecodeString("d7828d13b2b0bdc325a76236df93cc6b")
+	Aes, _ := aes.NewCipher(key)
+	AesCCM, _ := NewCCM(Aes, 16, 12)
+	nonce := make([]byte, 12)
+	adata := make([]byte, 13)
+
+	for _, bs := range benchSizes {
+		b.Run(bs.name, func(b *testing.B) {
+			buf := make([]byte, bs.size)
+			out := make([]byte, 0, bs.size+16)
+			b.SetBytes(int64(bs.size))
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				out = AesCCM.Seal(out[:0], nonce, buf, adata)
+			}
+		})
+	}
+}
+
+func BenchmarkOpen(b *testing.B) {
+	key, _ := hex.DecodeString("d7828d13b2b0bdc325a76236df93cc6b")
+	Aes, _ := aes.NewCipher(key)
+	AesCCM, _ := NewCCM(Aes, 16, 12)
+	nonce := make([]byte, 12)
+	adata := make([]byte, 13)
+
+	for _, bs := range benchSizes {
+		b.Run(bs.name, func(b *testing.B) {
+			ct := AesCCM.Seal(nil, nonce, make([]byte, bs.size), adata)
+			out := make([]byte, 0, bs.size)
+			b.SetBytes(int64(bs.size))
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				var err error
+				if out, err = AesCCM.Open(out[:0], nonce, ct, adata); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
 func Test_maximumLengthForMessage(t *testing.T) {
 	var testData = []struct {
 		L       uint64
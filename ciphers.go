@@ -0,0 +1,45 @@
+// CCM with block ciphers other than AES.
+//
+// NewCCM accepts any 128-bit cipher.Block.  These constructors pair it with the pure
+// Go Camellia (RFC 5528), ARIA (RFC 6209) and SM4 (RFC 8998) implementations in the
+// sub-packages for deployments that are required to use a national cipher.
+//
+// MIT Licensed
+//
+
+package aesccm
+
+import (
+	"github.com/pschlump/AesCCM/aria"
+	"github.com/pschlump/AesCCM/camellia"
+	"github.com/pschlump/AesCCM/sm4"
+)
+
+// NewCamelliaCCM returns Camellia in CCM mode.  The key must be 16, 24 or 32 bytes.
+func NewCamelliaCCM(key []byte, TagSize int, NonceSize int) (CCM, error) {
+	blk, err := camellia.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return NewCCM(blk, TagSize, NonceSize)
+}
+
+// NewARIACCM returns ARIA in CCM mode.  The key must be 16, 24 or 32 bytes.
+func NewARIACCM(key []byte, TagSize int, NonceSize int) (CCM, error) {
+	blk, err := aria.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return NewCCM(blk, TagSize, NonceSize)
+}
+
+// NewSM4CCM returns SM4 in CCM mode.  The key must be 16 bytes.
+func NewSM4CCM(key []byte, TagSize int, NonceSize int) (CCM, error) {
+	blk, err := sm4.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return NewCCM(blk, TagSize, NonceSize)
+}
+
+/* vim: set noai ts=4 sw=4: */
@@ -0,0 +1,65 @@
+package aesccm
+
+import (
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"testing"
+)
+
+func TestOtherCiphersCCM(t *testing.T) {
+	var testData = []struct {
+		name       string
+		newCCM     func(key []byte, TagSize int, NonceSize int) (CCM, error)
+		key        string
+		nonce      string
+		adata      string
+		plaintext  string
+		ciphertext string
+	}{
+		// RFC 5528 - Camellia Counter with CBC-MAC, Packet Vectors #1 - #3
+		{name: "Camellia", newCCM: NewCamelliaCCM, key: "c0c1c2c3c4c5c6c7c8c9cacbcccdcecf", nonce: "00000003020100a0a1a2a3a4a5", adata: "0001020304050607", plaintext: "08090a0b0c0d0e0f101112131415161718191a1b1c1d1e", ciphertext: "ba737185e719310492f38a5f1251da55fafbc949848a0dfcaece746b3db9ad"},
+		{name: "Camellia", newCCM: NewCamelliaCCM, key: "c0c1c2c3c4c5c6c7c8c9cacbcccdcecf", nonce: "00000004030201a0a1a2a3a4a5", adata: "0001020304050607", plaintext: "08090a0b0c0d0e0f101112131415161718191a1b1c1d1e1f", ciphertext: "5d2564bf8eafe1d99526ec016d1bf0424cfbd2cd62848f3360b2295df24283e8"},
+		{name: "Camellia", newCCM: NewCamelliaCCM, key: "c0c1c2c3c4c5c6c7c8c9cacbcccdcecf", nonce: "00000005040302a0a1a2a3a4a5", adata: "0001020304050607", plaintext: "08090a0b0c0d0e0f101112131415161718191a1b1c1d1e1f20", ciphertext: "81f663d6c7787817f9203608b982ad15dc2bbd87d756f79204f551d6682f23aa46"},
+		// RFC 8998 - SM4-CCM, Appendix A.2
+		{name: "SM4", newCCM: NewSM4CCM, key: "0123456789abcdeffedcba9876543210", nonce: "00001234567800000000abcd", adata: "feedfacedeadbeeffeedfacedeadbeefabaddad2", plaintext: "aaaaaaaaaaaaaaaabbbbbbbbbbbbbbbbccccccccccccccccddddddddddddddddeeeeeeeeeeeeeeeeffffffffffffffffeeeeeeeeeeeeeeeeaaaaaaaaaaaaaaaa", ciphertext: "48af93501fa62adbcd414cce6034d895dda1bf8f132f042098661572e7483094fd12e518ce062c98acee28d95df4416bed31a2f04476c18bb40c84a74b97dc5b16842d4fa186f56ab33256971fa110f4"},
+		// ARIA-CCM - RFC 6209 does not include CCM vectors, these were produced with OpenSSL's aria-*-ccm
+		{name: "ARIA", newCCM: NewARIACCM, key: "000102030405060708090a0b0c0d0e0f", nonce: "101112131415161718191a1b", adata: "0001020304050607", plaintext: "202122232425262728292a2b2c2d2e2f", ciphertext: "f0bb223249e2d2b7fe87fa687240a8fabacf9114e525cfbf5fcaf0d2ff280fcf"},
+		{name: "ARIA", newCCM: NewARIACCM, key: "000102030405060708090a0b0c0d0e0f1011121314151617", nonce: "10111213141516", adata: "000102030405060708090a0b0c0d0e0f10111213", plaintext: "202122232425262728292a2b2c2d2e2f303132333435363738", ciphertext: "0e4258b7c397cc72f914b1cbd335a239fdc8dfb97100995706b2f6adf66ab99af8"},
+		{name: "ARIA", newCCM: NewARIACCM, key: "000102030405060708090a0b0c0d0e0f101112131415161718191a1b1c1d1e1f", nonce: "00000003020100a0a1a2a3a4a5", adata: "", plaintext: "08090a0b0c0d0e0f101112131415161718191a1b1c1d1e1f2021222324252627", ciphertext: "7978061e016d7f994dfb5ff4fec24177778a3de2ace27969a71633389477259cefc1c7b5"},
+	}
+
+	for ii, vv := range testData {
+		key, _ := hex.DecodeString(vv.key)
+		nonce, _ := hex.DecodeString(vv.nonce)
+		adata, _ := hex.DecodeString(vv.adata)
+		plaintext, _ := hex.DecodeString(vv.plaintext)
+
+		c, err := vv.newCCM(key, hex.DecodedLen(len(vv.ciphertext))-len(plaintext), len(nonce))
+		if err != nil {
+			t.Fatalf("%s Test %d: %s", vv.name, ii, err)
+		}
+		ct := c.Seal(nil, nonce, plaintext, adata)
+		if got := fmt.Sprintf("%x", ct); got != vv.ciphertext {
+			t.Errorf("%s Test %d: got %s, expected %s", vv.name, ii, got, vv.ciphertext)
+			continue
+		}
+		pt, err := c.Open(nil, nonce, ct, adata)
+		if err != nil || !bytes.Equal(pt, plaintext) {
+			t.Errorf("%s Test %d: Open failed, err=%v", vv.name, ii, err)
+		}
+		ct[0] ^= 1
+		if _, err := c.Open(nil, nonce, ct, adata); err == nil {
+			t.Errorf("%s Test %d: altered ciphertext, Open should have failed", vv.name, ii)
+		}
+	}
+
+	if _, err := NewSM4CCM(make([]byte, 32), 16, 12); err == nil {
+		t.Errorf("NewSM4CCM with a 32 byte key should have failed")
+	}
+	if _, err := NewCamelliaCCM(make([]byte, 20), 16, 12); err == nil {
+		t.Errorf("NewCamelliaCCM with a 20 byte key should have failed")
+	}
+}
+
+/* vim: set noai ts=4 sw=4: */
@@ -0,0 +1,350 @@
+package main
+
+// The encrypt and decrypt commands.
+//
+// MIT Licensed
+
+import (
+	"bufio"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+
+	"github.com/pschlump/AesCCM"
+	"github.com/pschlump/AesCCM/envelope"
+	"github.com/pschlump/AesCCM/kdf"
+	"github.com/pschlump/AesCCM/sjcl"
+)
+
+var errSJCLPassword = errors.New("aesccm: -format sjcl needs a password")
+var errSJCLStream = errors.New("aesccm: -stream cannot write sjcl")
+var errPasswordSizes = errors.New("aesccm: password envelopes are always AES-256 with a 16 byte tag and 13 byte nonce, use -stream or -format sjcl to change them")
+var errEnvelopeNonce = errors.New("aesccm: envelopes pick the nonce at random and need -nonce 12 or 13, which holds up to 16 MiB; use -stream for more")
+var errSJCLNonce = errors.New("aesccm: sjcl picks the nonce size from the message length, -nonce cannot be used")
+
+func encrypt(o *options) error {
+	key, password, err := o.keyOrPassword()
+	if err != nil {
+		return err
+	}
+	defer zero(key)
+	adata, err := o.readAdata()
+	if err != nil {
+		return err
+	}
+	if o.format != "raw" && o.format != "hex" && o.format != "base64" && o.format != "sjcl" {
+		return errFormat
+	}
+
+	in, err := o.openInput()
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	f, err := o.createOutput()
+	if err != nil {
+		return err
+	}
+	w, finish := encodeOutput(f, o.format)
+
+	switch {
+	case o.stream:
+		err = encryptStream(o, w, in, key, password, adata)
+	case o.format == "sjcl":
+		err = encryptSJCL(o, w, in, password, adata)
+	default:
+		err = encryptEnvelope(o, w, in, key, password, adata)
+	}
+	if err == nil {
+		err = finish()
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+func encryptStream(o *options, w io.Writer, in io.Reader, key, password, adata []byte) error {
+	if o.format == "sjcl" {
+		return errSJCLStream
+	}
+	var p *kdf.Params
+	keySize := len(key)
+	if password != nil {
+		params, err := o.kdfParams(0)
+		if err != nil {
+			return err
+		}
+		p, keySize = &params, 32
+	}
+	nonceSize := o.nonceSize
+	if nonceSize == 0 {
+		nonceSize = 13 // segments are always short enough
+	}
+	h, err := newStreamHeader(o.tagSize, nonceSize, keySize, p)
+	if err != nil {
+		return err
+	}
+	ccm, err := h.streamCCM(key, password, kdf.DefaultLimits)
+	if err != nil {
+		return err
+	}
+	return sealStream(w, in, h, ccm, adata)
+}
+
+func encryptSJCL(o *options, w io.Writer, in io.Reader, password, adata []byte) error {
+	if password == nil {
+		return errSJCLPassword
+	}
+	if o.set["nonce"] {
+		return errSJCLNonce
+	}
+	p, err := o.kdfParams(sjcl.DefaultIter)
+	if err != nil {
+		return err
+	}
+	pt, err := io.ReadAll(in)
+	if err != nil {
+		return err
+	}
+	tagSize := sjcl.DefaultTagSize
+	if o.set["tag"] {
+		tagSize = o.tagSize * 8
+	}
+	eBlob, err := sjcl.Encrypt(password, pt, adata, p, o.keySize, tagSize)
+	if err != nil {
+		return err
+	}
+	b, err := eBlob.MarshalSJCL()
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(append(b, '\n'))
+	return err
+}
+
+func encryptEnvelope(o *options, w io.Writer, in io.Reader, key, password, adata []byte) error {
+	pt, err := io.ReadAll(in)
+	if err != nil {
+		return err
+	}
+	var out []byte
+	if password != nil {
+		if o.set["tag"] || o.set["nonce"] {
+			return errPasswordSizes
+		}
+		p, err := o.kdfParams(0)
+		if err != nil {
+			return err
+		}
+		out, err = envelope.SealPassword(password, p, pt, adata)
+	} else {
+		nonceSize := o.nonceSize
+		if nonceSize == 0 {
+			nonceSize = aesccm.MaxNonceLength(len(pt))
+		}
+		if nonceSize < envelope.MinSealNonceSize {
+			return errEnvelopeNonce
+		}
+		var kr *envelope.SingleKey
+		if kr, err = envelope.NewSingleKey(0, key, o.tagSize, nonceSize); err == nil {
+			out, err = envelope.Seal(kr, pt, adata)
+		}
+	}
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(out)
+	return err
+}
+
+// encodeOutput wraps w in the hex or base64 encoder for format.  finish flushes
+// the encoder and ends the text with a newline.
+func encodeOutput(w io.Writer, format string) (io.Writer, func() error) {
+	var enc io.WriteCloser
+	switch format {
+	case "hex":
+		enc = nopWriteCloser{hex.NewEncoder(w)}
+	case "base64":
+		enc = base64.NewEncoder(base64.StdEncoding, w)
+	default:
+		return w, func() error { return nil }
+	}
+	return enc, func() error {
+		if err := enc.Close(); err != nil {
+			return err
+		}
+		_, err := io.WriteString(w, "\n")
+		return err
+	}
+}
+
+func decrypt(o *options) error {
+	key, password, err := o.keyOrPassword()
+	if err != nil {
+		return err
+	}
+	defer zero(key)
+	adata, err := o.readAdata()
+	if err != nil {
+		return err
+	}
+	in, err := o.openInput()
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	r, format, err := decodeInput(in, o.format)
+	if err != nil {
+		return err
+	}
+
+	f, err := o.createOutput()
+	if err != nil {
+		return err
+	}
+	if format == "sjcl" {
+		err = decryptSJCL(f, r, password, o.limits)
+	} else {
+		err = decryptBinary(f, r, key, password, adata, o.limits)
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+func decryptSJCL(w io.Writer, r io.Reader, password []byte, limits kdf.Limits) error {
+	if password == nil {
+		return errSJCLPassword
+	}
+	var eBlob sjcl.SJCL_DataStruct
+	if err := json.NewDecoder(r).Decode(&eBlob); err != nil {
+		return err
+	}
+	pt, err := sjcl.DecryptLimits(password, eBlob, limits)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(pt)
+	return err
+}
+
+func decryptBinary(w io.Writer, r *bufio.Reader, key, password, adata []byte, limits kdf.Limits) error {
+	magic, err := r.Peek(1)
+	if err != nil {
+		return errNotRecognized
+	}
+	if magic[0] == streamMagic {
+		h, raw, err := readStreamHeader(r)
+		if err != nil {
+			return err
+		}
+		ccm, err := h.streamCCM(key, password, limits)
+		if err != nil {
+			return err
+		}
+		return openStream(w, r, &h, raw, ccm, adata)
+	}
+
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	var pt []byte
+	switch data[0] {
+	case envelope.Magic:
+		pt, err = openEnvelope(key, data, adata)
+	case envelope.PasswordMagic:
+		if password == nil {
+			return errNoKey
+		}
+		pt, err = envelope.OpenPasswordLimits(password, data, adata, limits)
+	default:
+		return errNotRecognized
+	}
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(pt)
+	return err
+}
+
+// openEnvelope opens an envelope with key, whatever tag and nonce size it uses.
+func openEnvelope(key, data, adata []byte) ([]byte, error) {
+	if key == nil {
+		return nil, errNoKey
+	}
+	h, err := envelope.ParseHeader(data)
+	if err != nil {
+		return nil, err
+	}
+	kr, err := envelope.NewSingleKey(h.KeyID, key, h.TagSize, h.NonceSize)
+	if err != nil {
+		return nil, envelope.ErrAlgorithm
+	}
+	return envelope.Open(kr, data, adata)
+}
+
+// decodeInput undoes the hex or base64 encoding of in and tells the binary
+// formats from SJCL JSON.  An empty format means look at the first byte:
+//
+//	0xCC-0xCF	raw - every binary format starts with one of these
+//	'c', 'C'	hex of the same
+//	'z'			base64 of the same
+//	'{'			SJCL JSON
+func decodeInput(in io.Reader, format string) (*bufio.Reader, string, error) {
+	br := bufio.NewReader(in)
+	if format == "" {
+		b, err := br.Peek(1)
+		if err != nil {
+			return nil, "", errNotRecognized
+		}
+		switch c := b[0]; {
+		case c >= 0xCC && c <= 0xCF:
+			format = "raw"
+		case c == 'c' || c == 'C':
+			format = "hex"
+		case c == 'z':
+			format = "base64"
+		case c == '{':
+			format = "sjcl"
+		default:
+			return nil, "", errNotRecognized
+		}
+	}
+	switch format {
+	case "raw", "sjcl":
+		return br, format, nil
+	case "hex":
+		return bufio.NewReader(hex.NewDecoder(skipSpace{br})), "raw", nil
+	case "base64":
+		return bufio.NewReader(base64.NewDecoder(base64.StdEncoding, skipSpace{br})), "raw", nil
+	}
+	return nil, "", errFormat
+}
+
+// skipSpace drops white space, such as the newline at the end of hex output.
+type skipSpace struct {
+	r io.Reader
+}
+
+func (s skipSpace) Read(p []byte) (int, error) {
+	for {
+		n, err := s.r.Read(p)
+		j := 0
+		for _, c := range p[:n] {
+			if c != ' ' && c != '\t' && c != '\r' && c != '\n' {
+				p[j] = c
+				j++
+			}
+		}
+		if j > 0 || err != nil {
+			return j, err
+		}
+	}
+}
+
+/* vim: set noai ts=4 sw=4: */
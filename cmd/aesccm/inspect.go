@@ -0,0 +1,153 @@
+package main
+
+// The inspect command - prints what can be read from encrypted data without
+// the key.
+//
+// MIT Licensed
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/pschlump/AesCCM/envelope"
+	"github.com/pschlump/AesCCM/kdf"
+	"github.com/pschlump/AesCCM/sjcl"
+)
+
+func inspect(o *options) error {
+	in, err := o.openInput()
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	r, format, err := decodeInput(in, o.format)
+	if err != nil {
+		return err
+	}
+	w := o.stdout
+	field := func(name, format string, a ...interface{}) {
+		fmt.Fprintf(w, "%-13s %s\n", name+":", fmt.Sprintf(format, a...))
+	}
+
+	if format == "sjcl" {
+		var eBlob sjcl.SJCL_DataStruct
+		if err := json.NewDecoder(r).Decode(&eBlob); err != nil {
+			return err
+		}
+		field("format", "sjcl")
+		field("algorithm", "%s-%d-%s, %d bit tag", strings.ToUpper(eBlob.Cipher), eBlob.KeySize, strings.ToUpper(eBlob.Mode), eBlob.TagSize)
+		field("kdf", "%s", describeKDF(eBlob.KDFParams()))
+		field("salt", "%x", []byte(eBlob.Salt))
+		field("iv", "%x", []byte(eBlob.InitilizationVector))
+		if nonce, _ := sjcl.GetNonce(eBlob); len(nonce) > 0 {
+			field("nonce", "%x (%d bytes for this length)", nonce, len(nonce))
+		}
+		field("adata", "%q", []byte(eBlob.AdditionalData))
+		describeCiphertext(field, len(eBlob.CipherText), eBlob.TagSize/8)
+		return nil
+	}
+
+	magic, err := r.Peek(1)
+	if err != nil {
+		return errNotRecognized
+	}
+	if magic[0] == streamMagic {
+		h, _, err := readStreamHeader(r)
+		if err != nil {
+			return err
+		}
+		field("format", "stream")
+		field("version", "%d", streamVersion)
+		field("algorithm", "%s", describeAlgorithm(h.keySize, h.tagSize, h.nonceSize))
+		field("segment size", "%d", 1<<h.segmentLog)
+		if h.kdf != nil {
+			field("kdf", "%s", describeKDF(*h.kdf))
+			field("salt", "%x", h.salt)
+		} else {
+			field("key", "raw key")
+		}
+		field("nonce prefix", "%x", h.prefix)
+		n, err := io.Copy(io.Discard, r)
+		if err != nil {
+			return err
+		}
+		segment := int64(1<<h.segmentLog + h.tagSize)
+		segments := (n + segment - 1) / segment
+		field("ciphertext", "%d bytes in %d segments (%d bytes of plaintext)", n, segments, n-segments*int64(h.tagSize))
+		return nil
+	}
+
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	switch data[0] {
+	case envelope.Magic:
+		h, err := envelope.ParseHeader(data)
+		if err != nil {
+			return err
+		}
+		field("format", "envelope")
+		describeEnvelope(field, h, len(data))
+	case envelope.PasswordMagic:
+		p, salt, n, err := envelope.ParsePasswordHeader(data)
+		if err != nil {
+			return err
+		}
+		h, err := envelope.ParseHeader(data[n:])
+		if err != nil {
+			return err
+		}
+		field("format", "password envelope")
+		field("kdf", "%s", describeKDF(p))
+		field("salt", "%x", salt)
+		describeEnvelope(field, h, len(data)-n)
+	case envelope.DataKeyMagic:
+		e, err := envelope.ParseDataKeyEnvelope(data)
+		if err != nil {
+			return err
+		}
+		field("format", "data key envelope")
+		field("version", "%d", envelope.Version)
+		field("kek id", "%s", e.KEKID)
+		field("wrapped key", "%d bytes", len(e.WrappedKey))
+		field("nonce", "%x", e.Nonce)
+		describeCiphertext(field, len(e.Ciphertext), envelope.DataKeyTagSize)
+	default:
+		return errNotRecognized
+	}
+	return nil
+}
+
+func describeEnvelope(field func(string, string, ...interface{}), h envelope.Header, size int) {
+	field("version", "%d", h.Version)
+	field("algorithm", "%s", describeAlgorithm(h.KeySize, h.TagSize, h.NonceSize))
+	field("key id", "%d", h.KeyID)
+	field("nonce", "%x", h.Nonce)
+	describeCiphertext(field, size-h.Len(), h.TagSize)
+}
+
+func describeCiphertext(field func(string, string, ...interface{}), n, tagSize int) {
+	field("ciphertext", "%d bytes (%d bytes of plaintext)", n, n-tagSize)
+}
+
+func describeAlgorithm(keySize, tagSize, nonceSize int) string {
+	return fmt.Sprintf("AES-%d-CCM, %d byte tag, %d byte nonce", keySize*8, tagSize, nonceSize)
+}
+
+// describeKDF prints the name and the parameters that apply to it.
+func describeKDF(p kdf.Params) string {
+	switch p.Name {
+	case kdf.Scrypt:
+		return fmt.Sprintf("%s, N %d, r %d, p %d", p.Name, p.N, p.R, p.P)
+	case kdf.Argon2id:
+		return fmt.Sprintf("%s, %d passes, %d KiB, %d threads", p.Name, p.Iter, p.Memory, p.P)
+	case "":
+		p.Name = kdf.PBKDF2SHA256
+	}
+	return fmt.Sprintf("%s, %d iterations", p.Name, p.Iter)
+}
+
+/* vim: set noai ts=4 sw=4: */
@@ -0,0 +1,47 @@
+package main
+
+// The keygen command.
+//
+// MIT Licensed
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"io"
+)
+
+func keygen(o *options) error {
+	if !validKeySize(o.keySize) {
+		return errKeySize
+	}
+	var text []byte
+	key := make([]byte, o.keySize)
+	defer zero(key)
+	if _, err := io.ReadFull(rand.Reader, key); err != nil {
+		return err
+	}
+	switch o.format {
+	case "raw":
+		text = key
+	case "hex":
+		text = append(hex.AppendEncode(nil, key), '\n')
+	case "base64":
+		text = append(base64.StdEncoding.AppendEncode(nil, key), '\n')
+	default:
+		return errFormat
+	}
+	defer zero(text)
+
+	f, err := o.createOutput()
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(text)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+/* vim: set noai ts=4 sw=4: */
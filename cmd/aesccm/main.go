@@ -0,0 +1,303 @@
+// Command aesccm encrypts and decrypts files with AES-CCM.
+//
+// Usage:
+//
+//	aesccm encrypt [flags] [file]	seal file (or stdin) to -o (or stdout)
+//	aesccm decrypt [flags] [file]	open what encrypt produced
+//	aesccm keygen [flags]			write a new random key
+//	aesccm inspect [file]			describe encrypted data without a key
+//
+// The key is given with -key (hex), -keyfile (a 16, 24 or 32 byte key in hex,
+// base64 or raw, as keygen writes it) or comes from a password, -password or
+// -passfile, run through -kdf (pbkdf2-sha256 or argon2id, -iter to change the
+// cost).
+//
+// encrypt writes one of these, picked with -format and -stream:
+//
+//	raw, hex, base64	an envelope (see the envelope package) sealed under the key,
+//						or a password envelope when a password is used
+//	sjcl				SJCL JSON, as sjcl.encrypt() makes - password only
+//	-stream				the segmented stream format in stream.go, for files too
+//						big to hold in memory; raw, hex or base64
+//
+// decrypt works out the format by itself unless -format says otherwise.  -adata
+// or -adatafile give additional authenticated data; decrypt needs the same.  The
+// input names its own KDF cost, so decrypt refuses more than kdf.DefaultLimits
+// unless -maxiter or -maxmem raise them.
+//
+// MIT Licensed
+//
+
+package main
+
+import (
+	"bufio"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/pschlump/AesCCM/kdf"
+)
+
+var errUsage = errors.New("aesccm: bad usage")
+var errNoKey = errors.New("aesccm: give a key with -key or -keyfile, or a password with -password or -passfile")
+var errKeyAndPassword = errors.New("aesccm: give either a key or a password, not both")
+var errKeySize = errors.New("aesccm: key must be 16, 24 or 32 bytes")
+var errFormat = errors.New("aesccm: unknown -format, use raw, hex, base64 or sjcl")
+var errNotRecognized = errors.New("aesccm: input is not in a format aesccm knows, try -format")
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdin, os.Stdout, os.Stderr))
+}
+
+const usage = `usage: aesccm <command> [flags] [file]
+
+commands:
+  encrypt   encrypt file or stdin
+  decrypt   decrypt file or stdin
+  keygen    generate a random key
+  inspect   describe encrypted data
+
+Run aesccm <command> -h for the flags of a command.
+`
+
+// run is main without the exit, so tests can call it.
+func run(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	if len(args) == 0 {
+		fmt.Fprint(stderr, usage)
+		return 2
+	}
+	var cmd func(*options) error
+	switch args[0] {
+	case "encrypt":
+		cmd = encrypt
+	case "decrypt":
+		cmd = decrypt
+	case "keygen":
+		cmd = keygen
+	case "inspect":
+		cmd = inspect
+	case "help", "-h", "-help", "--help":
+		fmt.Fprint(stdout, usage)
+		return 0
+	default:
+		fmt.Fprintf(stderr, "aesccm: unknown command %q\n%s", args[0], usage)
+		return 2
+	}
+
+	o, err := parseFlags(args[0], args[1:], stderr)
+	if err == flag.ErrHelp {
+		return 0
+	} else if err != nil {
+		return 2
+	}
+	o.stdin, o.stdout = stdin, stdout
+	if err := cmd(o); err != nil {
+		fmt.Fprintln(stderr, err)
+		if err == errUsage {
+			return 2
+		}
+		return 1
+	}
+	return 0
+}
+
+// options are the flags of every command; each command registers the ones it uses.
+type options struct {
+	key, keyFile       string //
+	password, passFile string //
+	kdfName            string //
+	iter               int    //
+	limits             kdf.Limits
+	tagSize, nonceSize int    // bytes
+	keySize            int    // bits for sjcl, bytes for keygen
+	adata, adataFile   string //
+	format             string //
+	stream             bool   //
+	output             string //
+	input              string // "" or "-" for stdin
+	set                map[string]bool
+
+	stdin  io.Reader
+	stdout io.Writer
+}
+
+func parseFlags(cmd string, args []string, stderr io.Writer) (*options, error) {
+	o := &options{set: map[string]bool{}}
+	fs := flag.NewFlagSet("aesccm "+cmd, flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	keyFlags := func() {
+		fs.StringVar(&o.key, "key", "", "AES key in hex")
+		fs.StringVar(&o.keyFile, "keyfile", "", "file holding the AES key, hex, base64 or raw")
+		fs.StringVar(&o.password, "password", "", "password to derive the key from (visible to other users, prefer -passfile)")
+		fs.StringVar(&o.passFile, "passfile", "", "file whose first line is the password")
+		fs.StringVar(&o.adata, "adata", "", "additional authenticated data")
+		fs.StringVar(&o.adataFile, "adatafile", "", "file holding the additional authenticated data")
+		fs.StringVar(&o.output, "o", "", "output file, stdout by default")
+	}
+	switch cmd {
+	case "encrypt":
+		keyFlags()
+		fs.StringVar(&o.kdfName, "kdf", kdf.PBKDF2SHA256, "password KDF: pbkdf2-sha256 or argon2id")
+		fs.IntVar(&o.iter, "iter", 0, "KDF iterations (passes for argon2id), 0 for the default")
+		fs.IntVar(&o.tagSize, "tag", 16, "tag size in bytes, 4 to 16")
+		fs.IntVar(&o.nonceSize, "nonce", 0, "nonce size in bytes, 12 or 13 (13 with -stream and a key, 7 to 13 with -stream and a password); 0 for the longest the message length allows")
+		fs.IntVar(&o.keySize, "keysize", 128, "key size in bits for -format sjcl")
+		fs.StringVar(&o.format, "format", "raw", "output format: raw, hex, base64 or sjcl")
+		fs.BoolVar(&o.stream, "stream", false, "use the segmented stream format, for large files")
+	case "decrypt":
+		keyFlags()
+		fs.StringVar(&o.format, "format", "", "input format: raw, hex, base64 or sjcl; detected if not given")
+		fs.IntVar(&o.limits.MaxIter, "maxiter", kdf.DefaultLimits.MaxIter, "most PBKDF2 iterations the input may ask for")
+		fs.IntVar(&o.limits.MaxMemory, "maxmem", kdf.DefaultLimits.MaxMemory, "most KDF memory in KiB the input may ask for (argon2id, scrypt)")
+	case "keygen":
+		fs.IntVar(&o.keySize, "size", 32, "key size in bytes: 16, 24 or 32")
+		fs.StringVar(&o.format, "format", "hex", "output format: raw, hex or base64")
+		fs.StringVar(&o.output, "o", "", "output file, stdout by default")
+	case "inspect":
+		fs.StringVar(&o.format, "format", "", "input format: raw, hex, base64 or sjcl; detected if not given")
+	}
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+	fs.Visit(func(f *flag.Flag) { o.set[f.Name] = true })
+	switch fs.NArg() {
+	case 0:
+	case 1:
+		o.input = fs.Arg(0)
+	default:
+		fmt.Fprintf(stderr, "aesccm %s: too many arguments\n", cmd)
+		fs.Usage()
+		return nil, errUsage
+	}
+	return o, nil
+}
+
+// openInput returns the input file, or stdin.
+func (o *options) openInput() (io.ReadCloser, error) {
+	if o.input == "" || o.input == "-" {
+		return io.NopCloser(o.stdin), nil
+	}
+	return os.Open(o.input)
+}
+
+// createOutput returns the output file, or stdout.  Files are created 0600, the
+// output of keygen and decrypt is secret.
+func (o *options) createOutput() (io.WriteCloser, error) {
+	if o.output == "" || o.output == "-" {
+		return nopWriteCloser{o.stdout}, nil
+	}
+	return os.OpenFile(o.output, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+}
+
+type nopWriteCloser struct {
+	io.Writer
+}
+
+func (nopWriteCloser) Close() error {
+	return nil
+}
+
+// keyOrPassword returns the key or the password, whichever was given.
+func (o *options) keyOrPassword() (key, password []byte, err error) {
+	hasKey, hasPassword := o.key != "" || o.keyFile != "", o.password != "" || o.passFile != ""
+	switch {
+	case hasKey && hasPassword:
+		return nil, nil, errKeyAndPassword
+	case o.key != "" && o.keyFile != "", o.password != "" && o.passFile != "":
+		return nil, nil, errUsage
+	case o.key != "":
+		key, err = hex.DecodeString(strings.TrimSpace(o.key))
+	case o.keyFile != "":
+		key, err = readKeyFile(o.keyFile)
+	case o.password != "":
+		return nil, []byte(o.password), nil
+	case o.passFile != "":
+		password, err = readPassFile(o.passFile)
+		return nil, password, err
+	default:
+		return nil, nil, errNoKey
+	}
+	if err == nil && !validKeySize(len(key)) {
+		err = errKeySize
+	}
+	return key, nil, err
+}
+
+// readKeyFile takes a key in hex or base64, as keygen writes it, or raw.  Text
+// is tried first; random key bytes are never valid hex or base64 of the right
+// length by chance.
+func readKeyFile(path string) ([]byte, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	text := strings.TrimSpace(string(b))
+	for _, decode := range []func(string) ([]byte, error){hex.DecodeString, base64.StdEncoding.DecodeString} {
+		if key, err := decode(text); err == nil && validKeySize(len(key)) {
+			zero(b)
+			return key, nil
+		}
+	}
+	return b, nil
+}
+
+func validKeySize(n int) bool {
+	return n == 16 || n == 24 || n == 32
+}
+
+func readPassFile(path string) ([]byte, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	line, err := bufio.NewReader(f).ReadBytes('\n')
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+	return []byte(strings.TrimRight(string(line), "\r\n")), nil
+}
+
+func (o *options) readAdata() ([]byte, error) {
+	if o.adata != "" && o.adataFile != "" {
+		return nil, errUsage
+	}
+	if o.adataFile != "" {
+		return os.ReadFile(o.adataFile)
+	}
+	return []byte(o.adata), nil
+}
+
+// kdfParams returns the -kdf parameters, with -iter if given.
+func (o *options) kdfParams(defaultIter int) (kdf.Params, error) {
+	var p kdf.Params
+	switch o.kdfName {
+	case "", kdf.PBKDF2SHA256:
+		p = kdf.DefaultPBKDF2
+		if defaultIter > 0 {
+			p.Iter = defaultIter
+		}
+	case kdf.Argon2id:
+		p = kdf.DefaultArgon2id
+	default:
+		return p, kdf.ErrUnknownKDF
+	}
+	if o.iter > 0 {
+		p.Iter = o.iter
+	}
+	return p, nil
+}
+
+func zero(b []byte) {
+	for i := range b {
+		b[i] = 0
+	}
+}
+
+/* vim: set noai ts=4 sw=4: */
@@ -0,0 +1,178 @@
+package main
+
+import (
+	"bytes"
+	"crypto/rand"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+var update = flag.Bool("update", false, "rewrite the golden files in testdata")
+
+// The inputs in testdata were made once with encrypt; encryption is randomized,
+// so the golden files hold what decrypt and inspect make of them.
+func TestGolden(t *testing.T) {
+	var testData = []struct {
+		name string
+		args []string
+	}{
+		{name: "usage", args: nil},
+		{name: "unknown-command", args: []string{"frobnicate"}},
+		{name: "decrypt-envelope-hex", args: []string{"decrypt", "-keyfile", "testdata/key.hex", "-adata", "golden", "testdata/envelope.hex"}},
+		{name: "decrypt-envelope-short-b64", args: []string{"decrypt", "-keyfile", "testdata/key.hex", "testdata/envelope-short.b64"}},
+		{name: "decrypt-password", args: []string{"decrypt", "-passfile", "testdata/pass.txt", "testdata/password.bin"}},
+		{name: "decrypt-password-argon2id", args: []string{"decrypt", "-passfile", "testdata/pass.txt", "-adata", "golden", "testdata/password-argon2id.b64"}},
+		{name: "decrypt-stream", args: []string{"decrypt", "-keyfile", "testdata/key.hex", "testdata/stream.bin"}},
+		{name: "decrypt-stream-password", args: []string{"decrypt", "-passfile", "testdata/pass.txt", "testdata/stream-password.hex"}},
+		{name: "decrypt-sjcl", args: []string{"decrypt", "-passfile", "testdata/pass.txt", "testdata/sjcl.json"}},
+		{name: "decrypt-wrong-adata", args: []string{"decrypt", "-keyfile", "testdata/key.hex", "-adata", "silver", "testdata/envelope.hex"}},
+		{name: "decrypt-wrong-password", args: []string{"decrypt", "-password", "hunter2", "testdata/password.bin"}},
+		{name: "decrypt-password-maxiter", args: []string{"decrypt", "-passfile", "testdata/pass.txt", "-maxiter", "999", "testdata/password.bin"}},
+		{name: "decrypt-password-maxmem", args: []string{"decrypt", "-passfile", "testdata/pass.txt", "-adata", "golden", "-maxmem", "1024", "testdata/password-argon2id.b64"}},
+		{name: "decrypt-stream-maxiter", args: []string{"decrypt", "-passfile", "testdata/pass.txt", "-maxiter", "999", "testdata/stream-password.hex"}},
+		{name: "decrypt-sjcl-maxiter", args: []string{"decrypt", "-passfile", "testdata/pass.txt", "-maxiter", "999", "testdata/sjcl.json"}},
+		{name: "decrypt-no-key", args: []string{"decrypt", "testdata/envelope.hex"}},
+		{name: "decrypt-not-recognized", args: []string{"decrypt", "-keyfile", "testdata/key.hex", "testdata/plain.txt"}},
+		{name: "encrypt-key-and-password", args: []string{"encrypt", "-keyfile", "testdata/key.hex", "-password", "x", "testdata/plain.txt"}},
+		{name: "encrypt-sjcl-key", args: []string{"encrypt", "-format", "sjcl", "-keyfile", "testdata/key.hex", "testdata/plain.txt"}},
+		{name: "encrypt-password-tag", args: []string{"encrypt", "-password", "x", "-tag", "8", "testdata/plain.txt"}},
+		{name: "encrypt-envelope-nonce", args: []string{"encrypt", "-keyfile", "testdata/key.hex", "-nonce", "7", "testdata/plain.txt"}},
+		{name: "encrypt-stream-nonce", args: []string{"encrypt", "-stream", "-keyfile", "testdata/key.hex", "-nonce", "12", "testdata/plain.txt"}},
+		{name: "encrypt-bad-tag", args: []string{"encrypt", "-keyfile", "testdata/key.hex", "-tag", "5", "testdata/plain.txt"}},
+		{name: "encrypt-too-many-args", args: []string{"encrypt", "-keyfile", "testdata/key.hex", "a", "b"}},
+		{name: "inspect-envelope-hex", args: []string{"inspect", "testdata/envelope.hex"}},
+		{name: "inspect-envelope-short-b64", args: []string{"inspect", "testdata/envelope-short.b64"}},
+		{name: "inspect-password", args: []string{"inspect", "testdata/password.bin"}},
+		{name: "inspect-password-argon2id", args: []string{"inspect", "testdata/password-argon2id.b64"}},
+		{name: "inspect-stream", args: []string{"inspect", "testdata/stream.bin"}},
+		{name: "inspect-stream-password", args: []string{"inspect", "testdata/stream-password.hex"}},
+		{name: "inspect-sjcl", args: []string{"inspect", "testdata/sjcl.json"}},
+		{name: "keygen-bad-size", args: []string{"keygen", "-size", "20"}},
+	}
+
+	for _, vv := range testData {
+		t.Run(vv.name, func(t *testing.T) {
+			var stdout, stderr bytes.Buffer
+			code := run(vv.args, strings.NewReader(""), &stdout, &stderr)
+			got := fmt.Sprintf("exit %d\n--- stdout\n%s--- stderr\n%s", code, stdout.String(), stderr.String())
+
+			golden := filepath.Join("testdata", vv.name+".golden")
+			if *update {
+				if err := os.WriteFile(golden, []byte(got), 0644); err != nil {
+					t.Fatal(err)
+				}
+				return
+			}
+			expect, err := os.ReadFile(golden)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != string(expect) {
+				t.Errorf("got\n%s\nexpected\n%s", got, expect)
+			}
+		})
+	}
+}
+
+// Every way of encrypting decrypts again, and damage is caught.
+func TestRoundTrip(t *testing.T) {
+	small := []byte("attack at dawn")
+	large := make([]byte, 3*(1<<streamSegmentLog)+100)
+	rand.Read(large)
+	exact := large[:2<<streamSegmentLog] // ends on a segment boundary
+
+	var testData = []struct {
+		args      []string
+		plaintext []byte
+	}{
+		{args: []string{"-keyfile", "testdata/key.hex"}, plaintext: small},
+		{args: []string{"-key", "000102030405060708090a0b0c0d0e0f", "-tag", "4", "-nonce", "12", "-format", "hex"}, plaintext: small},
+		{args: []string{"-keyfile", "testdata/key.hex", "-format", "base64", "-adata", "ad"}, plaintext: large},
+		{args: []string{"-password", "pw", "-iter", "1000", "-format", "hex"}, plaintext: small},
+		{args: []string{"-password", "pw", "-iter", "1000", "-format", "sjcl", "-keysize", "256", "-tag", "16"}, plaintext: small},
+		{args: []string{"-password", "pw", "-iter", "1000", "-format", "sjcl", "-adata", "ad"}, plaintext: large},
+		{args: []string{"-stream", "-keyfile", "testdata/key.hex"}, plaintext: nil},
+		{args: []string{"-stream", "-keyfile", "testdata/key.hex", "-adata", "ad"}, plaintext: large},
+		{args: []string{"-stream", "-keyfile", "testdata/key.hex"}, plaintext: exact},
+		{args: []string{"-stream", "-password", "pw", "-iter", "1000", "-format", "base64", "-nonce", "11"}, plaintext: large},
+	}
+
+	for ii, vv := range testData {
+		var ct, pt, stderr bytes.Buffer
+		if code := run(append([]string{"encrypt"}, vv.args...), bytes.NewReader(vv.plaintext), &ct, &stderr); code != 0 {
+			t.Errorf("Test %d: encrypt exit %d: %s", ii, code, stderr.String())
+			continue
+		}
+		decryptArgs := []string{"decrypt"}
+		for i := 0; i < len(vv.args); i++ {
+			switch vv.args[i] {
+			case "-key", "-keyfile", "-password", "-adata":
+				decryptArgs = append(decryptArgs, vv.args[i], vv.args[i+1])
+			}
+		}
+		if code := run(decryptArgs, bytes.NewReader(ct.Bytes()), &pt, &stderr); code != 0 || !bytes.Equal(pt.Bytes(), vv.plaintext) {
+			t.Errorf("Test %d: decrypt exit %d: %s", ii, code, stderr.String())
+			continue
+		}
+
+		// Flip a bit of binary output, or change a character of text output.
+		bad := bytes.Clone(ct.Bytes())
+		switch {
+		case bad[0] == '{':
+			bad[bytes.Index(bad, []byte(`"ct":"`))+7] ^= 1
+		case bad[0] == 'c' || bad[0] == 'z':
+			i := bytes.LastIndexAny(bad[:len(bad)-4], "0123456789")
+			bad[i] = '0' + (bad[i]-'0'+1)%10
+		default:
+			bad[len(bad)-1] ^= 1
+		}
+		pt.Reset()
+		if code := run(decryptArgs, bytes.NewReader(bad), &pt, &stderr); code != 1 {
+			t.Errorf("Test %d: damaged input decrypted, exit %d", ii, code)
+		}
+	}
+}
+
+// A stream cut short at a segment boundary fails, even though every segment
+// that is left is intact.
+func TestStreamTruncated(t *testing.T) {
+	plaintext := make([]byte, 3<<streamSegmentLog)
+	var ct, pt, stderr bytes.Buffer
+	if code := run([]string{"encrypt", "-stream", "-keyfile", "testdata/key.hex"}, bytes.NewReader(plaintext), &ct, &stderr); code != 0 {
+		t.Fatalf("encrypt exit %d: %s", code, stderr.String())
+	}
+	h, err := newStreamHeader(16, 13, 32, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hdr, _ := h.encode()
+	cut := len(hdr) + 2*(1<<streamSegmentLog+16)
+	code := run([]string{"decrypt", "-keyfile", "testdata/key.hex"}, bytes.NewReader(ct.Bytes()[:cut]), &pt, &stderr)
+	if code != 1 || !strings.Contains(stderr.String(), "segment 1") {
+		t.Errorf("truncated stream: exit %d, %s", code, stderr.String())
+	}
+}
+
+func TestKeygen(t *testing.T) {
+	dir := t.TempDir()
+	for _, format := range []string{"hex", "base64", "raw"} {
+		path := filepath.Join(dir, "key."+format)
+		var out, stderr bytes.Buffer
+		if code := run([]string{"keygen", "-size", "24", "-format", format, "-o", path}, nil, &out, &stderr); code != 0 {
+			t.Fatalf("keygen exit %d: %s", code, stderr.String())
+		}
+		if fi, err := os.Stat(path); err != nil || fi.Mode().Perm() != 0600 {
+			t.Errorf("%s: key file %v %v", format, fi, err)
+		}
+		key, err := readKeyFile(path)
+		if err != nil || len(key) != 24 {
+			t.Errorf("%s: read back %d bytes, %v", format, len(key), err)
+		}
+	}
+}
+
+/* vim: set noai ts=4 sw=4: */
@@ -0,0 +1,275 @@
+// The segmented stream format.
+//
+// A single CCM message has to be held in memory whole: the tag comes after the
+// ciphertext and nothing may be released before it is checked.  For large files
+// the plaintext is cut into segments of 2^S bytes, each sealed on its own, so
+// both sides need only one segment in memory at a time.
+//
+//	Offset	Size	Contents
+//	0		1		Magic, 0xCD
+//	1		1		Version, 1
+//	2		1		Algorithm id, packed as in the envelope package
+//	3		1		S, log2 of the segment size
+//	4		1		Key source, 0 = key, 1 = password
+//	5		...		Password only: kdf.Params binary form, salt length, salt
+//	...		N-5		Nonce prefix, random
+//	...				Segments, each CCM ciphertext || tag
+//
+// With a key the prefix is all that keeps the nonces of two streams apart, so it
+// has to be at least 8 bytes - a 13 byte nonce.  With a password each stream has
+// its own salt, and so its own key, and any nonce size will do.
+//
+// Segment i is sealed with the nonce
+//
+//	prefix || i (4 bytes, big endian) || 1 for the last segment, 0 before it
+//
+// and the header followed by the caller's additional data as additional data.  The
+// counter stops segments being reordered, dropped or moved between files, and
+// the last flag stops the stream being cut short at a segment boundary.  Every
+// stream has a last segment, empty if the data ends on a segment boundary.
+//
+// Plaintext is written out a segment at a time once that segment is verified, so
+// a stream that fails part way leaves the verified segments before it behind.
+//
+// MIT Licensed
+//
+
+package main
+
+import (
+	"bufio"
+	"crypto/aes"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/pschlump/AesCCM"
+	"github.com/pschlump/AesCCM/envelope"
+	"github.com/pschlump/AesCCM/kdf"
+)
+
+const streamMagic = 0xCD
+const streamVersion = 1
+const streamSegmentLog = 15  // 32 KiB, under the 64 KiB limit of a 13 byte nonce
+const streamCounterSize = 5  // segment number and last flag
+const minKeyStreamPrefix = 8 // random prefix bytes when a key is used directly
+
+var errStreamHeader = errors.New("aesccm: bad stream header")
+var errStreamTooLong = errors.New("aesccm: stream has too many segments")
+var errStreamNonce = errors.New("aesccm: -stream with a key needs -nonce 13, for an 8 byte random nonce prefix; shorter nonces need a password")
+
+// streamHeader is the front of a stream.
+type streamHeader struct {
+	tagSize, nonceSize, keySize int         //
+	segmentLog                  int         //
+	kdf                         *kdf.Params // nil if a key is used directly
+	salt                        []byte      //
+	prefix                      []byte      // nonceSize-5 bytes
+}
+
+func (h *streamHeader) encode() ([]byte, error) {
+	alg, err := envelope.Algorithm(h.tagSize, h.nonceSize, h.keySize)
+	if err != nil {
+		return nil, err
+	}
+	b := []byte{streamMagic, streamVersion, alg, byte(h.segmentLog), 0}
+	if h.kdf != nil {
+		b[4] = 1
+		if b, err = h.kdf.AppendBinary(b); err != nil {
+			return nil, err
+		}
+		b = append(append(b, byte(len(h.salt))), h.salt...)
+	}
+	return append(b, h.prefix...), nil
+}
+
+// readStreamHeader reads the header from r and returns it with its encoding.
+func readStreamHeader(r *bufio.Reader) (h streamHeader, raw []byte, err error) {
+	fixed := make([]byte, 5)
+	if _, err = io.ReadFull(r, fixed); err != nil {
+		return h, nil, errStreamHeader
+	}
+	if fixed[0] != streamMagic {
+		return h, nil, errStreamHeader
+	}
+	if fixed[1] != streamVersion {
+		return h, nil, envelope.ErrVersion
+	}
+	alg := fixed[2]
+	h.tagSize, h.nonceSize, h.keySize = int(alg>>5)*2+2, int(alg>>2&7)+7, 16+8*int(alg&3)
+	if alg>>5 == 0 || h.nonceSize > 13 || alg&3 == 3 {
+		return h, nil, envelope.ErrAlgorithm
+	}
+	h.segmentLog = int(fixed[3])
+	if h.segmentLog < 4 || h.segmentLog > 30 || h.segmentLog >= 8*(15-h.nonceSize) {
+		return h, nil, errStreamHeader
+	}
+	raw = fixed
+
+	switch fixed[4] {
+	case 0:
+	case 1:
+		b, _ := r.Peek(64) // longer than any kdf.Params, a short read is fine
+		p, n, err := kdf.ParseBinary(b)
+		if err != nil {
+			return h, nil, err
+		}
+		h.kdf = &p
+		raw = append(raw, b[:n]...)
+		r.Discard(n)
+		saltLen, err := r.ReadByte()
+		if err != nil {
+			return h, nil, errStreamHeader
+		}
+		h.salt = make([]byte, saltLen)
+		if _, err := io.ReadFull(r, h.salt); err != nil {
+			return h, nil, errStreamHeader
+		}
+		raw = append(append(raw, saltLen), h.salt...)
+	default:
+		return h, nil, errStreamHeader
+	}
+
+	h.prefix = make([]byte, h.nonceSize-streamCounterSize)
+	if _, err := io.ReadFull(r, h.prefix); err != nil {
+		return h, nil, errStreamHeader
+	}
+	return h, append(raw, h.prefix...), nil
+}
+
+// streamCCM returns the CCM for the stream, deriving the key from password if
+// the stream uses one.  The KDF named in the header has to be within limits.
+func (h *streamHeader) streamCCM(key, password []byte, limits kdf.Limits) (aesccm.CCM, error) {
+	if h.kdf != nil {
+		if password == nil {
+			return nil, errNoKey
+		}
+		k, err := limits.DeriveKey(*h.kdf, password, h.salt, h.keySize)
+		if err != nil {
+			return nil, err
+		}
+		defer zero(k)
+		key = k
+	} else if key == nil {
+		return nil, errNoKey
+	} else if len(key) != h.keySize {
+		return nil, envelope.ErrAlgorithm
+	}
+	blk, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return aesccm.NewCCM(blk, h.tagSize, h.nonceSize)
+}
+
+// newStreamHeader sets up a header with a fresh nonce prefix, and a fresh salt if
+// p is not nil.
+func newStreamHeader(tagSize, nonceSize, keySize int, p *kdf.Params) (*streamHeader, error) {
+	if nonceSize <= streamCounterSize {
+		return nil, aesccm.ErrNonceSize
+	}
+	if p == nil && nonceSize-streamCounterSize < minKeyStreamPrefix {
+		return nil, errStreamNonce
+	}
+	h := &streamHeader{tagSize: tagSize, nonceSize: nonceSize, keySize: keySize, segmentLog: streamSegmentLog, kdf: p}
+	h.prefix = make([]byte, nonceSize-streamCounterSize)
+	if _, err := io.ReadFull(rand.Reader, h.prefix); err != nil {
+		return nil, err
+	}
+	if p != nil {
+		h.salt = make([]byte, 16)
+		if _, err := io.ReadFull(rand.Reader, h.salt); err != nil {
+			return nil, err
+		}
+	}
+	return h, nil
+}
+
+// sealStream writes the header and then r in segments to w.
+func sealStream(w io.Writer, r io.Reader, h *streamHeader, ccm aesccm.CCM, adata []byte) error {
+	hdr, err := h.encode()
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(hdr); err != nil {
+		return err
+	}
+	ad := append(hdr, adata...)
+
+	segment := 1 << h.segmentLog
+	buf := make([]byte, segment+1) // one byte more tells the last segment from the others
+	out := make([]byte, 0, segment+h.tagSize)
+	nonce := make([]byte, h.nonceSize)
+	copy(nonce, h.prefix)
+	n, err := io.ReadFull(r, buf)
+	for i := uint64(0); ; i++ {
+		if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+			return err
+		}
+		if i > 0xffffffff {
+			return errStreamTooLong
+		}
+		last := n <= segment
+		segmentNonce(nonce, len(h.prefix), uint32(i), last)
+		out = ccm.Seal(out[:0], nonce, buf[:min(n, segment)], ad)
+		if out == nil {
+			return aesccm.ErrSealFailed
+		}
+		if _, err := w.Write(out); err != nil {
+			return err
+		}
+		if last {
+			return nil
+		}
+		buf[0] = buf[segment]
+		n, err = io.ReadFull(r, buf[1:])
+		n++
+	}
+}
+
+// openStream reads segments from r, after the header, and writes the plaintext
+// of each to w as soon as it is verified.
+func openStream(w io.Writer, r io.Reader, h *streamHeader, raw []byte, ccm aesccm.CCM, adata []byte) error {
+	ad := append(raw[:len(raw):len(raw)], adata...)
+	segment := 1<<h.segmentLog + h.tagSize
+	buf := make([]byte, segment+1)
+	out := make([]byte, 0, segment)
+	nonce := make([]byte, h.nonceSize)
+	copy(nonce, h.prefix)
+	n, err := io.ReadFull(r, buf)
+	for i := uint64(0); ; i++ {
+		if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+			return err
+		}
+		if i > 0xffffffff {
+			return errStreamTooLong
+		}
+		last := n <= segment
+		segmentNonce(nonce, len(h.prefix), uint32(i), last)
+		out, err = ccm.Open(out[:0], nonce, buf[:min(n, segment)], ad)
+		if err != nil {
+			return fmt.Errorf("aesccm: segment %d: %w", i, err)
+		}
+		if _, err := w.Write(out); err != nil {
+			return err
+		}
+		if last {
+			return nil
+		}
+		buf[0] = buf[segment]
+		n, err = io.ReadFull(r, buf[1:])
+		n++
+	}
+}
+
+func segmentNonce(nonce []byte, p int, i uint32, last bool) {
+	binary.BigEndian.PutUint32(nonce[p:], i)
+	nonce[p+4] = 0
+	if last {
+		nonce[p+4] = 1
+	}
+}
+
+/* vim: set noai ts=4 sw=4: */
@@ -0,0 +1,265 @@
+package main
+
+// ACVP test vector sets and responses for ACVP-AES-CCM, and running the tests.
+//
+// In ACVP the ciphertext of CCM is the ciphertext followed by the tag, and all
+// lengths are in bits.  A decryption test is answered with the plaintext, or with
+// "testPassed": false when the tag does not verify.
+//
+// MIT Licensed
+
+import (
+	"bytes"
+	"crypto/aes"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/pschlump/AesCCM"
+)
+
+const acvAlgorithm = "ACVP-AES-CCM"
+const acvRevision = "1.0"
+const acvVersion = "1.0" // written around the response to a CAVP file
+
+var errAlgorithm = errors.New("ccmvectors: not an " + acvAlgorithm + " vector set")
+var errNoVectorSet = errors.New("ccmvectors: no vector set in the JSON")
+var errDirection = errors.New("ccmvectors: direction must be encrypt or decrypt")
+
+// hexBytes is binary data written as hex, upper case as the ACVP server does.
+type hexBytes []byte
+
+func (h hexBytes) MarshalText() ([]byte, error) {
+	return []byte(strings.ToUpper(hex.EncodeToString(h))), nil
+}
+
+func (h *hexBytes) UnmarshalText(text []byte) (err error) {
+	*h, err = hex.DecodeString(string(text))
+	return err
+}
+
+type vectorSet struct {
+	VsID       int          `json:"vsId"`
+	Algorithm  string       `json:"algorithm"`
+	Revision   string       `json:"revision"`
+	IsSample   bool         `json:"isSample,omitempty"`
+	TestGroups []*testGroup `json:"testGroups"`
+}
+
+type testGroup struct {
+	TgID       int         `json:"tgId"`
+	TestType   string      `json:"testType"`
+	Direction  string      `json:"direction"`
+	KeyLen     int         `json:"keyLen"`     // bits
+	IvLen      int         `json:"ivLen"`      // bits
+	PayloadLen int         `json:"payloadLen"` // bits
+	AadLen     int         `json:"aadLen"`     // bits
+	TagLen     int         `json:"tagLen"`     // bits
+	Tests      []*testCase `json:"tests"`
+}
+
+type testCase struct {
+	TcID int      `json:"tcId"`
+	Key  hexBytes `json:"key"`
+	IV   hexBytes `json:"iv"`
+	PT   hexBytes `json:"pt,omitempty"` // encrypt
+	CT   hexBytes `json:"ct,omitempty"` // decrypt, ciphertext || tag
+	AAD  hexBytes `json:"aad"`
+
+	want *result // the expected answer, nil if not known
+}
+
+// result is the answer to one test, as it goes in the response.
+type result struct {
+	TcID       int       `json:"tcId"`
+	CT         *hexBytes `json:"ct,omitempty"`
+	PT         *hexBytes `json:"pt,omitempty"`
+	TestPassed *bool     `json:"testPassed,omitempty"`
+}
+
+type responseGroup struct {
+	TgID  int       `json:"tgId"`
+	Tests []*result `json:"tests"`
+}
+
+type responseSet struct {
+	VsID       int              `json:"vsId"`
+	Algorithm  string           `json:"algorithm"`
+	Revision   string           `json:"revision"`
+	IsSample   bool             `json:"isSample,omitempty"`
+	TestGroups []*responseGroup `json:"testGroups"`
+}
+
+// unwrap takes the vector set out of the [{"acvVersion": ...}, {...}] array
+// the ACVP server sends, and returns it with the version.  A bare vector set is
+// returned as it is.
+func unwrap(data []byte) (body []byte, version string, err error) {
+	data = bytes.TrimSpace(data)
+	if len(data) > 0 && data[0] == '{' {
+		return data, "", nil
+	}
+	var parts []json.RawMessage
+	if err := json.Unmarshal(data, &parts); err != nil {
+		return nil, "", fmt.Errorf("ccmvectors: %w", err)
+	}
+	for _, p := range parts {
+		var head struct {
+			AcvVersion string `json:"acvVersion"`
+			VsID       *int   `json:"vsId"`
+		}
+		if err := json.Unmarshal(p, &head); err != nil {
+			return nil, "", fmt.Errorf("ccmvectors: %w", err)
+		}
+		if head.AcvVersion != "" {
+			version = head.AcvVersion
+		} else if head.VsID != nil {
+			body = p
+		}
+	}
+	if body == nil {
+		return nil, "", errNoVectorSet
+	}
+	return body, version, nil
+}
+
+// readACVP reads an ACVP-AES-CCM vector set.
+func readACVP(data []byte) (*vectorSet, string, error) {
+	body, version, err := unwrap(data)
+	if err != nil {
+		return nil, "", err
+	}
+	vs := &vectorSet{}
+	if err := json.Unmarshal(body, vs); err != nil {
+		return nil, "", fmt.Errorf("ccmvectors: %w", err)
+	}
+	if vs.Algorithm != acvAlgorithm {
+		return nil, "", errAlgorithm
+	}
+	return vs, version, nil
+}
+
+// loadExpected attaches the answers in an ACVP expected results file to the tests.
+func (vs *vectorSet) loadExpected(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	body, _, err := unwrap(data)
+	if err != nil {
+		return err
+	}
+	var exp responseSet
+	if err := json.Unmarshal(body, &exp); err != nil {
+		return fmt.Errorf("ccmvectors: %s: %w", path, err)
+	}
+	if exp.VsID != vs.VsID {
+		return fmt.Errorf("ccmvectors: %s is for vsId %d, not %d", path, exp.VsID, vs.VsID)
+	}
+	answers := map[[2]int]*result{}
+	for _, g := range exp.TestGroups {
+		for _, r := range g.Tests {
+			answers[[2]int{g.TgID, r.TcID}] = r
+		}
+	}
+	for _, g := range vs.TestGroups {
+		for _, tc := range g.Tests {
+			tc.want = answers[[2]int{g.TgID, tc.TcID}]
+		}
+	}
+	return nil
+}
+
+// answer runs every test and returns the response.  fail is called for each
+// test that cannot be run or whose answer is not the expected one.
+func (vs *vectorSet) answer(fail func(g *testGroup, tc *testCase, msg string)) *responseSet {
+	resp := &responseSet{VsID: vs.VsID, Algorithm: vs.Algorithm, Revision: vs.Revision, IsSample: vs.IsSample}
+	for _, g := range vs.TestGroups {
+		rg := &responseGroup{TgID: g.TgID, Tests: []*result{}}
+		for _, tc := range g.Tests {
+			r, err := g.run(tc)
+			if err != nil {
+				fail(g, tc, err.Error())
+				continue
+			}
+			rg.Tests = append(rg.Tests, r)
+			if tc.want != nil && !r.equal(tc.want) {
+				fail(g, tc, fmt.Sprintf("got %s, expected %s", r, tc.want))
+			}
+		}
+		resp.TestGroups = append(resp.TestGroups, rg)
+	}
+	return resp
+}
+
+// run answers one test.
+func (g *testGroup) run(tc *testCase) (*result, error) {
+	blk, err := aes.NewCipher(tc.Key)
+	if err != nil {
+		return nil, err
+	}
+	ccm, err := aesccm.NewCCM(blk, g.TagLen/8, len(tc.IV))
+	if err != nil {
+		return nil, err
+	}
+	r := &result{TcID: tc.TcID}
+	switch g.Direction {
+	case "encrypt":
+		ct := hexBytes(ccm.Seal(nil, tc.IV, tc.PT, tc.AAD))
+		if ct == nil {
+			return nil, aesccm.ErrSealFailed
+		}
+		r.CT = &ct
+	case "decrypt":
+		if pt, err := ccm.Open(nil, tc.IV, tc.CT, tc.AAD); err == nil {
+			hpt := hexBytes(pt)
+			r.PT = &hpt
+		} else {
+			passed := false
+			r.TestPassed = &passed
+		}
+	default:
+		return nil, errDirection
+	}
+	return r, nil
+}
+
+func (r *result) equal(s *result) bool {
+	passed := func(p *bool) bool { return p == nil || *p }
+	hexEqual := func(a, b *hexBytes) bool {
+		return (a == nil) == (b == nil) && (a == nil || bytes.Equal(*a, *b))
+	}
+	return passed(r.TestPassed) == passed(s.TestPassed) && hexEqual(r.CT, s.CT) && hexEqual(r.PT, s.PT)
+}
+
+func (r *result) String() string {
+	switch {
+	case r.TestPassed != nil && !*r.TestPassed:
+		return "testPassed false"
+	case r.CT != nil:
+		return fmt.Sprintf("ct %X", []byte(*r.CT))
+	case r.PT != nil:
+		return fmt.Sprintf("pt %X", []byte(*r.PT))
+	}
+	return "nothing"
+}
+
+// writeResponse writes resp as JSON, wrapped in the array with the ACVP version
+// if there is one.
+func writeResponse(w io.Writer, resp *responseSet, version string) error {
+	var v interface{} = resp
+	if version != "" {
+		v = []interface{}{map[string]string{"acvVersion": version}, resp}
+	}
+	b, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(append(b, '\n'))
+	return err
+}
+
+/* vim: set noai ts=4 sw=4: */
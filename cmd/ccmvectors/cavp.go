@@ -0,0 +1,211 @@
+package main
+
+// Reading CAVP .rsp files for CCM.
+//
+// A .rsp file is "Name = value" lines.  Lengths in bytes (Alen, Plen, Nlen,
+// Tlen) are set at the top of the file or in [Name = n, ...] section lines;
+// Key and Nonce are set for a section or given in each test.  A test starts at
+// "Count" and runs to the next blank line:
+//
+//	Count = 0			encryption (VADT, VNT, VPT, VTT)
+//	Adata = ...
+//	Payload = ...
+//	CT = ...			ciphertext || tag
+//
+//	Count = 0			decryption (DVPT)
+//	Nonce = ...
+//	Adata = ...
+//	CT = ...
+//	Result = Pass		or Fail, with no Payload
+//	Payload = ...
+//
+// Some files follow Pass or Fail with a note, "Result = Pass (0)" or
+// "Result = Fail (3 - Tag changed)"; only the first word counts.
+//
+// Empty data is written "00", so Adata and Payload are cut to Alen and Plen.
+//
+// MIT Licensed
+
+import (
+	"bufio"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// readRSP reads a CAVP .rsp file into a vector set, with the answers the file
+// gives attached to the tests.
+func readRSP(r io.Reader) (*vectorSet, error) {
+	vs := &vectorSet{Algorithm: acvAlgorithm, Revision: acvRevision}
+	lengths := map[string]int{}    // Alen, Plen, Nlen, Tlen
+	section := map[string]string{} // Key, Nonce
+	var test map[string]string     // the test being read, nil between tests
+	tcID, lineNo := 0, 0
+
+	finish := func() error {
+		if test == nil {
+			return nil
+		}
+		tcID++
+		err := vs.addRSPTest(tcID, lengths, section, test)
+		test = nil
+		if err != nil {
+			return fmt.Errorf("ccmvectors: test ending at line %d: %w", lineNo, err)
+		}
+		return nil
+	}
+
+	s := bufio.NewScanner(r)
+	s.Buffer(nil, 1<<20)
+	for s.Scan() {
+		lineNo++
+		line := strings.TrimSpace(s.Text())
+		switch {
+		case line == "":
+			if err := finish(); err != nil {
+				return nil, err
+			}
+		case line[0] == '#':
+		case line[0] == '[':
+			if err := finish(); err != nil {
+				return nil, err
+			}
+			for _, f := range strings.Split(strings.Trim(line, "[]"), ",") {
+				name, value, _ := strings.Cut(f, "=")
+				n, err := strconv.Atoi(strings.TrimSpace(value))
+				if err != nil {
+					return nil, fmt.Errorf("ccmvectors: line %d: bad section: %q", lineNo, line)
+				}
+				lengths[strings.TrimSpace(name)] = n
+			}
+		default:
+			name, value, ok := strings.Cut(line, "=")
+			if !ok {
+				return nil, fmt.Errorf("ccmvectors: line %d: not a name = value line: %q", lineNo, line)
+			}
+			name, value = strings.TrimSpace(name), strings.TrimSpace(value)
+			switch {
+			case name == "Count":
+				if err := finish(); err != nil {
+					return nil, err
+				}
+				test = map[string]string{}
+			case test != nil:
+				test[name] = value
+			case strings.HasSuffix(name, "len"):
+				n, err := strconv.Atoi(value)
+				if err != nil {
+					return nil, fmt.Errorf("ccmvectors: line %d: bad length: %q", lineNo, line)
+				}
+				lengths[name] = n
+			default:
+				section[name] = value
+			}
+		}
+	}
+	if err := s.Err(); err != nil {
+		return nil, err
+	}
+	if err := finish(); err != nil {
+		return nil, err
+	}
+	if tcID == 0 {
+		return nil, errNotRecognized
+	}
+	return vs, nil
+}
+
+// addRSPTest turns one test of a .rsp file into a test case, in a new test group
+// if it does not fit the last one.
+func (vs *vectorSet) addRSPTest(tcID int, lengths map[string]int, section, test map[string]string) error {
+	field := func(name string, length string) (hexBytes, error) {
+		value, ok := test[name]
+		if !ok {
+			value, ok = section[name]
+		}
+		if !ok {
+			return nil, fmt.Errorf("no %s", name)
+		}
+		b, err := hex.DecodeString(value)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", name, err)
+		}
+		if n, ok := lengths[length]; ok && n < len(b) {
+			b = b[:n]
+		}
+		return b, nil
+	}
+
+	tc := &testCase{TcID: tcID}
+	var err error
+	if tc.Key, err = field("Key", ""); err != nil {
+		return err
+	}
+	if tc.IV, err = field("Nonce", ""); err != nil {
+		return err
+	}
+	if tc.AAD, err = field("Adata", "Alen"); err != nil {
+		return err
+	}
+	tagLen, ok := lengths["Tlen"]
+	if !ok {
+		return errors.New("no Tlen")
+	}
+
+	direction, plen := "encrypt", 0
+	tc.want = &result{TcID: tcID}
+	if res, ok := test["Result"]; ok {
+		direction = "decrypt"
+		if tc.CT, err = field("CT", ""); err != nil {
+			return err
+		}
+		plen = len(tc.CT) - tagLen
+		verdict, _, _ := strings.Cut(res, " ")
+		switch verdict {
+		case "Pass":
+			pt, err := field("Payload", "Plen")
+			if err != nil {
+				return err
+			}
+			tc.want.PT = &pt
+		case "Fail":
+			passed := false
+			tc.want.TestPassed = &passed
+		default:
+			return fmt.Errorf("result %q is not Pass or Fail", res)
+		}
+	} else {
+		if tc.PT, err = field("Payload", "Plen"); err != nil {
+			return err
+		}
+		ct, err := field("CT", "")
+		if err != nil {
+			return err
+		}
+		tc.want.CT = &ct
+		plen = len(tc.PT)
+	}
+
+	g := &testGroup{TestType: "AFT", Direction: direction, KeyLen: 8 * len(tc.Key), IvLen: 8 * len(tc.IV),
+		PayloadLen: 8 * plen, AadLen: 8 * len(tc.AAD), TagLen: 8 * tagLen}
+	if n := len(vs.TestGroups); n > 0 {
+		if last := vs.TestGroups[n-1]; last.sameParams(g) {
+			last.Tests = append(last.Tests, tc)
+			return nil
+		}
+	}
+	g.TgID = len(vs.TestGroups) + 1
+	g.Tests = []*testCase{tc}
+	vs.TestGroups = append(vs.TestGroups, g)
+	return nil
+}
+
+func (g *testGroup) sameParams(h *testGroup) bool {
+	return g.Direction == h.Direction && g.KeyLen == h.KeyLen && g.IvLen == h.IvLen &&
+		g.PayloadLen == h.PayloadLen && g.AadLen == h.AadLen && g.TagLen == h.TagLen
+}
+
+/* vim: set noai ts=4 sw=4: */
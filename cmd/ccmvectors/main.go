@@ -0,0 +1,140 @@
+// Command ccmvectors runs AES-CCM test vectors through this package and writes
+// the answers as an ACVP response, ready to submit for algorithm validation.
+//
+// Usage:
+//
+//	ccmvectors [-o response.json] [-expected file] [file]
+//
+// The input, file or stdin, is either of:
+//
+//	ACVP	the JSON test vector set for ACVP-AES-CCM from the ACVP server,
+//			with or without the [{"acvVersion": ...}, {...}] wrapper
+//	CAVP	a .rsp file for CCM (VADT, VNT, VPT, VTT or DVPT) from the older
+//			CAVP program
+//
+// A CAVP file carries its own answers; every result is checked against them.
+// For ACVP the answers come from the server, or with a sample vector set from
+// the expected results file given with -expected.  Mismatches are listed on
+// stderr and the exit status is 1.
+//
+// CAVP files have no vsId or tgId.  The response gives them vsId 0 and numbers a
+// new test group each time the direction or one of the lengths changes; tcId
+// counts the tests from 1 through the file.
+//
+// MIT Licensed
+//
+
+package main
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+)
+
+var errUsage = errors.New("ccmvectors: bad usage")
+var errNotRecognized = errors.New("ccmvectors: input is neither ACVP JSON nor a CAVP .rsp file")
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdin, os.Stdout, os.Stderr))
+}
+
+// run is main without the exit, so tests can call it.
+func run(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	var output, expected string
+	fs := flag.NewFlagSet("ccmvectors", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	fs.StringVar(&output, "o", "", "response file, stdout by default")
+	fs.StringVar(&expected, "expected", "", "ACVP expected results file to check the answers against")
+	if err := fs.Parse(args); err == flag.ErrHelp {
+		return 0
+	} else if err != nil {
+		return 2
+	}
+	if fs.NArg() > 1 {
+		fmt.Fprintln(stderr, "ccmvectors: too many arguments")
+		fs.Usage()
+		return 2
+	}
+
+	n, checked, failed, err := runVectors(fs.Arg(0), output, expected, stdin, stdout, stderr)
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		if err == errUsage {
+			return 2
+		}
+		return 1
+	}
+	fmt.Fprintf(stderr, "ccmvectors: %d tests, %d checked, %d failed\n", n, checked, failed)
+	if failed > 0 {
+		return 1
+	}
+	return 0
+}
+
+// runVectors reads the vectors from input, answers them and writes the response.
+// It returns the number of tests, of those with an expected answer, and of
+// failures: tests whose answer differs from the expected one, or that could not
+// be run at all.
+func runVectors(input, output, expected string, stdin io.Reader, stdout, stderr io.Writer) (n, checked, failed int, err error) {
+	var data []byte
+	if input == "" || input == "-" {
+		data, err = io.ReadAll(stdin)
+	} else {
+		data, err = os.ReadFile(input)
+	}
+	if err != nil {
+		return 0, 0, 0, err
+	}
+
+	var vs *vectorSet
+	var version string
+	switch text := bytes.TrimSpace(data); {
+	case len(text) == 0:
+		return 0, 0, 0, errNotRecognized
+	case text[0] == '[' || text[0] == '{':
+		vs, version, err = readACVP(text)
+	default:
+		vs, err = readRSP(bytes.NewReader(text))
+		version = acvVersion
+	}
+	if err != nil {
+		return 0, 0, 0, err
+	}
+	if expected != "" {
+		if err := vs.loadExpected(expected); err != nil {
+			return 0, 0, 0, err
+		}
+	}
+
+	resp := vs.answer(func(g *testGroup, tc *testCase, msg string) {
+		fmt.Fprintf(stderr, "tgId %d tcId %d: %s\n", g.TgID, tc.TcID, msg)
+		failed++
+	})
+	for _, g := range vs.TestGroups {
+		for _, tc := range g.Tests {
+			n++
+			if tc.want != nil {
+				checked++
+			}
+		}
+	}
+
+	if output == "" || output == "-" {
+		return n, checked, failed, writeResponse(stdout, resp, version)
+	}
+	f, err := os.Create(output)
+	if err != nil {
+		return n, checked, failed, err
+	}
+	err = writeResponse(f, resp, version)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	return n, checked, failed, err
+}
+
+/* vim: set noai ts=4 sw=4: */
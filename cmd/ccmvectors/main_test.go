@@ -0,0 +1,86 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+var update = flag.Bool("update", false, "rewrite the golden files in testdata")
+
+// The vectors in testdata are laid out as the CAVP and ACVP files are, with
+// values computed with OpenSSL; VADT128.rsp Count 2 is the first example of
+// NIST SP 800-38C Appendix C.  DVPT128-annotated.rsp has all three Appendix C
+// examples, with "Result = Pass (0)" style annotations.
+func TestGolden(t *testing.T) {
+	var testData = []struct {
+		name string
+		args []string
+	}{
+		{name: "cavp-vadt", args: []string{"testdata/VADT128.rsp"}},
+		{name: "cavp-dvpt", args: []string{"testdata/DVPT256.rsp"}},
+		{name: "cavp-dvpt-annotated", args: []string{"testdata/DVPT128-annotated.rsp"}},
+		{name: "acvp", args: []string{"-expected", "testdata/acvp-expected.json", "testdata/acvp-prompt.json"}},
+		{name: "acvp-no-expected", args: []string{"testdata/acvp-prompt.json"}},
+		{name: "acvp-wrong-expected", args: []string{"-expected", "testdata/acvp-wrong.json", "testdata/acvp-prompt.json"}},
+		{name: "not-recognized", args: []string{"testdata/not-vectors.txt"}},
+		{name: "too-many-args", args: []string{"a", "b"}},
+	}
+
+	for _, vv := range testData {
+		t.Run(vv.name, func(t *testing.T) {
+			var stdout, stderr bytes.Buffer
+			code := run(vv.args, strings.NewReader(""), &stdout, &stderr)
+			got := fmt.Sprintf("exit %d\n--- stdout\n%s--- stderr\n%s", code, stdout.String(), stderr.String())
+
+			golden := filepath.Join("testdata", vv.name+".golden")
+			if *update {
+				if err := os.WriteFile(golden, []byte(got), 0644); err != nil {
+					t.Fatal(err)
+				}
+				return
+			}
+			expect, err := os.ReadFile(golden)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != string(expect) {
+				t.Errorf("got\n%s\nexpected\n%s", got, expect)
+			}
+		})
+	}
+}
+
+// A wrong answer in a .rsp file is reported against the test it belongs to.
+func TestRSPMismatch(t *testing.T) {
+	data, err := os.ReadFile("testdata/VADT128.rsp")
+	if err != nil {
+		t.Fatal(err)
+	}
+	data = bytes.Replace(data, []byte("CT = 7162015b4dac255d"), []byte("CT = 7162015b4dac255e"), 1)
+	var stdout, stderr bytes.Buffer
+	code := run(nil, bytes.NewReader(data), &stdout, &stderr)
+	if code != 1 || !strings.HasPrefix(stderr.String(), "tgId 2 tcId 3: got ct 7162015B4DAC255D, expected ct 7162015B4DAC255E\n") {
+		t.Errorf("exit %d, %s", code, stderr.String())
+	}
+}
+
+// Anything but Pass or Fail in front of the note is an error.
+func TestRSPResult(t *testing.T) {
+	data, err := os.ReadFile("testdata/DVPT128-annotated.rsp")
+	if err != nil {
+		t.Fatal(err)
+	}
+	data = bytes.Replace(data, []byte("Result = Pass (0)"), []byte("Result = Passed (0)"), 1)
+	var stdout, stderr bytes.Buffer
+	code := run(nil, bytes.NewReader(data), &stdout, &stderr)
+	if code == 0 || !strings.Contains(stderr.String(), `result "Passed (0)" is not Pass or Fail`) {
+		t.Errorf("exit %d, %s", code, stderr.String())
+	}
+}
+
+/* vim: set noai ts=4 sw=4: */
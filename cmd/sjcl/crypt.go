@@ -0,0 +1,105 @@
+package main
+
+// The decrypt and encrypt commands.
+//
+// MIT Licensed
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/pschlump/AesCCM/kdf"
+	"github.com/pschlump/AesCCM/sjcl"
+)
+
+var errKeySize = errors.New("sjcl: -ks must be 128, 192 or 256")
+var errTagSize = errors.New("sjcl: -ts must be 32 to 128 in steps of 16")
+var errIter = errors.New("sjcl: -iter must be at least 1")
+
+// readBlob reads one JSON object from the input.
+func readBlob(o *options) (eBlob sjcl.SJCL_DataStruct, err error) {
+	in, err := o.openInput()
+	if err != nil {
+		return eBlob, err
+	}
+	defer in.Close()
+	if err := json.NewDecoder(in).Decode(&eBlob); err != nil {
+		return eBlob, fmt.Errorf("sjcl: reading JSON: %w", err)
+	}
+	return eBlob, nil
+}
+
+func decrypt(o *options) error {
+	eBlob, err := readBlob(o)
+	if err != nil {
+		return err
+	}
+	password, err := o.password(false)
+	if err != nil {
+		return err
+	}
+	defer zero(password)
+	pt, err := sjcl.Decrypt(password, eBlob)
+	if err != nil {
+		return err
+	}
+	defer zero(pt)
+
+	f, err := o.createOutput()
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(pt)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+func encrypt(o *options) error {
+	if o.keySize != 128 && o.keySize != 192 && o.keySize != 256 {
+		return errKeySize
+	}
+	if o.tagSize < 32 || o.tagSize > 128 || o.tagSize%16 != 0 {
+		return errTagSize
+	}
+	if o.iter < 1 {
+		return errIter
+	}
+	in, err := o.openInput()
+	if err != nil {
+		return err
+	}
+	pt, err := io.ReadAll(in)
+	in.Close()
+	if err != nil {
+		return err
+	}
+	password, err := o.password(true)
+	if err != nil {
+		return err
+	}
+	defer zero(password)
+
+	eBlob, err := sjcl.Encrypt(password, pt, []byte(o.adata), kdf.Params{Iter: o.iter}, o.keySize, o.tagSize)
+	if err != nil {
+		return err
+	}
+	b, err := eBlob.MarshalSJCL()
+	if err != nil {
+		return err
+	}
+	f, err := o.createOutput()
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(append(b, '\n'))
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+/* vim: set noai ts=4 sw=4: */
@@ -0,0 +1,100 @@
+package main
+
+// The dump command - prints the fields of SJCL JSON the way the SJCL demo page
+// and the JavaScript console show them.
+//
+// SJCL keeps binary data as a bitArray, an array of 32 bit words.  Bitwise
+// operators in JavaScript give signed results, so the console shows the words as
+// signed numbers.  Each field is printed as
+//
+//	Base64
+//	Int32Array		the words, signed
+//	Uint32Array		the words in hex
+//	bitArray		the signed words with the length of a short last word added
+//					in, as sjcl.codec.base64.toBits gives them (see
+//					base64data.ToBitArray)
+//
+// MIT Licensed
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/pschlump/AesCCM/base64data"
+	"github.com/pschlump/AesCCM/kdf"
+	"github.com/pschlump/AesCCM/sjcl"
+)
+
+func dump(o *options) error {
+	eBlob, err := readBlob(o)
+	if err != nil {
+		return err
+	}
+	w := o.stdout
+	field := func(name, format string, a ...interface{}) {
+		if name != "" {
+			name += ":"
+		}
+		fmt.Fprintf(w, "%-8s %s\n", name, fmt.Sprintf(format, a...))
+	}
+	bits := func(name string, b base64data.Base64Data, note string) {
+		field(name, "%s (%d bytes%s)", b.ConvToString(), len(b), note)
+		field("", "%s", int32Words(b.Int32Array()))
+		field("", "%s", uint32Words(b.Uint32Array()))
+		field("", "%s", b.BitArrayString())
+	}
+
+	field("v", "%d", eBlob.Version)
+	field("iter", "%d", eBlob.Iter)
+	if eBlob.KDF != "" {
+		p := eBlob.KDFParams()
+		field("kdf", "%s, m %d, n %d, r %d, p %d", p.Name, p.Memory, p.N, p.R, p.P)
+	}
+	field("ks", "%d", eBlob.KeySize)
+	field("ts", "%d", eBlob.TagSize)
+	field("mode", "%s", eBlob.Mode)
+	field("cipher", "%s", eBlob.Cipher)
+	bits("iv", eBlob.InitilizationVector, "")
+	eBlob.TagSizeBytes = eBlob.TagSize / 8
+	if nonce, nlen := sjcl.GetNonce(eBlob); nlen > 0 {
+		bits("nonce", nonce, ", the front of iv that CCM uses at this length")
+	}
+	bits("salt", eBlob.Salt, "")
+	bits("adata", eBlob.AdditionalData, fmt.Sprintf(", %q", []byte(eBlob.AdditionalData)))
+	bits("ct", eBlob.CipherText, fmt.Sprintf(", the last %d are the tag", eBlob.TagSizeBytes))
+
+	if o.passFile == "" {
+		return nil
+	}
+	password, err := readPassFile(o.passFile)
+	if err != nil {
+		return err
+	}
+	defer zero(password)
+	key, err := kdf.DeriveKey(eBlob.KDFParams(), password, eBlob.Salt, eBlob.KeySize/8)
+	if err != nil {
+		return err
+	}
+	defer zero(key)
+	bits("key", key, "")
+	return nil
+}
+
+// int32Words formats words as the JavaScript console prints an array.
+func int32Words(a []int32) string {
+	s := make([]string, len(a))
+	for i, v := range a {
+		s[i] = fmt.Sprint(v)
+	}
+	return "[" + strings.Join(s, ", ") + "]"
+}
+
+func uint32Words(a []uint32) string {
+	s := make([]string, len(a))
+	for i, v := range a {
+		s[i] = fmt.Sprintf("0x%08x", v)
+	}
+	return "[" + strings.Join(s, ", ") + "]"
+}
+
+/* vim: set noai ts=4 sw=4: */
@@ -0,0 +1,215 @@
+// Command sjcl decrypts, encrypts and takes apart the JSON that the Stanford
+// JavaScript Crypto Library's sjcl.encrypt() makes, as on the SJCL demo page.
+//
+// Usage:
+//
+//	sjcl decrypt [flags] [file]	decrypt a JSON blob from file (or stdin)
+//	sjcl encrypt [flags] [file]	encrypt file (or stdin) to a JSON blob
+//	sjcl dump [flags] [file]	print the fields of a JSON blob
+//
+// The password is asked for on the terminal, without echo, unless -passfile
+// names a file whose first line is the password.  encrypt writes exactly the
+// fields sjcl.encrypt() writes, in the same order, with -iter, -ks and -ts as
+// the parameters of the same name (PBKDF2-HMAC-SHA256, AES-CCM).
+//
+// dump prints each binary field as SJCL holds it, a bitArray of 32 bit words,
+// signed as the JavaScript console shows them and as hex, along with the nonce
+// CCM actually uses.  Given -passfile it also prints the derived key.  This is
+// for finding out why a blob from a browser will not decrypt.
+//
+// MIT Licensed
+//
+
+package main
+
+import (
+	"bufio"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+var errUsage = errors.New("sjcl: bad usage")
+var errNoTerminal = errors.New("sjcl: no terminal to ask for the password on, use -passfile")
+var errMismatch = errors.New("sjcl: passwords do not match")
+var errEmptyPassword = errors.New("sjcl: empty password")
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdin, os.Stdout, os.Stderr))
+}
+
+const usage = `usage: sjcl <command> [flags] [file]
+
+commands:
+  decrypt   decrypt SJCL JSON from file or stdin
+  encrypt   encrypt file or stdin to SJCL JSON
+  dump      print the fields of SJCL JSON
+
+Run sjcl <command> -h for the flags of a command.
+`
+
+// askPassword reads a password from the user; tests replace it.
+var askPassword = readPassword
+
+// run is main without the exit, so tests can call it.
+func run(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	if len(args) == 0 {
+		fmt.Fprint(stderr, usage)
+		return 2
+	}
+	var cmd func(*options) error
+	switch args[0] {
+	case "decrypt":
+		cmd = decrypt
+	case "encrypt":
+		cmd = encrypt
+	case "dump":
+		cmd = dump
+	case "help", "-h", "-help", "--help":
+		fmt.Fprint(stdout, usage)
+		return 0
+	default:
+		fmt.Fprintf(stderr, "sjcl: unknown command %q\n%s", args[0], usage)
+		return 2
+	}
+
+	o, err := parseFlags(args[0], args[1:], stderr)
+	if err == flag.ErrHelp {
+		return 0
+	} else if err != nil {
+		return 2
+	}
+	o.stdin, o.stdout = stdin, stdout
+	if err := cmd(o); err != nil {
+		fmt.Fprintln(stderr, err)
+		if err == errUsage {
+			return 2
+		}
+		return 1
+	}
+	return 0
+}
+
+// options are the flags of every command; each command registers the ones it uses.
+type options struct {
+	passFile string //
+	adata    string //
+	iter     int    //
+	keySize  int    // bits
+	tagSize  int    // bits
+	output   string //
+	input    string // "" or "-" for stdin
+
+	stdin  io.Reader
+	stdout io.Writer
+}
+
+func parseFlags(cmd string, args []string, stderr io.Writer) (*options, error) {
+	o := &options{}
+	fs := flag.NewFlagSet("sjcl "+cmd, flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	switch cmd {
+	case "decrypt":
+		fs.StringVar(&o.passFile, "passfile", "", "file whose first line is the password, asked for if not given")
+		fs.StringVar(&o.output, "o", "", "output file, stdout by default")
+	case "encrypt":
+		fs.StringVar(&o.passFile, "passfile", "", "file whose first line is the password, asked for if not given")
+		fs.StringVar(&o.adata, "adata", "", "additional authenticated data")
+		fs.IntVar(&o.iter, "iter", 10000, "PBKDF2 iterations")
+		fs.IntVar(&o.keySize, "ks", 128, "key size in bits: 128, 192 or 256")
+		fs.IntVar(&o.tagSize, "ts", 64, "tag size in bits: 32 to 128 in steps of 16")
+		fs.StringVar(&o.output, "o", "", "output file, stdout by default")
+	case "dump":
+		fs.StringVar(&o.passFile, "passfile", "", "file whose first line is the password, to print the derived key")
+	}
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+	switch fs.NArg() {
+	case 0:
+	case 1:
+		o.input = fs.Arg(0)
+	default:
+		fmt.Fprintf(stderr, "sjcl %s: too many arguments\n", cmd)
+		fs.Usage()
+		return nil, errUsage
+	}
+	return o, nil
+}
+
+// openInput returns the input file, or stdin.
+func (o *options) openInput() (io.ReadCloser, error) {
+	if o.input == "" || o.input == "-" {
+		return io.NopCloser(o.stdin), nil
+	}
+	return os.Open(o.input)
+}
+
+// createOutput returns the output file, or stdout.  Files are created 0600, the
+// output of decrypt is secret.
+func (o *options) createOutput() (io.WriteCloser, error) {
+	if o.output == "" || o.output == "-" {
+		return nopWriteCloser{o.stdout}, nil
+	}
+	return os.OpenFile(o.output, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+}
+
+type nopWriteCloser struct {
+	io.Writer
+}
+
+func (nopWriteCloser) Close() error {
+	return nil
+}
+
+// password returns the password from -passfile, or asks for it.  confirm asks
+// twice, for encrypt, where a typing mistake would lose the data.
+func (o *options) password(confirm bool) ([]byte, error) {
+	if o.passFile != "" {
+		return readPassFile(o.passFile)
+	}
+	pw, err := askPassword("Password: ")
+	if err != nil {
+		return nil, err
+	}
+	if len(pw) == 0 {
+		return nil, errEmptyPassword
+	}
+	if confirm {
+		again, err := askPassword("Again: ")
+		defer zero(again)
+		if err != nil {
+			zero(pw)
+			return nil, err
+		}
+		if string(again) != string(pw) {
+			zero(pw)
+			return nil, errMismatch
+		}
+	}
+	return pw, nil
+}
+
+func readPassFile(path string) ([]byte, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	line, err := bufio.NewReader(f).ReadBytes('\n')
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+	return []byte(strings.TrimRight(string(line), "\r\n")), nil
+}
+
+func zero(b []byte) {
+	for i := range b {
+		b[i] = 0
+	}
+}
+
+/* vim: set noai ts=4 sw=4: */
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+var update = flag.Bool("update", false, "rewrite the golden files in testdata")
+
+// sjcl.json is in the form sjcl.encrypt() writes; its password is in pass.txt.
+func TestGolden(t *testing.T) {
+	var testData = []struct {
+		name string
+		args []string
+	}{
+		{name: "usage", args: nil},
+		{name: "unknown-command", args: []string{"frobnicate"}},
+		{name: "decrypt", args: []string{"decrypt", "-passfile", "testdata/pass.txt", "testdata/sjcl.json"}},
+		{name: "decrypt-wrong-password", args: []string{"decrypt", "-passfile", "testdata/plain.txt", "testdata/sjcl.json"}},
+		{name: "decrypt-not-json", args: []string{"decrypt", "-passfile", "testdata/pass.txt", "testdata/plain.txt"}},
+		{name: "dump", args: []string{"dump", "testdata/sjcl.json"}},
+		{name: "dump-key", args: []string{"dump", "-passfile", "testdata/pass.txt", "testdata/sjcl.json"}},
+		{name: "encrypt-bad-ks", args: []string{"encrypt", "-passfile", "testdata/pass.txt", "-ks", "512", "testdata/plain.txt"}},
+		{name: "encrypt-bad-ts", args: []string{"encrypt", "-passfile", "testdata/pass.txt", "-ts", "72", "testdata/plain.txt"}},
+		{name: "encrypt-too-many-args", args: []string{"encrypt", "a", "b"}},
+	}
+
+	for _, vv := range testData {
+		t.Run(vv.name, func(t *testing.T) {
+			var stdout, stderr bytes.Buffer
+			code := run(vv.args, strings.NewReader(""), &stdout, &stderr)
+			got := fmt.Sprintf("exit %d\n--- stdout\n%s--- stderr\n%s", code, stdout.String(), stderr.String())
+
+			golden := filepath.Join("testdata", vv.name+".golden")
+			if *update {
+				if err := os.WriteFile(golden, []byte(got), 0644); err != nil {
+					t.Fatal(err)
+				}
+				return
+			}
+			expect, err := os.ReadFile(golden)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != string(expect) {
+				t.Errorf("got\n%s\nexpected\n%s", got, expect)
+			}
+		})
+	}
+}
+
+// encrypt writes the fields of sjcl.encrypt(), in its order, and decrypt reads
+// them back with the password given at the prompt.
+func TestRoundTrip(t *testing.T) {
+	var asked []string
+	askPassword = func(prompt string) ([]byte, error) {
+		asked = append(asked, prompt)
+		return []byte("correct horse"), nil
+	}
+	defer func() { askPassword = readPassword }()
+
+	var testData = []struct {
+		args []string
+	}{
+		{args: nil},
+		{args: []string{"-iter", "1000", "-ks", "256", "-ts", "128", "-adata", "ad"}},
+	}
+	for ii, vv := range testData {
+		asked = nil
+		var ct, pt, stderr bytes.Buffer
+		if code := run(append([]string{"encrypt"}, vv.args...), strings.NewReader("attack at dawn"), &ct, &stderr); code != 0 {
+			t.Errorf("Test %d: encrypt exit %d: %s", ii, code, stderr.String())
+			continue
+		}
+		if len(asked) != 2 {
+			t.Errorf("Test %d: encrypt asked %q, expected the password and again", ii, asked)
+		}
+		dec := json.NewDecoder(bytes.NewReader(ct.Bytes()))
+		var keys []string
+		if tok, err := dec.Token(); err != nil || tok != json.Delim('{') {
+			t.Fatalf("Test %d: not a JSON object: %s", ii, ct.String())
+		}
+		for dec.More() {
+			tok, _ := dec.Token()
+			keys = append(keys, tok.(string))
+			dec.Token()
+		}
+		if got := strings.Join(keys, ","); got != "iv,v,iter,ks,ts,mode,adata,cipher,salt,ct" {
+			t.Errorf("Test %d: fields %s", ii, got)
+		}
+		if code := run([]string{"decrypt"}, bytes.NewReader(ct.Bytes()), &pt, &stderr); code != 0 || pt.String() != "attack at dawn" {
+			t.Errorf("Test %d: decrypt exit %d, %q: %s", ii, code, pt.String(), stderr.String())
+		}
+	}
+}
+
+func TestPasswordMismatch(t *testing.T) {
+	n := 0
+	askPassword = func(prompt string) ([]byte, error) {
+		n++
+		return []byte(fmt.Sprint("password", n)), nil
+	}
+	defer func() { askPassword = readPassword }()
+
+	var out, stderr bytes.Buffer
+	if code := run([]string{"encrypt"}, strings.NewReader("x"), &out, &stderr); code != 1 || !strings.Contains(stderr.String(), errMismatch.Error()) {
+		t.Errorf("exit %d, %s", code, stderr.String())
+	}
+	if out.Len() != 0 {
+		t.Errorf("output written: %s", out.String())
+	}
+}
+
+/* vim: set noai ts=4 sw=4: */
@@ -0,0 +1,32 @@
+package main
+
+// Asking for the password on the terminal.
+//
+// MIT Licensed
+
+import (
+	"fmt"
+	"os"
+
+	"golang.org/x/term"
+)
+
+// readPassword prompts on the terminal and reads a line with echo turned off.
+// The terminal is opened directly so the JSON can still be piped in on stdin.
+// Where there is no /dev/tty, stdin is used if it is a terminal.
+func readPassword(prompt string) ([]byte, error) {
+	in, out := os.Stdin, os.Stderr
+	if tty, err := os.OpenFile("/dev/tty", os.O_RDWR, 0); err == nil {
+		defer tty.Close()
+		in, out = tty, tty
+	}
+	if !term.IsTerminal(int(in.Fd())) {
+		return nil, errNoTerminal
+	}
+	fmt.Fprint(out, prompt)
+	pw, err := term.ReadPassword(int(in.Fd()))
+	fmt.Fprintln(out)
+	return pw, err
+}
+
+/* vim: set noai ts=4 sw=4: */
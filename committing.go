@@ -0,0 +1,157 @@
+// Key-committing CCM.
+//
+// CCM, like GCM, does not commit to its key: nothing stops a ciphertext from
+// being built that opens under more than one key.  With password derived keys, as
+// in the SJCL flow, that lets a server that reports whether decryption worked be
+// used as a partitioning oracle to test many passwords per guess.
+//
+// NewCommittingCCM derives two values from the key with HMAC-SHA256:
+//
+//	encryption key = first len(key) bytes of HMAC-SHA256(key, "AESCCM commit key")
+//	commitment     = HMAC-SHA256(key, "AESCCM commit" || nonce)
+//
+// and the output of Seal is
+//
+//	commitment (32 bytes) || CCM ciphertext || tag
+//
+// Open checks the commitment before it tries to decrypt.  A second key can only
+// produce the same commitment by finding an HMAC-SHA256 collision.  Putting the
+// nonce into the commitment keeps messages under one key from sharing it.
+//
+// MIT Licensed
+//
+
+package aesccm
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"unsafe"
+)
+
+const CommitmentSize = sha256.Size
+
+var commitKeyLabel = []byte("AESCCM commit key")
+var commitLabel = []byte("AESCCM commit")
+
+type committingCCM struct {
+	ccm *CCMType //
+	key []byte   // master key, the commitment is computed from it
+}
+
+// NewCommittingCCM returns a key-committing AES-CCM.  The key must be 16, 24 or 32
+// bytes.  Overhead is CommitmentSize+TagSize.
+func NewCommittingCCM(key []byte, TagSize int, NonceSize int) (CCM, error) {
+	return newCommittingCCM(key, TagSize, NonceSize, aes.NewCipher)
+}
+
+func newCommittingCCM(key []byte, TagSize int, NonceSize int, newBlock func([]byte) (cipher.Block, error)) (*committingCCM, error) {
+	if len(key) > sha256.Size {
+		return nil, aes.KeySizeError(len(key))
+	}
+	mac := hmac.New(sha256.New, key)
+	mac.Write(commitKeyLabel)
+	blk, err := newBlock(mac.Sum(nil)[:len(key)])
+	if err != nil {
+		return nil, err
+	}
+	ccm, err := newCCMType(blk, TagSize, NonceSize)
+	if err != nil {
+		return nil, err
+	}
+	return &committingCCM{ccm: ccm, key: append([]byte(nil), key...)}, nil
+}
+
+func (c *committingCCM) commitment(nonce []byte) []byte {
+	mac := hmac.New(sha256.New, c.key)
+	mac.Write(commitLabel)
+	mac.Write(nonce)
+	return mac.Sum(nil)
+}
+
+func (c *committingCCM) NonceSize() int {
+	return c.ccm.NonceSize()
+}
+
+func (c *committingCCM) Overhead() int {
+	return CommitmentSize + c.ccm.Overhead()
+}
+
+func (c *committingCCM) MaxLength() int {
+	return c.ccm.MaxLength()
+}
+
+// Seal appends commitment || ciphertext || tag to dst.  Like CCMType.Seal it
+// returns nil if the nonce or plaintext is not acceptable.  To seal in place use
+// plaintext[:0] as dst; dst may not overlap plaintext any other way.
+func (c *committingCCM) Seal(dst, nonce, plaintext, adata []byte) []byte {
+	if ns := c.NonceSize(); len(nonce) > ns {
+		nonce = nonce[:ns]
+	}
+	if len(nonce) != c.NonceSize() {
+		return nil
+	}
+	ret, out := sliceForAppend(dst, len(plaintext)+c.Overhead())
+	if inexactOverlap(out, plaintext) {
+		panic("aesccm: invalid buffer overlap")
+	}
+	if anyOverlap(out, plaintext) {
+		// The commitment goes where the plaintext starts: move the plaintext up
+		// and seal it where it lands.
+		plaintext = out[CommitmentSize : CommitmentSize+copy(out[CommitmentSize:], plaintext)]
+	}
+	if ct := c.ccm.Seal(out[CommitmentSize:CommitmentSize], nonce, plaintext, adata); len(ct) != len(out)-CommitmentSize {
+		return nil
+	}
+	copy(out, c.commitment(nonce))
+	return ret
+}
+
+// Open checks the commitment and then authenticates and decrypts the rest.  A
+// commitment made with a different key gives ErrCommitment.  To open in place use
+// ciphertext[:0] as dst; dst may not overlap ciphertext any other way.
+func (c *committingCCM) Open(dst, nonce, ciphertext, adata []byte) ([]byte, error) {
+	if ns := c.NonceSize(); len(nonce) > ns {
+		nonce = nonce[:ns]
+	}
+	if len(nonce) != c.NonceSize() {
+		return nil, ErrNonceSize
+	}
+	if len(ciphertext) < c.Overhead() {
+		return nil, ErrCiphertextTooShort
+	}
+	_, out := sliceForAppend(dst, len(ciphertext)-c.Overhead())
+	if inexactOverlap(out, ciphertext) {
+		panic("aesccm: invalid buffer overlap")
+	}
+	if subtle.ConstantTimeCompare(ciphertext[:CommitmentSize], c.commitment(nonce)) != 1 {
+		return nil, ErrCommitment
+	}
+	ct := ciphertext[CommitmentSize:]
+	if anyOverlap(out, ciphertext) {
+		// The plaintext starts where the commitment was: move the CCM ciphertext
+		// down so it is opened exactly in place.
+		ct = ciphertext[:copy(ciphertext, ct)]
+	}
+	return c.ccm.Open(dst, nonce, ct, adata)
+}
+
+// anyOverlap and inexactOverlap are crypto/internal/alias: output may share
+// memory with input only when both start at the same place.
+func anyOverlap(x, y []byte) bool {
+	return len(x) > 0 && len(y) > 0 &&
+		uintptr(unsafe.Pointer(&x[0])) <= uintptr(unsafe.Pointer(&y[len(y)-1])) &&
+		uintptr(unsafe.Pointer(&y[0])) <= uintptr(unsafe.Pointer(&x[len(x)-1]))
+}
+
+func inexactOverlap(x, y []byte) bool {
+	if len(x) == 0 || len(y) == 0 || &x[0] == &y[0] {
+		return false
+	}
+	return anyOverlap(x, y)
+}
+
+/* vim: set noai ts=4 sw=4: */
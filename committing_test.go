@@ -0,0 +1,139 @@
+package aesccm
+
+import (
+	"bytes"
+	"crypto/cipher"
+	"crypto/subtle"
+	"testing"
+)
+
+// xorBlock is a "block cipher" that XORs the key into the block.  It makes CCM
+// linear, so a ciphertext that opens under every key is easy to build - the
+// kind of ciphertext a partitioning-oracle attack needs, which for AES takes far
+// more work than a unit test can do.
+type xorBlock []byte
+
+func (k xorBlock) BlockSize() int          { return CcmBlockSize }
+func (k xorBlock) Encrypt(dst, src []byte) { subtle.XORBytes(dst, src, k) }
+func (k xorBlock) Decrypt(dst, src []byte) { subtle.XORBytes(dst, src, k) }
+
+func newXorBlock(key []byte) (cipher.Block, error) {
+	return xorBlock(append(make([]byte, 0, 16), key[:16]...)), nil
+}
+
+func TestCommittingCCM(t *testing.T) {
+	key1 := []byte("0123456789abcdef")
+	key2 := []byte("fedcba9876543210")
+	nonce := []byte("unique nonce")
+	msg, adata := []byte("the password was right"), []byte("adata")
+
+	c1, err := NewCommittingCCM(key1, 16, 12)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c2, _ := NewCommittingCCM(key2, 16, 12)
+
+	ct := c1.Seal(nil, nonce, msg, adata)
+	if len(ct) != CommitmentSize+len(msg)+16 || c1.Overhead() != CommitmentSize+16 {
+		t.Fatalf("Seal: bad length %d", len(ct))
+	}
+	if pt, err := c1.Open(nil, nonce, ct, adata); err != nil || !bytes.Equal(pt, msg) {
+		t.Errorf("Open: got %q %v", pt, err)
+	}
+	if _, err := c2.Open(nil, nonce, ct, adata); err != ErrCommitment {
+		t.Errorf("Open with the wrong key: expected ErrCommitment, got %v", err)
+	}
+	for pos := range ct {
+		ct[pos] ^= 0x80
+		if _, err := c1.Open(nil, nonce, ct, adata); err == nil {
+			t.Errorf("Altered byte %d, Open should have failed", pos)
+		}
+		ct[pos] ^= 0x80
+	}
+	if c1.Seal(nil, nonce[:5], msg, adata) != nil {
+		t.Errorf("Seal with a short nonce should have failed")
+	}
+}
+
+func TestCommittingCCMMultiKey(t *testing.T) {
+	key1 := []byte("0123456789abcdef")
+	key2 := []byte("fedcba9876543210")
+	nonce := make([]byte, 13)
+	msg := []byte("sixteen byte msg")
+
+	// With a linear cipher plain CCM accepts one ciphertext under both keys.
+	blk1, _ := newXorBlock(key1)
+	blk2, _ := newXorBlock(key2)
+	p1, _ := NewCCM(blk1, 16, 13)
+	p2, _ := NewCCM(blk2, 16, 13)
+	ct := p1.Seal(nil, nonce, msg, nil)
+	if _, err := p2.Open(nil, nonce, append([]byte(nil), ct...), nil); err != nil {
+		t.Fatalf("Expected plain CCM with the XOR cipher to accept the ciphertext under both keys: %s", err)
+	}
+
+	// The committing construction over the same cipher does not.  The body opens
+	// under both derived keys, but only one commitment can be attached.
+	c1, _ := newCommittingCCM(key1, 16, 13, newXorBlock)
+	c2, _ := newCommittingCCM(key2, 16, 13, newXorBlock)
+	multi := c1.Seal(nil, nonce, msg, nil)
+	if _, err := c2.ccm.Open(nil, nonce, append([]byte(nil), multi[CommitmentSize:]...), nil); err != nil {
+		t.Fatalf("Expected the CCM body to open under the second derived key: %s", err)
+	}
+	if _, err := c1.Open(nil, nonce, multi, nil); err != nil {
+		t.Errorf("Open with the first key: %s", err)
+	}
+	if _, err := c2.Open(nil, nonce, multi, nil); err != ErrCommitment {
+		t.Errorf("Open with the second key: expected ErrCommitment, got %v", err)
+	}
+	copy(multi, c2.commitment(nonce))
+	if _, err := c1.Open(nil, nonce, multi, nil); err != ErrCommitment {
+		t.Errorf("Open of the spliced commitment with the first key: expected ErrCommitment, got %v", err)
+	}
+}
+
+// Seal(plaintext[:0], ...) and Open(ciphertext[:0], ...) work in place, as
+// cipher.AEAD allows; any other overlap panics.
+func TestCommittingCCMInPlace(t *testing.T) {
+	c, _ := NewCommittingCCM([]byte("0123456789abcdef"), 16, 13)
+	nonce := make([]byte, 13)
+	adata := []byte("adata")
+
+	for _, n := range []int{0, 1, 40, 600} {
+		msg := bytes.Repeat([]byte{'m'}, n)
+		expected := c.Seal(nil, nonce, msg, adata)
+
+		buf := make([]byte, n, n+c.Overhead())
+		copy(buf, msg)
+		ct := c.Seal(buf[:0], nonce, buf, adata)
+		if !bytes.Equal(ct, expected) || &ct[0] != &buf[:1][0] {
+			t.Errorf("Length %d: Seal(plaintext[:0]) got %x, expected %x", n, ct, expected)
+			continue
+		}
+		pt, err := c.Open(ct[:0], nonce, ct, adata)
+		if err != nil || !bytes.Equal(pt, msg) {
+			t.Errorf("Length %d: Open(ciphertext[:0]) got %q %v", n, pt, err)
+		}
+
+		ct = c.Seal(nil, nonce, msg, adata)
+		ct[len(ct)-1] ^= 1
+		if _, err := c.Open(ct[:0], nonce, ct, adata); err != ErrOpenError {
+			t.Errorf("Length %d: Open(ciphertext[:0]) of a bad tag: got %v", n, err)
+		}
+	}
+
+	mustPanic := func(name string, f func()) {
+		defer func() {
+			if recover() == nil {
+				t.Errorf("%s with inexact overlap should have panicked", name)
+			}
+		}()
+		f()
+	}
+	buf := make([]byte, 200)
+	mustPanic("Seal", func() { c.Seal(buf[1:1], nonce, buf[:100], adata) })
+	ct := c.Seal(nil, nonce, buf[:100], adata)
+	buf = append(make([]byte, 1, 1+len(ct)), ct...)
+	mustPanic("Open", func() { c.Open(buf[:0], nonce, buf[1:], adata) })
+}
+
+/* vim: set noai ts=4 sw=4: */
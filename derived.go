@@ -0,0 +1,110 @@
+// Per-message keys derived with HKDF.
+//
+// A CCM nonce is 7 to 13 bytes, so random nonces under one key run into the
+// birthday bound long before a high volume store runs out of records, and counter
+// nonces need coordination between writers.  DerivedKeyCCM sidesteps both: every
+// message gets its own AES key
+//
+//	key = HKDF-SHA256(secret = master key, salt = 32 random bytes, info = "AESCCM derived key")
+//
+// of the same length as the master key, and is sealed under that key with a fixed
+// all zero 7 byte nonce - safe because the key is never used twice.  The salt is
+// carried in front of the output:
+//
+//	salt (32 bytes) || CCM ciphertext || tag
+//
+// Two messages only share a key if their 256 bit salts collide.
+//
+// MIT Licensed
+//
+
+package aesccm
+
+import (
+	"crypto/aes"
+	"crypto/hkdf"
+	"crypto/rand"
+	"crypto/sha256"
+	"io"
+)
+
+const DerivedSaltSize = 32
+const derivedNonceSize = 7 // L = 8, no practical limit on the message length
+
+const derivedKeyInfo = "AESCCM derived key"
+
+var derivedNonce [derivedNonceSize]byte
+
+// DerivedKeyCCM seals each message under a key derived from a master key and a
+// random salt.
+type DerivedKeyCCM struct {
+	master  []byte    //
+	tagSize int       //
+	Rand    io.Reader // source of salts, crypto/rand.Reader by default
+}
+
+// NewDerivedKeyCCM returns a DerivedKeyCCM for a 16, 24 or 32 byte master key.
+func NewDerivedKeyCCM(master []byte, TagSize int) (*DerivedKeyCCM, error) {
+	if _, err := aes.NewCipher(master); err != nil {
+		return nil, err
+	}
+	if TagSize < 4 || TagSize > 16 || TagSize%2 == 1 {
+		return nil, ErrTagSize
+	}
+	return &DerivedKeyCCM{master: append([]byte(nil), master...), tagSize: TagSize, Rand: rand.Reader}, nil
+}
+
+// Overhead returns the salt and tag size together.
+func (d *DerivedKeyCCM) Overhead() int {
+	return DerivedSaltSize + d.tagSize
+}
+
+func (d *DerivedKeyCCM) ccm(salt []byte) (*CCMType, error) {
+	key, err := hkdf.Key(sha256.New, d.master, salt, derivedKeyInfo, len(d.master))
+	if err != nil {
+		return nil, err
+	}
+	defer zero(key)
+	blk, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return newCCMType(blk, d.tagSize, derivedNonceSize)
+}
+
+// Seal picks a salt, encrypts plaintext under the key derived from it and
+// appends salt || ciphertext || tag to dst.
+func (d *DerivedKeyCCM) Seal(dst, plaintext, adata []byte) ([]byte, error) {
+	salt := make([]byte, DerivedSaltSize)
+	if _, err := io.ReadFull(d.Rand, salt); err != nil {
+		return nil, err
+	}
+	ccm, err := d.ccm(salt)
+	if err != nil {
+		return nil, err
+	}
+	n := len(dst)
+	ret, err := ccm.seal(append(dst, salt...), derivedNonce[:], plaintext, adata)
+	if err != nil {
+		return nil, err
+	}
+	if len(ret) != n+len(plaintext)+d.Overhead() {
+		return nil, ErrSealFailed
+	}
+	return ret, nil
+}
+
+// Open derives the key from the salt at the front of ciphertext, then
+// authenticates and decrypts the rest.
+func (d *DerivedKeyCCM) Open(dst, ciphertext, adata []byte) ([]byte, error) {
+	if len(ciphertext) < d.Overhead() {
+		return nil, ErrCiphertextTooShort
+	}
+	ccm, err := d.ccm(ciphertext[:DerivedSaltSize])
+	if err != nil {
+		return nil, err
+	}
+	return ccm.Open(dst, derivedNonce[:], ciphertext[DerivedSaltSize:], adata)
+}
+
+/* vim: set noai ts=4 sw=4: */
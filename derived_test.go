@@ -0,0 +1,60 @@
+package aesccm
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/hkdf"
+	"crypto/sha256"
+	"testing"
+)
+
+func TestDerivedKeyCCM(t *testing.T) {
+	master := bytes.Repeat([]byte{0x5a}, 32)
+	d, err := NewDerivedKeyCCM(master, 16)
+	if err != nil {
+		t.Fatal(err)
+	}
+	d.Rand = bytes.NewReader(bytes.Repeat([]byte{1, 2, 3, 4}, 16)) // two salts
+	msg, adata := []byte("record 1"), []byte("table")
+
+	ct1, err := d.Seal(nil, msg, adata)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ct1) != len(msg)+d.Overhead() || !bytes.Equal(ct1[:DerivedSaltSize], bytes.Repeat([]byte{1, 2, 3, 4}, 8)) {
+		t.Fatalf("Seal: bad output %x", ct1)
+	}
+
+	// The body is CCM under the HKDF key with an all zero 7 byte nonce.
+	key, _ := hkdf.Key(sha256.New, master, ct1[:DerivedSaltSize], "AESCCM derived key", 32)
+	blk, _ := aes.NewCipher(key)
+	ccm, _ := NewCCM(blk, 16, 7)
+	if !bytes.Equal(ct1[DerivedSaltSize:], ccm.Seal(nil, make([]byte, 7), msg, adata)) {
+		t.Errorf("Seal: body does not match CCM under the derived key")
+	}
+
+	pt, err := d.Open(nil, ct1, adata)
+	if err != nil || !bytes.Equal(pt, msg) {
+		t.Errorf("Open: got %q %v", pt, err)
+	}
+	for pos := range ct1 {
+		ct1[pos] ^= 4
+		if _, err := d.Open(nil, ct1, adata); err == nil {
+			t.Errorf("Altered byte %d, Open should have failed", pos)
+		}
+		ct1[pos] ^= 4
+	}
+	if _, err := d.Open(nil, ct1[:d.Overhead()-1], adata); err != ErrCiphertextTooShort {
+		t.Errorf("Short input: expected ErrCiphertextTooShort, got %v", err)
+	}
+
+	d.Seal(nil, msg, adata)
+	if _, err := d.Seal(nil, msg, adata); err == nil {
+		t.Errorf("Seal with the salt source exhausted should have failed")
+	}
+	if _, err := NewDerivedKeyCCM(master[:20], 16); err == nil {
+		t.Errorf("NewDerivedKeyCCM with a 20 byte key should have failed")
+	}
+}
+
+/* vim: set noai ts=4 sw=4: */
@@ -0,0 +1,166 @@
+package dtlsrecord
+
+// DTLS 1.2 record protection with the AES-CCM cipher suites - RFC 6347, RFC 6655
+// and RFC 7251 (TLS_ECDHE_ECDSA_WITH_AES_128_CCM_8, the suite CoAP requires).
+//
+//	Record:  type(1) version(2) epoch(2) sequence_number(6) length(2) fragment
+//	Fragment: nonce_explicit(8) || CCM ciphertext || tag(16 or 8)
+//	Nonce:    client/server_write_IV(4) || nonce_explicit(8)
+//	AAD:      epoch(2) || sequence_number(6) || type(1) || version(2) || plaintext length(2)
+//
+// This package uses epoch||sequence_number as the explicit nonce, as RFC 6655
+// recommends, so a nonce is never repeated under a key.
+//
+// MIT Licensed.
+
+import (
+	"crypto/aes"
+	"encoding/binary"
+
+	"github.com/pschlump/AesCCM"
+)
+
+const HeaderSize12 = 13
+const ExplicitNonceSize = 8
+const SaltSize = 4
+const NonceSize = 12 // both DTLS 1.2 and 1.3 use a 12 byte AEAD nonce
+
+const VersionDTLS12 = 0xfefd
+
+// TLS content types
+const (
+	ContentChangeCipherSpec = 20
+	ContentAlert            = 21
+	ContentHandshake        = 22
+	ContentApplicationData  = 23
+	ContentACK              = 26
+)
+
+// Tag sizes of the two CCM cipher suite families
+const (
+	TagSizeCCM  = 16 // TLS_*_AES_*_CCM
+	TagSizeCCM8 = 8  // TLS_*_AES_*_CCM_8
+)
+
+const seqMask = 1<<48 - 1
+
+// Header12 is a DTLS 1.2 record header.
+type Header12 struct {
+	ContentType uint8
+	Version     uint16
+	Epoch       uint16
+	Seq         uint64 // 48 bit sequence number
+	Length      uint16 // length of the fragment that follows
+}
+
+// Encode appends the 13 byte wire format of the header to dst.
+func (h *Header12) Encode(dst []byte) []byte {
+	dst = append(dst, h.ContentType)
+	dst = binary.BigEndian.AppendUint16(dst, h.Version)
+	dst = binary.BigEndian.AppendUint64(dst, uint64(h.Epoch)<<48|h.Seq&seqMask)
+	return binary.BigEndian.AppendUint16(dst, h.Length)
+}
+
+// ParseHeader12 reads a DTLS 1.2 record header from the front of b.
+func ParseHeader12(b []byte) (h Header12, err error) {
+	if len(b) < HeaderSize12 {
+		return h, ErrShortRecord
+	}
+	h.ContentType = b[0]
+	h.Version = binary.BigEndian.Uint16(b[1:])
+	es := binary.BigEndian.Uint64(b[3:])
+	h.Epoch, h.Seq = uint16(es>>48), es&seqMask
+	h.Length = binary.BigEndian.Uint16(b[11:])
+	return h, nil
+}
+
+// Cipher12 protects records for one direction of a DTLS 1.2 connection.
+type Cipher12 struct {
+	ccm  aesccm.CCM     //
+	salt [SaltSize]byte // the implicit part of the nonce - client/server_write_IV
+}
+
+// NewCipher12 sets up DTLS 1.2 record protection from the write key and the 4 byte
+// write IV of the key block.  tagSize is TagSizeCCM or TagSizeCCM8.
+func NewCipher12(key, writeIV []byte, tagSize int) (*Cipher12, error) {
+	if len(writeIV) != SaltSize {
+		return nil, ErrIVSize
+	}
+	ccm, err := newCCM(key, tagSize)
+	if err != nil {
+		return nil, err
+	}
+	c := &Cipher12{ccm: ccm}
+	copy(c.salt[:], writeIV)
+	return c, nil
+}
+
+func newCCM(key []byte, tagSize int) (aesccm.CCM, error) {
+	if tagSize != TagSizeCCM && tagSize != TagSizeCCM8 {
+		return nil, ErrTagSize
+	}
+	blk, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return aesccm.NewCCM(blk, tagSize, NonceSize)
+}
+
+func aad12(h *Header12, plen int) []byte {
+	aad := make([]byte, 0, 13)
+	aad = binary.BigEndian.AppendUint64(aad, uint64(h.Epoch)<<48|h.Seq&seqMask)
+	aad = append(aad, h.ContentType)
+	aad = binary.BigEndian.AppendUint16(aad, h.Version)
+	return binary.BigEndian.AppendUint16(aad, uint16(plen))
+}
+
+// Seal protects payload and returns the complete record.  The Length field of h
+// is filled in.
+func (c *Cipher12) Seal(h *Header12, payload []byte) ([]byte, error) {
+	if len(payload) > MaxPlaintext {
+		return nil, ErrRecordOverflow
+	}
+	h.Length = uint16(ExplicitNonceSize + len(payload) + c.ccm.Overhead())
+	rec := h.Encode(make([]byte, 0, HeaderSize12+int(h.Length)))
+	explicit := rec[3 : HeaderSize12-2] // epoch || sequence_number
+	rec = append(rec, explicit...)
+
+	nonce := append(c.salt[:], explicit...)
+	n := len(rec)
+	rec = c.ccm.Seal(rec, nonce, payload, aad12(h, len(payload)))
+	if len(rec) != n+len(payload)+c.ccm.Overhead() {
+		return nil, ErrSealFailed
+	}
+	return rec, nil
+}
+
+// Open authenticates and decrypts the record at the front of b.  It returns the
+// header, the plaintext and the number of bytes of b the record used.  Open does
+// not check for replays - pass h.Seq to the ReplayWindow for h.Epoch once Open
+// succeeds.
+func (c *Cipher12) Open(b []byte) (h Header12, payload []byte, n int, err error) {
+	if h, err = ParseHeader12(b); err != nil {
+		return
+	}
+	n = HeaderSize12 + int(h.Length)
+	if len(b) < n {
+		return h, nil, 0, ErrShortRecord
+	}
+	frag := b[HeaderSize12:n]
+	if len(frag) < ExplicitNonceSize+c.ccm.Overhead() {
+		return h, nil, 0, ErrShortRecord
+	}
+	plen := len(frag) - ExplicitNonceSize - c.ccm.Overhead()
+	if plen > MaxPlaintext {
+		return h, nil, 0, ErrRecordOverflow
+	}
+	nonce := append(c.salt[:], frag[:ExplicitNonceSize]...)
+	ct := append([]byte(nil), frag[ExplicitNonceSize:]...)
+	payload, err = c.ccm.Open(nil, nonce, ct, aad12(&h, plen))
+	if err != nil {
+		return h, nil, 0, err
+	}
+	return h, payload, n, nil
+}
+
+/* vim: set noai ts=4 sw=4: */
@@ -0,0 +1,252 @@
+package dtlsrecord
+
+// DTLS 1.3 record protection with TLS_AES_128_CCM_SHA256 and
+// TLS_AES_128_CCM_8_SHA256 - RFC 9147.
+//
+//	Unified header: 0 0 1 C S L E E | Connection ID | Sequence Number (8/16) | Length (16)
+//	Inner plaintext: content || content type(1) || zero padding
+//	Nonce: write_iv XOR 64 bit sequence number, left padded to 12 bytes
+//	AAD:   the unified header with the sequence number in the clear
+//
+// After the record is protected the sequence number bits in the header are
+// encrypted (RFC 9147 section 4.2.3): mask = AES-ECB(sn_key, first 16 bytes of
+// ciphertext) and the sequence number is XORed with the front of the mask.
+//
+// MIT Licensed.
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hkdf"
+	"encoding/binary"
+	"hash"
+
+	"github.com/pschlump/AesCCM"
+)
+
+const MaxPlaintext = 1 << 14 // 2^14 bytes of plaintext per record
+
+// Unified header bits
+const (
+	hdrFixedMask = 0xe0
+	hdrFixed     = 0x20
+	hdrCID       = 0x10
+	hdrSeq16     = 0x08
+	hdrLength    = 0x04
+	hdrEpochMask = 0x03
+)
+
+const sampleSize = aes.BlockSize
+
+// Record13 describes a DTLS 1.3 protected record.
+type Record13 struct {
+	Epoch       uint16 // only the low 2 bits are sent - Open returns just those bits
+	Seq         uint64 // 48 bit record sequence number, 8 or 16 low bits are sent
+	ContentType uint8  // the real content type, carried in the inner plaintext
+	CID         []byte // connection ID, omitted if empty
+	ShortSeq    bool   // send an 8 bit sequence number instead of 16 bits
+	NoLength    bool   // omit the length - the record extends to the end of the datagram
+	Payload     []byte //
+}
+
+// Cipher13 protects records for one direction and epoch of a DTLS 1.3 connection.
+type Cipher13 struct {
+	ccm aesccm.CCM      //
+	iv  [NonceSize]byte // write_iv
+	sn  cipher.Block    // AES under sn_key for record number encryption
+}
+
+// DeriveKeys13 derives the write key, write IV and sequence number key from a
+// traffic secret with HKDF-Expand-Label and the "dtls13" label prefix.  h is the
+// cipher suite hash - SHA-256 for both CCM suites.
+func DeriveKeys13(h func() hash.Hash, secret []byte, keyLen int) (key, iv, snKey []byte, err error) {
+	if key, err = expandLabel(h, secret, "key", keyLen); err != nil {
+		return
+	}
+	if iv, err = expandLabel(h, secret, "iv", NonceSize); err != nil {
+		return
+	}
+	snKey, err = expandLabel(h, secret, "sn", keyLen)
+	return
+}
+
+// expandLabel is HKDF-Expand-Label from RFC 8446 section 7.1 with an empty context.
+func expandLabel(h func() hash.Hash, secret []byte, label string, length int) ([]byte, error) {
+	full := "dtls13" + label
+	info := binary.BigEndian.AppendUint16(nil, uint16(length))
+	info = append(info, byte(len(full)))
+	info = append(info, full...)
+	info = append(info, 0) // context length
+	return hkdf.Expand(h, secret, string(info), length)
+}
+
+// NewCipher13 sets up DTLS 1.3 record protection.  tagSize is TagSizeCCM or
+// TagSizeCCM8.
+func NewCipher13(key, iv, snKey []byte, tagSize int) (*Cipher13, error) {
+	if len(iv) != NonceSize {
+		return nil, ErrIVSize
+	}
+	ccm, err := newCCM(key, tagSize)
+	if err != nil {
+		return nil, err
+	}
+	sn, err := aes.NewCipher(snKey)
+	if err != nil {
+		return nil, err
+	}
+	c := &Cipher13{ccm: ccm, sn: sn}
+	copy(c.iv[:], iv)
+	return c, nil
+}
+
+func (c *Cipher13) nonce(seq uint64) []byte {
+	nonce := make([]byte, NonceSize)
+	copy(nonce, c.iv[:])
+	for i := 0; i < 8; i++ {
+		nonce[NonceSize-1-i] ^= byte(seq >> (8 * uint(i)))
+	}
+	return nonce
+}
+
+// maskSeq encrypts or decrypts the sn bytes of the header with the mask made from
+// the ciphertext sample.
+func (c *Cipher13) maskSeq(sn, sample []byte) {
+	var mask [sampleSize]byte
+	c.sn.Encrypt(mask[:], sample[:sampleSize])
+	for i := range sn {
+		sn[i] ^= mask[i]
+	}
+}
+
+// Seal protects r and returns the record.  The inner plaintext is padded with zeros
+// when needed so there are always 16 bytes of ciphertext to sample.
+func (c *Cipher13) Seal(r *Record13) ([]byte, error) {
+	if len(r.Payload) > MaxPlaintext {
+		return nil, ErrRecordOverflow
+	}
+	inner := make([]byte, 0, len(r.Payload)+1+sampleSize)
+	inner = append(append(inner, r.Payload...), r.ContentType)
+	for len(inner)+c.ccm.Overhead() < sampleSize {
+		inner = append(inner, 0)
+	}
+
+	b0 := byte(hdrFixed) | byte(r.Epoch&hdrEpochMask)
+	if len(r.CID) > 0 {
+		b0 |= hdrCID
+	}
+	if !r.ShortSeq {
+		b0 |= hdrSeq16
+	}
+	if !r.NoLength {
+		b0 |= hdrLength
+	}
+	rec := append(make([]byte, 0, 5+len(r.CID)+len(inner)+c.ccm.Overhead()), b0)
+	rec = append(rec, r.CID...)
+	snOff := len(rec)
+	if r.ShortSeq {
+		rec = append(rec, byte(r.Seq))
+	} else {
+		rec = binary.BigEndian.AppendUint16(rec, uint16(r.Seq))
+	}
+	snEnd := len(rec)
+	if !r.NoLength {
+		rec = binary.BigEndian.AppendUint16(rec, uint16(len(inner)+c.ccm.Overhead()))
+	}
+
+	hlen := len(rec)
+	rec = c.ccm.Seal(rec, c.nonce(r.Seq&seqMask), inner, rec)
+	if len(rec) != hlen+len(inner)+c.ccm.Overhead() {
+		return nil, ErrSealFailed
+	}
+	c.maskSeq(rec[snOff:snEnd], rec[hlen:])
+	return rec, nil
+}
+
+// Open authenticates and decrypts the record at the front of datagram.  cidLen is
+// the length of the connection ID negotiated for this connection (0 for none).
+// expectedSeq is the next sequence number expected in this epoch and is used to
+// rebuild the full sequence number from the bits on the wire.  It returns the
+// record and the number of bytes of datagram it used.  Open does not check for
+// replays - pass r.Seq to the ReplayWindow for the epoch once Open succeeds.
+func (c *Cipher13) Open(datagram []byte, cidLen int, expectedSeq uint64) (r Record13, n int, err error) {
+	if len(datagram) < 1 || datagram[0]&hdrFixedMask != hdrFixed {
+		return r, 0, ErrNotCiphertext
+	}
+	b0 := datagram[0]
+	r.Epoch = uint16(b0 & hdrEpochMask)
+	r.ShortSeq = b0&hdrSeq16 == 0
+	r.NoLength = b0&hdrLength == 0
+
+	hlen := 1
+	if b0&hdrCID != 0 {
+		hlen += cidLen
+	}
+	snOff := hlen
+	snLen := 2
+	if r.ShortSeq {
+		snLen = 1
+	}
+	hlen += snLen
+	if !r.NoLength {
+		hlen += 2
+	}
+	if len(datagram) < hlen {
+		return r, 0, ErrShortRecord
+	}
+	n = len(datagram)
+	if !r.NoLength {
+		n = hlen + int(binary.BigEndian.Uint16(datagram[hlen-2:]))
+		if len(datagram) < n {
+			return r, 0, ErrShortRecord
+		}
+	}
+	if n-hlen < sampleSize || n-hlen < c.ccm.Overhead()+1 {
+		return r, 0, ErrShortRecord
+	}
+	if n-hlen-c.ccm.Overhead() > MaxPlaintext+256 {
+		return r, 0, ErrRecordOverflow
+	}
+
+	hdr := append([]byte(nil), datagram[:hlen]...)
+	ct := append([]byte(nil), datagram[hlen:n]...)
+	c.maskSeq(hdr[snOff:snOff+snLen], ct)
+	if b0&hdrCID != 0 {
+		r.CID = hdr[1 : 1+cidLen]
+	}
+	var partial uint64
+	for _, b := range hdr[snOff : snOff+snLen] {
+		partial = partial<<8 | uint64(b)
+	}
+	r.Seq = reconstructSeq(expectedSeq, partial, uint(8*snLen))
+
+	inner, err := c.ccm.Open(nil, c.nonce(r.Seq), ct, hdr)
+	if err != nil {
+		return r, 0, err
+	}
+	i := len(inner) - 1
+	for i >= 0 && inner[i] == 0 {
+		i--
+	}
+	if i < 0 {
+		return r, 0, ErrNoContentType
+	}
+	r.ContentType = inner[i]
+	r.Payload = inner[:i]
+	return r, n, nil
+}
+
+// reconstructSeq picks the sequence number whose low bits are partial and which is
+// closest to expected - RFC 9147 section 4.2.2.
+func reconstructSeq(expected, partial uint64, bits uint) uint64 {
+	win := uint64(1) << bits
+	cand := expected&^(win-1) | partial
+	switch {
+	case cand > expected && cand-expected > win/2 && cand >= win:
+		cand -= win
+	case cand < expected && expected-cand > win/2 && cand+win <= seqMask:
+		cand += win
+	}
+	return cand
+}
+
+/* vim: set noai ts=4 sw=4: */
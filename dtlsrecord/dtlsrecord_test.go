@@ -0,0 +1,292 @@
+package dtlsrecord
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/sha256"
+	"encoding/hex"
+	"testing"
+
+	"github.com/pschlump/AesCCM"
+)
+
+func mustHex(t *testing.T, s string) []byte {
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		t.Fatalf("bad hex in test: %s", err)
+	}
+	return b
+}
+
+func TestDTLS12(t *testing.T) {
+	key := mustHex(t, "000102030405060708090a0b0c0d0e0f")
+	iv := mustHex(t, "a0a1a2a3")
+
+	for _, tagSize := range []int{TagSizeCCM, TagSizeCCM8} {
+		c, err := NewCipher12(key, iv, tagSize)
+		if err != nil {
+			t.Fatal(err)
+		}
+		h := Header12{ContentType: ContentApplicationData, Version: VersionDTLS12, Epoch: 1, Seq: 0x0000010203040506 & seqMask}
+		payload := []byte("GET /.well-known/core")
+		rec, err := c.Seal(&h, payload)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(rec) != HeaderSize12+ExplicitNonceSize+len(payload)+tagSize || int(h.Length) != len(rec)-HeaderSize12 {
+			t.Errorf("Tag %d: bad record length %d", tagSize, len(rec))
+		}
+		if got := hex.EncodeToString(rec[:HeaderSize12+ExplicitNonceSize]); got != "17fefd"+"0001"+"010203040506"+hex.EncodeToString([]byte{0, byte(h.Length)})+"0001010203040506" {
+			t.Errorf("Tag %d: header and explicit nonce: got %s", tagSize, got)
+		}
+
+		// The fragment is plain AES-CCM with the RFC 6655 nonce and additional data.
+		blk, _ := aes.NewCipher(key)
+		ccm, _ := aesccm.NewCCM(blk, tagSize, NonceSize)
+		nonce := mustHex(t, "a0a1a2a3"+"0001010203040506")
+		aad := mustHex(t, "0001010203040506"+"17"+"fefd"+hex.EncodeToString([]byte{0, byte(len(payload))}))
+		if !bytes.Equal(rec[HeaderSize12+ExplicitNonceSize:], ccm.Seal(nil, nonce, payload, aad)) {
+			t.Errorf("Tag %d: fragment does not match AES-CCM", tagSize)
+		}
+
+		datagram := append(append([]byte(nil), rec...), rec...)
+		h2, pt, n, err := c.Open(datagram)
+		if err != nil {
+			t.Fatalf("Tag %d: Open: %s", tagSize, err)
+		}
+		if n != len(rec) || !bytes.Equal(pt, payload) || h2.Seq != h.Seq || h2.Epoch != 1 {
+			t.Errorf("Tag %d: Open returned %+v %q n=%d", tagSize, h2, pt, n)
+		}
+
+		for pos := range rec {
+			if pos == 11 || pos == 12 {
+				continue // the length field just makes the record short or long
+			}
+			rec[pos] ^= 0x01
+			if _, _, _, err := c.Open(rec); err == nil {
+				t.Errorf("Tag %d: altered byte %d, Open should have failed", tagSize, pos)
+			}
+			rec[pos] ^= 0x01
+		}
+	}
+
+	if _, err := NewCipher12(key, iv, 12); err != ErrTagSize {
+		t.Errorf("NewCipher12 with tag size 12: expected ErrTagSize, got %v", err)
+	}
+}
+
+// Records captured from an OpenSSL 3.0.17 s_client/s_server DTLS 1.2 session with
+// PSK-AES128-CCM8, the keys from the key block of the master secret in the
+// -keylogfile output.  The client sent "hello from the client\n".
+func TestDTLS12OpenSSL(t *testing.T) {
+	var testData = []struct {
+		key     string
+		iv      string
+		record  string
+		seq     uint64
+		ctype   uint8
+		payload string // hex, or the front of the handshake message
+	}{
+		{key: "f057b8f9de17a80213511b1222d5f791", iv: "bbea3ee6", seq: 1, ctype: ContentApplicationData,
+			record:  "17fefd0001000000000001002600010000000000010ca4bb120db236570da409fa98c6cc3eb520723cd4bf188b9e7fbd6466d4",
+			payload: hex.EncodeToString([]byte("hello from the client\n"))},
+		{key: "f057b8f9de17a80213511b1222d5f791", iv: "bbea3ee6", seq: 0, ctype: ContentHandshake, // client Finished
+			record:  "16fefd000100000000000000280001000000000000b674fbeb8bd1712fc7c6281538f970225c287b3ccdfd171c88b0178d0f98e3a9",
+			payload: "1400000c000300000000000c"},
+		{key: "0e7612f2c35875f793b60b43fe889594", iv: "3fd0baea", seq: 0, ctype: ContentHandshake, // server Finished
+			record:  "16fefd00010000000000000028000100000000000006c16be497e873bb94c3698018abb5ae732ebae82470300e8839eafb6c21e905",
+			payload: "1400000c000400000000000c"},
+	}
+
+	for ii, vv := range testData {
+		c, err := NewCipher12(mustHex(t, vv.key), mustHex(t, vv.iv), TagSizeCCM8)
+		if err != nil {
+			t.Fatal(err)
+		}
+		rec := mustHex(t, vv.record)
+		h, pt, n, err := c.Open(rec)
+		if err != nil {
+			t.Errorf("Test %d: Open: %s", ii, err)
+			continue
+		}
+		if n != len(rec) || h.Epoch != 1 || h.Seq != vv.seq || h.ContentType != vv.ctype || !bytes.HasPrefix(pt, mustHex(t, vv.payload)) {
+			t.Errorf("Test %d: Open returned %+v %x n=%d", ii, h, pt, n)
+		}
+		if vv.ctype == ContentApplicationData && hex.EncodeToString(pt) != vv.payload {
+			t.Errorf("Test %d: got %x, expected %s", ii, pt, vv.payload)
+		}
+
+		// Sealing the plaintext again gives the same record.
+		again, err := c.Seal(&h, pt)
+		if err != nil || !bytes.Equal(again, rec) {
+			t.Errorf("Test %d: Seal got %x, expected %x", ii, again, rec)
+		}
+	}
+}
+
+// RFC 9147 gives no example records.  These were computed apart from this package
+// with the Python cryptography package (AESCCM, AES-ECB and HKDFExpand over
+// OpenSSL 3.0) from the secret used in TestDTLS13.
+func TestDTLS13Vectors(t *testing.T) {
+	secret := mustHex(t, "c0c1c2c3c4c5c6c7c8c9cacbcccdcecfd0d1d2d3d4d5d6d7d8d9dadbdcdddedf")
+	key, iv, snKey, err := DeriveKeys13(sha256.New, secret, 16)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := hex.EncodeToString(key) + " " + hex.EncodeToString(iv) + " " + hex.EncodeToString(snKey); got != "cc2784ec8211ee8b67f5bfd2c620977a 6db1bff8226f68e3329de940 37306aa7229cbfebc833a8455157c027" {
+		t.Errorf("DeriveKeys13: got %s", got)
+	}
+
+	var testData = []struct {
+		tagSize int
+		r       Record13
+		record  string
+	}{
+		{tagSize: TagSizeCCM, r: Record13{Epoch: 3, Seq: 0x1234, ContentType: ContentApplicationData, Payload: []byte("hello world")},
+			record: "2f3b7e001c71d3b94db37016c9d6d2d85a200be787905d5ac59851fc8c4bbb784d"},
+		{tagSize: TagSizeCCM8, r: Record13{Epoch: 3, Seq: 0x1234, ContentType: ContentApplicationData, Payload: []byte("hello world")},
+			record: "2fbea6001471d3b94db37016c9d6d2d85ab78fa8c7ec394cb0"},
+		{tagSize: TagSizeCCM8, r: Record13{Epoch: 2, Seq: 0x0305, ContentType: ContentHandshake, CID: []byte{9, 8, 7, 6}, ShortSeq: true, Payload: []byte("x")},
+			record: "3609080706400010d697a2984608a3704de15184558ebfbe"},
+	}
+
+	for ii, vv := range testData {
+		c, err := NewCipher13(key, iv, snKey, vv.tagSize)
+		if err != nil {
+			t.Fatal(err)
+		}
+		rec, err := c.Seal(&vv.r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := hex.EncodeToString(rec); got != vv.record {
+			t.Errorf("Test %d: got %s, expected %s", ii, got, vv.record)
+		}
+		r, n, err := c.Open(mustHex(t, vv.record), len(vv.r.CID), vv.r.Seq)
+		if err != nil || n != len(rec) || r.Seq != vv.r.Seq || r.ContentType != vv.r.ContentType || !bytes.Equal(r.Payload, vv.r.Payload) {
+			t.Errorf("Test %d: Open returned %+v n=%d err=%v", ii, r, n, err)
+		}
+	}
+}
+
+func TestDTLS13(t *testing.T) {
+	secret := mustHex(t, "c0c1c2c3c4c5c6c7c8c9cacbcccdcecfd0d1d2d3d4d5d6d7d8d9dadbdcdddedf")
+	key, iv, snKey, err := DeriveKeys13(sha256.New, secret, 16)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(key) != 16 || len(iv) != NonceSize || len(snKey) != 16 || bytes.Equal(key, snKey) {
+		t.Fatalf("DeriveKeys13: bad keys %x %x %x", key, iv, snKey)
+	}
+
+	for _, tagSize := range []int{TagSizeCCM, TagSizeCCM8} {
+		c, err := NewCipher13(key, iv, snKey, tagSize)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for ii, r := range []Record13{
+			{Epoch: 3, Seq: 0x1234, ContentType: ContentApplicationData, Payload: []byte("hello world")},
+			{Epoch: 2, Seq: 0x0305, ContentType: ContentHandshake, CID: []byte{9, 8, 7, 6}, ShortSeq: true, Payload: []byte("x")},
+			{Epoch: 3, Seq: 0xabcdef, ContentType: ContentACK, NoLength: true},
+		} {
+			rec, err := c.Seal(&r)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(rec) < 1+len(r.CID)+1+sampleSize || rec[0]&hdrEpochMask != byte(r.Epoch&3) {
+				t.Errorf("Tag %d test %d: bad record %x", tagSize, ii, rec)
+			}
+
+			// The sequence number on the wire is masked with AES-ECB of the sample.
+			snOff := 1 + len(r.CID)
+			blk, _ := aes.NewCipher(snKey)
+			var mask [16]byte
+			hlen := snOff + 2
+			if r.ShortSeq {
+				hlen--
+			}
+			if !r.NoLength {
+				hlen += 2
+			}
+			blk.Encrypt(mask[:], rec[hlen:hlen+16])
+			if r.ShortSeq && rec[snOff]^mask[0] != byte(r.Seq) || !r.ShortSeq && (rec[snOff]^mask[0] != byte(r.Seq>>8) || rec[snOff+1]^mask[1] != byte(r.Seq)) {
+				t.Errorf("Tag %d test %d: sequence number not encrypted as expected", tagSize, ii)
+			}
+
+			datagram := append(append([]byte(nil), rec...), 0xff)
+			if r.NoLength {
+				datagram = datagram[:len(rec)]
+			}
+			r2, n, err := c.Open(datagram, len(r.CID), r.Seq-10)
+			if err != nil {
+				t.Fatalf("Tag %d test %d: Open: %s", tagSize, ii, err)
+			}
+			if n != len(rec) || r2.Seq != r.Seq || r2.ContentType != r.ContentType || !bytes.Equal(r2.Payload, r.Payload) ||
+				!bytes.Equal(r2.CID, r.CID) || r2.Epoch != r.Epoch&3 {
+				t.Errorf("Tag %d test %d: Open returned %+v n=%d", tagSize, ii, r2, n)
+			}
+
+			for pos := range rec {
+				rec[pos] ^= 0x02
+				if _, _, err := c.Open(rec, len(r.CID), r.Seq); err == nil {
+					t.Errorf("Tag %d test %d: altered byte %d, Open should have failed", tagSize, ii, pos)
+				}
+				rec[pos] ^= 0x02
+			}
+		}
+	}
+}
+
+func TestReconstructSeq(t *testing.T) {
+	for ii, vv := range []struct {
+		expected, partial uint64
+		bits              uint
+		out               uint64
+	}{
+		{0, 0, 8, 0},
+		{0x100, 0xff, 8, 0xff},
+		{0x1fe, 0x01, 8, 0x201},
+		{0x12345, 0x2345, 16, 0x12345},
+		{0x1fff0, 0x0010, 16, 0x20010},
+		{0x20010, 0xfff0, 16, 0x1fff0},
+		{5, 0xfe, 8, 0xfe}, // nothing below zero
+	} {
+		if got := reconstructSeq(vv.expected, vv.partial, vv.bits); got != vv.out {
+			t.Errorf("Test %d: got %#x expected %#x", ii, got, vv.out)
+		}
+	}
+}
+
+func TestReplayWindow(t *testing.T) {
+	var w ReplayWindow
+	for ii, vv := range []struct {
+		seq uint64
+		ok  bool
+	}{
+		{0, true},
+		{0, false},
+		{2, true},
+		{1, true},
+		{1, false},
+		{100, true},
+		{36, true}, // 64 behind
+		{35, false},
+		{99, true},
+		{36, false},
+		{200, true},
+		{99, false},
+	} {
+		err := w.Check(vv.seq)
+		if vv.ok != (err == nil) {
+			t.Errorf("Step %d: seq %d, got err=%v", ii, vv.seq, err)
+		}
+		if err == nil {
+			w.Update(vv.seq)
+		}
+	}
+	if w.Next() != 201 {
+		t.Errorf("Next: got %d expected 201", w.Next())
+	}
+}
+
+/* vim: set noai ts=4 sw=4: */
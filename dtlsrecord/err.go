@@ -0,0 +1,14 @@
+package dtlsrecord
+
+import "errors"
+
+var ErrTagSize = errors.New("DTLSRECORD: tag size must be 16 (CCM) or 8 (CCM_8)")
+var ErrIVSize = errors.New("DTLSRECORD: invalid write IV size")
+var ErrShortRecord = errors.New("DTLSRECORD: record too short")
+var ErrRecordOverflow = errors.New("DTLSRECORD: record too long")
+var ErrSealFailed = errors.New("DTLSRECORD: unable to protect record")
+var ErrNotCiphertext = errors.New("DTLSRECORD: not a DTLS 1.3 ciphertext record")
+var ErrNoContentType = errors.New("DTLSRECORD: inner plaintext has no content type")
+var ErrReplay = errors.New("DTLSRECORD: replayed record")
+
+/* vim: set noai ts=4 sw=4: */
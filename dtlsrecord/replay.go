@@ -0,0 +1,68 @@
+package dtlsrecord
+
+// Anti-replay sliding window - RFC 6347 section 4.1.2.6 and RFC 9147 section 4.5.1.
+//
+// Keep one ReplayWindow per epoch.  Records are checked before they are processed
+// and the window is only updated once the record has been authenticated, so
+// forged records cannot move the window.
+//
+// MIT Licensed.
+
+import "sync"
+
+const ReplayWindowSize = 64
+
+// ReplayWindow tracks the sequence numbers received in one epoch.
+type ReplayWindow struct {
+	mu     sync.Mutex //
+	max    uint64     // largest sequence number accepted
+	bitmap uint64     // bit i set means max-(i+1) has been accepted
+	seen   bool       // false until the first record is accepted
+}
+
+// Check reports ErrReplay if seq has already been received or is too old to be
+// tracked by the window.
+func (w *ReplayWindow) Check(seq uint64) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if !w.seen || seq > w.max {
+		return nil
+	}
+	off := w.max - seq
+	if off == 0 || off > ReplayWindowSize || w.bitmap&(1<<(off-1)) != 0 {
+		return ErrReplay
+	}
+	return nil
+}
+
+// Update marks seq as received.  Call it only after the record has been
+// authenticated.
+func (w *ReplayWindow) Update(seq uint64) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	switch {
+	case !w.seen:
+		w.max, w.bitmap, w.seen = seq, 0, true
+	case seq > w.max:
+		if d := seq - w.max; d > ReplayWindowSize {
+			w.bitmap = 0
+		} else {
+			w.bitmap = w.bitmap<<d | 1<<(d-1)
+		}
+		w.max = seq
+	case seq < w.max && w.max-seq <= ReplayWindowSize:
+		w.bitmap |= 1 << (w.max - seq - 1)
+	}
+}
+
+// Next returns the sequence number to expect next, for Cipher13.Open.
+func (w *ReplayWindow) Next() uint64 {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if !w.seen {
+		return 0
+	}
+	return w.max + 1
+}
+
+/* vim: set noai ts=4 sw=4: */
@@ -0,0 +1,242 @@
+package envelope
+
+// Envelope encryption with per-object data keys, the pattern cloud KMSes use.
+//
+// SealDataKey makes a fresh AES-256 data key, seals the content with it in CCM
+// mode and has a KeyWrapper wrap the data key under a key encryption key (KEK).
+// Only the wrapped key is kept.  To open, the KeyWrapper unwraps the data key and
+// the content is opened with it.  The KEK never has to leave the KeyWrapper, so
+// an external KMS can stand in for the local AES key wrap implementation here.
+//
+//	Offset	Size	Contents
+//	0		1		Magic, 0xCF
+//	1		1		Version, 1
+//	2		1		Length K of the KEK id
+//	3		K		KEK id
+//	3+K		2		Length W of the wrapped key, big endian
+//	5+K		W		Wrapped data key
+//	5+K+W	1		Length N of the nonce
+//	6+K+W	N		Nonce
+//	6+K+W+N	...		CCM ciphertext || tag
+//
+// The data key is used once, so the nonce only has to be the right size; it is
+// random and 8 bytes long, which leaves CCM a 7 byte length field.  Everything in
+// front of the ciphertext is included in the additional data.
+//
+// MIT Licensed.
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"io"
+	"os"
+
+	"github.com/pschlump/AesCCM"
+)
+
+const DataKeyMagic = 0xCF
+const DataKeySize = 32
+const DataKeyNonceSize = 8
+const DataKeyTagSize = 16
+
+// KeyWrapper wraps and unwraps data keys under a key encryption key.
+type KeyWrapper interface {
+	// WrapKey encrypts dataKey and returns the id of the KEK it used.  dataKey is
+	// zeroed after the call, it must not be kept.
+	WrapKey(dataKey []byte) (kekID string, wrapped []byte, err error)
+
+	// UnwrapKey decrypts a key wrapped under kekID.
+	UnwrapKey(kekID string, wrapped []byte) ([]byte, error)
+}
+
+// AESKeyWrapper wraps keys locally with AES-KWP (RFC 5649).
+type AESKeyWrapper struct {
+	id  string       //
+	kek cipher.Block //
+}
+
+// NewAESKeyWrapper uses kek, a 16, 24 or 32 byte AES key, as the KEK.  An empty
+// id is replaced by a fingerprint of the KEK.
+func NewAESKeyWrapper(id string, kek []byte) (*AESKeyWrapper, error) {
+	blk, err := aes.NewCipher(kek)
+	if err != nil {
+		return nil, err
+	}
+	if id == "" {
+		sum := sha256.Sum256(kek)
+		id = hex.EncodeToString(sum[:8])
+	}
+	return &AESKeyWrapper{id: id, kek: blk}, nil
+}
+
+// LoadKEKFile reads a raw 16, 24 or 32 byte KEK from a file.  The KEK id is the
+// fingerprint of the key, so the file can be moved without breaking old data.
+func LoadKEKFile(path string) (*AESKeyWrapper, error) {
+	kek, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		for i := range kek {
+			kek[i] = 0
+		}
+	}()
+	return NewAESKeyWrapper("", kek)
+}
+
+// ID returns the KEK id.
+func (w *AESKeyWrapper) ID() string {
+	return w.id
+}
+
+func (w *AESKeyWrapper) WrapKey(dataKey []byte) (string, []byte, error) {
+	wrapped, err := KeyWrapPad(w.kek, dataKey)
+	return w.id, wrapped, err
+}
+
+func (w *AESKeyWrapper) UnwrapKey(kekID string, wrapped []byte) ([]byte, error) {
+	if kekID != w.id {
+		return nil, ErrUnknownKEK
+	}
+	return KeyUnwrapPad(w.kek, wrapped)
+}
+
+// DataKeyEnvelope is content sealed under a wrapped data key.
+type DataKeyEnvelope struct {
+	KEKID      string // which KEK wrapped the data key
+	WrappedKey []byte //
+	Nonce      []byte //
+	Ciphertext []byte // CCM ciphertext || tag
+}
+
+// header encodes everything in front of the ciphertext.
+func (e *DataKeyEnvelope) header() ([]byte, error) {
+	if len(e.KEKID) > 255 || len(e.WrappedKey) > 0xffff || len(e.Nonce) > 255 {
+		return nil, ErrAlgorithm
+	}
+	h := make([]byte, 0, 6+len(e.KEKID)+len(e.WrappedKey)+len(e.Nonce))
+	h = append(h, DataKeyMagic, Version, byte(len(e.KEKID)))
+	h = append(h, e.KEKID...)
+	h = binary.BigEndian.AppendUint16(h, uint16(len(e.WrappedKey)))
+	h = append(h, e.WrappedKey...)
+	h = append(h, byte(len(e.Nonce)))
+	return append(h, e.Nonce...), nil
+}
+
+// MarshalBinary returns the wire form of e.
+func (e *DataKeyEnvelope) MarshalBinary() ([]byte, error) {
+	h, err := e.header()
+	if err != nil {
+		return nil, err
+	}
+	return append(h, e.Ciphertext...), nil
+}
+
+// ParseDataKeyEnvelope reads the wire form.  The fields alias data.
+func ParseDataKeyEnvelope(data []byte) (*DataKeyEnvelope, error) {
+	if len(data) < 3 {
+		return nil, ErrShortEnvelope
+	}
+	if data[0] != DataKeyMagic {
+		return nil, ErrNotEnvelope
+	}
+	if data[1] != Version {
+		return nil, ErrVersion
+	}
+	e := &DataKeyEnvelope{}
+	p := 2
+	field := func(size int) []byte {
+		if p < 0 || len(data) < p+size {
+			p = -1
+			return nil
+		}
+		p += size
+		return data[p-size : p]
+	}
+	if k := field(1); k != nil {
+		e.KEKID = string(field(int(k[0])))
+	}
+	if w := field(2); w != nil {
+		e.WrappedKey = field(int(binary.BigEndian.Uint16(w)))
+	}
+	if n := field(1); n != nil {
+		e.Nonce = field(int(n[0]))
+	}
+	if p < 0 {
+		return nil, ErrShortEnvelope
+	}
+	e.Ciphertext = data[p:]
+	return e, nil
+}
+
+// SealDataKey seals plaintext under a new data key wrapped by w.  adata is
+// authenticated but not stored.
+func SealDataKey(w KeyWrapper, plaintext, adata []byte) (*DataKeyEnvelope, error) {
+	dataKey := make([]byte, DataKeySize)
+	defer zero(dataKey)
+	e := &DataKeyEnvelope{Nonce: make([]byte, DataKeyNonceSize)}
+	if _, err := io.ReadFull(rand.Reader, dataKey); err != nil {
+		return nil, err
+	}
+	if _, err := io.ReadFull(rand.Reader, e.Nonce); err != nil {
+		return nil, err
+	}
+	var err error
+	if e.KEKID, e.WrappedKey, err = w.WrapKey(dataKey); err != nil {
+		return nil, err
+	}
+	ccm, err := dataKeyCCM(dataKey, len(e.Nonce))
+	if err != nil {
+		return nil, err
+	}
+	h, err := e.header()
+	if err != nil {
+		return nil, err
+	}
+	e.Ciphertext = ccm.Seal(nil, e.Nonce, plaintext, append(h, adata...))
+	if len(e.Ciphertext) != len(plaintext)+DataKeyTagSize {
+		return nil, ErrSealFailed
+	}
+	return e, nil
+}
+
+// OpenDataKey unwraps the data key with w and opens the content.
+func OpenDataKey(w KeyWrapper, e *DataKeyEnvelope, adata []byte) ([]byte, error) {
+	dataKey, err := w.UnwrapKey(e.KEKID, e.WrappedKey)
+	if err != nil {
+		return nil, err
+	}
+	defer zero(dataKey)
+	ccm, err := dataKeyCCM(dataKey, len(e.Nonce))
+	if err != nil {
+		return nil, err
+	}
+	h, err := e.header()
+	if err != nil {
+		return nil, err
+	}
+	return ccm.Open(nil, e.Nonce, e.Ciphertext, append(h, adata...))
+}
+
+func dataKeyCCM(dataKey []byte, nonceSize int) (aesccm.CCM, error) {
+	if len(dataKey) != DataKeySize {
+		return nil, ErrKeyWrapSize
+	}
+	blk, err := aes.NewCipher(dataKey)
+	if err != nil {
+		return nil, err
+	}
+	return aesccm.NewCCM(blk, DataKeyTagSize, nonceSize)
+}
+
+func zero(b []byte) {
+	for i := range b {
+		b[i] = 0
+	}
+}
+
+/* vim: set noai ts=4 sw=4: */
@@ -0,0 +1,225 @@
+package envelope
+
+// A self-describing binary envelope for AES-CCM sealed messages.
+//
+// Everything needed to open a message other than the key travels with it, so
+// stored blobs stay readable after the tag size, nonce size or key size in use
+// changes.
+//
+//	Offset	Size	Contents
+//	0		1		Magic, 0xCC
+//	1		1		Version, 1
+//	2		1		Algorithm id - see below
+//	3		4		Key id, big endian
+//	7		N		Nonce, N is the nonce size from the algorithm id
+//	7+N		...		CCM ciphertext || tag
+//
+// The algorithm id packs the three CCM parameters into one byte:
+//
+//	bits 7-5	(TagSize-2)/2	the same M' as the CCM flags byte, 1..7
+//	bits 4-2	NonceSize-7		0..6
+//	bits 1-0	key size		0 = AES-128, 1 = AES-192, 2 = AES-256
+//
+// The header (bytes 0 through 7+N) is authenticated: the additional data given to
+// CCM is the header followed by the caller's additional data.  The header has a
+// fixed length for a given algorithm id, so the two cannot be confused.
+//
+// Seal picks the nonce at random, and nothing counts how many messages a key has
+// sealed, so only keys with a 12 or 13 byte nonce seal: at least 2^32 messages
+// (aesccm.DefaultRandomNonceLimit) before a repeat is more likely than 2^-32.  Keys
+// with shorter nonces still open what was sealed with them.
+//
+// MIT Licensed.
+
+import (
+	"crypto/aes"
+	"crypto/rand"
+	"encoding/binary"
+	"io"
+
+	"github.com/pschlump/AesCCM"
+)
+
+const Magic = 0xCC
+const Version = 1
+const fixedHeaderSize = 7 // magic, version, algorithm id and key id
+
+// MinSealNonceSize is the shortest nonce Seal will pick at random.
+const MinSealNonceSize = 12
+
+// Key is one CCM key as seen by the envelope.
+type Key struct {
+	ID      uint32     // written to the envelope to find the key again
+	KeySize int        // size of the AES key in bytes - 16, 24 or 32
+	CCM     aesccm.CCM // the key in CCM mode, it sets the tag and nonce sizes
+}
+
+// Keyring supplies the keys for Seal and Open.
+type Keyring interface {
+	// Primary returns the key new messages are sealed with.
+	Primary() (Key, error)
+
+	// Key returns the key with the given id.
+	Key(id uint32) (Key, error)
+}
+
+// SingleKey is a Keyring with one AES key.
+type SingleKey struct {
+	key Key
+}
+
+// NewSingleKey sets up key in CCM mode with the given tag and nonce sizes.  A
+// nonce size under MinSealNonceSize gives a key that can only Open.
+func NewSingleKey(id uint32, key []byte, tagSize, nonceSize int) (*SingleKey, error) {
+	blk, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	ccm, err := aesccm.NewCCM(blk, tagSize, nonceSize)
+	if err != nil {
+		return nil, err
+	}
+	return &SingleKey{key: Key{ID: id, KeySize: len(key), CCM: ccm}}, nil
+}
+
+func (s *SingleKey) Primary() (Key, error) {
+	return s.key, nil
+}
+
+func (s *SingleKey) Key(id uint32) (Key, error) {
+	if id != s.key.ID {
+		return Key{}, ErrUnknownKey
+	}
+	return s.key, nil
+}
+
+// Header is the unencrypted front of an envelope.
+type Header struct {
+	Version   uint8
+	TagSize   int
+	NonceSize int
+	KeySize   int
+	KeyID     uint32
+	Nonce     []byte
+}
+
+// Len returns the size of the encoded header.
+func (h *Header) Len() int {
+	return fixedHeaderSize + h.NonceSize
+}
+
+// Algorithm returns the packed algorithm id for the header's parameters.
+func (h *Header) Algorithm() (uint8, error) {
+	return Algorithm(h.TagSize, h.NonceSize, h.KeySize)
+}
+
+// Algorithm packs the CCM parameters into an algorithm id.
+func Algorithm(tagSize, nonceSize, keySize int) (uint8, error) {
+	if tagSize < 4 || tagSize > 16 || tagSize%2 != 0 || nonceSize < 7 || nonceSize > 13 {
+		return 0, ErrAlgorithm
+	}
+	var k uint8
+	switch keySize {
+	case 16:
+		k = 0
+	case 24:
+		k = 1
+	case 32:
+		k = 2
+	default:
+		return 0, ErrAlgorithm
+	}
+	return uint8((tagSize-2)/2)<<5 | uint8(nonceSize-7)<<2 | k, nil
+}
+
+// ParseHeader reads the header at the front of data without opening it, for
+// example to see which key a message needs.
+func ParseHeader(data []byte) (h Header, err error) {
+	if len(data) < fixedHeaderSize {
+		return h, ErrShortEnvelope
+	}
+	if data[0] != Magic {
+		return h, ErrNotEnvelope
+	}
+	if h.Version = data[1]; h.Version != Version {
+		return h, ErrVersion
+	}
+	alg := data[2]
+	h.TagSize = int(alg>>5)*2 + 2
+	h.NonceSize = int(alg>>2&7) + 7
+	h.KeySize = 16 + 8*int(alg&3)
+	if alg>>5 == 0 || h.NonceSize > 13 || alg&3 == 3 {
+		return h, ErrAlgorithm
+	}
+	h.KeyID = binary.BigEndian.Uint32(data[3:])
+	if len(data) < h.Len()+h.TagSize {
+		return h, ErrShortEnvelope
+	}
+	h.Nonce = data[fixedHeaderSize:h.Len()]
+	return h, nil
+}
+
+// encode appends the header to dst.
+func (h *Header) encode(dst []byte) ([]byte, error) {
+	alg, err := h.Algorithm()
+	if err != nil {
+		return nil, err
+	}
+	dst = append(dst, Magic, Version, alg)
+	dst = binary.BigEndian.AppendUint32(dst, h.KeyID)
+	return append(dst, h.Nonce...), nil
+}
+
+func headerFor(k Key) Header {
+	return Header{Version: Version, TagSize: k.CCM.Overhead(), NonceSize: k.CCM.NonceSize(), KeySize: k.KeySize, KeyID: k.ID}
+}
+
+// Seal encrypts plaintext under the primary key of kr with a random nonce and
+// returns the envelope.  adata is authenticated but not included in the output;
+// the same adata must be passed to Open.  The key's nonce size has to be at least
+// MinSealNonceSize.
+func Seal(kr Keyring, plaintext, adata []byte) ([]byte, error) {
+	k, err := kr.Primary()
+	if err != nil {
+		return nil, err
+	}
+	h := headerFor(k)
+	if h.NonceSize < MinSealNonceSize {
+		return nil, ErrNonceSize
+	}
+	h.Nonce = make([]byte, h.NonceSize)
+	if _, err := io.ReadFull(rand.Reader, h.Nonce); err != nil {
+		return nil, err
+	}
+	out, err := h.encode(make([]byte, 0, h.Len()+len(plaintext)+h.TagSize))
+	if err != nil {
+		return nil, err
+	}
+	n := len(out)
+	out = k.CCM.Seal(out, h.Nonce, plaintext, append(out[:n:n], adata...))
+	if len(out) != n+len(plaintext)+h.TagSize {
+		return nil, ErrSealFailed
+	}
+	return out, nil
+}
+
+// Open finds the key named in the envelope, checks that its parameters match
+// the header and returns the authenticated plaintext.
+func Open(kr Keyring, data, adata []byte) ([]byte, error) {
+	h, err := ParseHeader(data)
+	if err != nil {
+		return nil, err
+	}
+	k, err := kr.Key(h.KeyID)
+	if err != nil {
+		return nil, err
+	}
+	if kh := headerFor(k); kh.TagSize != h.TagSize || kh.NonceSize != h.NonceSize || kh.KeySize != h.KeySize {
+		return nil, ErrAlgorithm
+	}
+	n := h.Len()
+	ad := append(append(make([]byte, 0, n+len(adata)), data[:n]...), adata...)
+	return k.CCM.Open(nil, h.Nonce, data[n:], ad)
+}
+
+/* vim: set noai ts=4 sw=4: */
@@ -0,0 +1,151 @@
+package envelope
+
+import (
+	"bytes"
+	"crypto/aes"
+	"testing"
+
+	"github.com/pschlump/AesCCM"
+	"github.com/pschlump/AesCCM/kdf"
+)
+
+func TestAlgorithm(t *testing.T) {
+	for ii, vv := range []struct {
+		tag, nonce, key int
+		alg             uint8
+		ok              bool
+	}{
+		{16, 13, 16, 0xf8, true},
+		{8, 12, 32, 0x76, true},
+		{4, 7, 24, 0x21, true},
+		{3, 13, 16, 0, false},
+		{16, 14, 16, 0, false},
+		{16, 13, 20, 0, false},
+	} {
+		alg, err := Algorithm(vv.tag, vv.nonce, vv.key)
+		if vv.ok != (err == nil) || alg != vv.alg {
+			t.Errorf("Test %d: got %#x %v", ii, alg, err)
+			continue
+		}
+		if !vv.ok {
+			continue
+		}
+		h, err := ParseHeader(append([]byte{Magic, Version, alg, 0, 0, 0, 1}, make([]byte, vv.nonce+vv.tag)...))
+		if err != nil || h.TagSize != vv.tag || h.NonceSize != vv.nonce || h.KeySize != vv.key || h.KeyID != 1 {
+			t.Errorf("Test %d: ParseHeader returned %+v %v", ii, h, err)
+		}
+	}
+}
+
+func TestSealOpen(t *testing.T) {
+	key := bytes.Repeat([]byte{0x42}, 32)
+	kr, err := NewSingleKey(7, key, 12, 12)
+	if err != nil {
+		t.Fatal(err)
+	}
+	msg, adata := []byte("stored blob"), []byte("row 12")
+
+	env, err := Seal(kr, msg, adata)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(env) != 7+12+len(msg)+12 || env[0] != Magic || env[1] != Version || env[2] != 5<<5|5<<2|2 {
+		t.Fatalf("Seal: bad envelope %x", env)
+	}
+	h, _ := ParseHeader(env)
+	if h.KeyID != 7 || len(h.Nonce) != 12 {
+		t.Errorf("ParseHeader: got %+v", h)
+	}
+
+	// The body is plain CCM with the header in front of the additional data.
+	blk, _ := aes.NewCipher(key)
+	ccm, _ := aesccm.NewCCM(blk, 12, 12)
+	if !bytes.Equal(env[h.Len():], ccm.Seal(nil, h.Nonce, msg, append(env[:h.Len():h.Len()], adata...))) {
+		t.Errorf("Seal: body is not CCM over header || adata")
+	}
+
+	pt, err := Open(kr, env, adata)
+	if err != nil || !bytes.Equal(pt, msg) {
+		t.Errorf("Open: got %q %v", pt, err)
+	}
+	if _, err := Open(kr, env, []byte("row 13")); err == nil {
+		t.Errorf("Open with other adata should have failed")
+	}
+	for pos := 3; pos < len(env); pos++ { // bytes 0-2 are checked by ParseHeader
+		env[pos] ^= 1
+		if _, err := Open(kr, env, adata); err == nil {
+			t.Errorf("Altered byte %d, Open should have failed", pos)
+		}
+		env[pos] ^= 1
+	}
+
+	// A key with other parameters under the same id is not used.
+	other, _ := NewSingleKey(7, key, 16, 12)
+	if _, err := Open(other, env, adata); err != ErrAlgorithm {
+		t.Errorf("Mismatched key: expected ErrAlgorithm, got %v", err)
+	}
+
+	for ii, vv := range []struct {
+		data []byte
+		err  error
+	}{
+		{env[:6], ErrShortEnvelope},
+		{env[:7+12+11], ErrShortEnvelope},
+		{append([]byte{0xCD}, env[1:]...), ErrNotEnvelope},
+		{append([]byte{Magic, 2}, env[2:]...), ErrVersion},
+		{append([]byte{Magic, Version, 0x1b}, env[3:]...), ErrAlgorithm},
+	} {
+		if _, err := Open(kr, vv.data, adata); err != vv.err {
+			t.Errorf("Test %d: expected %v, got %v", ii, vv.err, err)
+		}
+	}
+}
+
+// A key with a nonce too short to pick at random opens, but does not seal.
+func TestShortNonce(t *testing.T) {
+	key := bytes.Repeat([]byte{0x43}, 16)
+	kr, err := NewSingleKey(3, key, 8, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Seal(kr, []byte("msg"), nil); err != ErrNonceSize {
+		t.Errorf("Seal with a 10 byte nonce: got %v", err)
+	}
+
+	h := Header{Version: Version, TagSize: 8, NonceSize: 10, KeySize: 16, KeyID: 3, Nonce: make([]byte, 10)}
+	env, _ := h.encode(nil)
+	blk, _ := aes.NewCipher(key)
+	ccm, _ := aesccm.NewCCM(blk, 8, 10)
+	env = ccm.Seal(env, h.Nonce, []byte("msg"), env)
+	if pt, err := Open(kr, env, nil); err != nil || string(pt) != "msg" {
+		t.Errorf("Open with a 10 byte nonce: got %q %v", pt, err)
+	}
+}
+
+func TestPassword(t *testing.T) {
+	p := kdf.Params{Name: kdf.Argon2id, Iter: 1, Memory: 1024, P: 1}
+	env, err := SealPassword([]byte("hunter2"), p, []byte("secret notes"), []byte("ad"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	p2, salt, n, err := ParsePasswordHeader(env)
+	if err != nil || p2 != p || len(salt) != 16 || env[n] != Magic {
+		t.Fatalf("ParsePasswordHeader: got %+v %x %d %v", p2, salt, n, err)
+	}
+	pt, err := OpenPassword([]byte("hunter2"), env, []byte("ad"))
+	if err != nil || string(pt) != "secret notes" {
+		t.Errorf("OpenPassword: got %q %v", pt, err)
+	}
+	if _, err := OpenPassword([]byte("hunter3"), env, []byte("ad")); err == nil {
+		t.Errorf("OpenPassword with the wrong password should have failed")
+	}
+	if _, err := OpenPasswordLimits([]byte("hunter2"), env, []byte("ad"), kdf.Limits{MaxMemory: 512}); err != kdf.ErrLimit {
+		t.Errorf("OpenPasswordLimits over the memory limit: got %v", err)
+	}
+	env[3] ^= 1 // the KDF parameters are authenticated
+	if _, err := OpenPassword([]byte("hunter2"), env, []byte("ad")); err == nil {
+		t.Errorf("OpenPassword with altered parameters should have failed")
+	}
+}
+
+/* vim: set noai ts=4 sw=4: */
@@ -0,0 +1,16 @@
+package envelope
+
+import "errors"
+
+var ErrShortEnvelope = errors.New("ENVELOPE: envelope too short")
+var ErrNotEnvelope = errors.New("ENVELOPE: not an envelope, bad magic byte")
+var ErrVersion = errors.New("ENVELOPE: unsupported envelope version")
+var ErrAlgorithm = errors.New("ENVELOPE: unsupported or mismatched algorithm")
+var ErrUnknownKey = errors.New("ENVELOPE: unknown key id")
+var ErrNonceSize = errors.New("ENVELOPE: sealing with random nonces needs a 12 or 13 byte nonce")
+var ErrSealFailed = errors.New("ENVELOPE: unable to seal message")
+var ErrKeyWrapSize = errors.New("ENVELOPE: invalid key size for key wrap")
+var ErrKeyUnwrap = errors.New("ENVELOPE: key unwrap failed integrity check")
+var ErrUnknownKEK = errors.New("ENVELOPE: unknown key encryption key")
+
+/* vim: set noai ts=4 sw=4: */
@@ -0,0 +1,134 @@
+package envelope
+
+// AES Key Wrap - RFC 3394 (KW) and RFC 5649 (KWP, with padding).
+//
+// KW wraps keys that are a multiple of 8 bytes, at least 16.  KWP wraps any
+// length from 1 byte up and is what the data key envelopes use.  Both add 8 bytes
+// and authenticate the result with the integrity check in the first 8 bytes.
+//
+// MIT Licensed.
+
+import (
+	"crypto/cipher"
+	"crypto/subtle"
+	"encoding/binary"
+)
+
+var kwIV = [8]byte{0xa6, 0xa6, 0xa6, 0xa6, 0xa6, 0xa6, 0xa6, 0xa6}
+var kwpIV = [4]byte{0xa6, 0x59, 0x59, 0xa6}
+
+// KeyWrap wraps key under kek as in RFC 3394.
+func KeyWrap(kek cipher.Block, key []byte) ([]byte, error) {
+	if len(key) < 16 || len(key)%8 != 0 {
+		return nil, ErrKeyWrapSize
+	}
+	return wrap(kek, kwIV, key), nil
+}
+
+// KeyUnwrap undoes KeyWrap.
+func KeyUnwrap(kek cipher.Block, wrapped []byte) ([]byte, error) {
+	if len(wrapped) < 24 || len(wrapped)%8 != 0 {
+		return nil, ErrKeyWrapSize
+	}
+	a, key := unwrap(kek, wrapped)
+	if subtle.ConstantTimeCompare(a[:], kwIV[:]) != 1 {
+		return nil, ErrKeyUnwrap
+	}
+	return key, nil
+}
+
+// KeyWrapPad wraps key under kek as in RFC 5649.
+func KeyWrapPad(kek cipher.Block, key []byte) ([]byte, error) {
+	if len(key) == 0 || uint64(len(key)) > 1<<32-1 {
+		return nil, ErrKeyWrapSize
+	}
+	var aiv [8]byte
+	copy(aiv[:], kwpIV[:])
+	binary.BigEndian.PutUint32(aiv[4:], uint32(len(key)))
+	padded := make([]byte, (len(key)+7)/8*8)
+	copy(padded, key)
+	if len(padded) == 8 {
+		// One block: encrypt AIV || P with the block cipher directly.
+		out := make([]byte, 16)
+		copy(out, aiv[:])
+		copy(out[8:], padded)
+		kek.Encrypt(out, out)
+		return out, nil
+	}
+	return wrap(kek, aiv, padded), nil
+}
+
+// KeyUnwrapPad undoes KeyWrapPad.
+func KeyUnwrapPad(kek cipher.Block, wrapped []byte) ([]byte, error) {
+	if len(wrapped) < 16 || len(wrapped)%8 != 0 {
+		return nil, ErrKeyWrapSize
+	}
+	var a [8]byte
+	var padded []byte
+	if len(wrapped) == 16 {
+		out := make([]byte, 16)
+		kek.Decrypt(out, wrapped)
+		copy(a[:], out)
+		padded = out[8:]
+	} else {
+		a, padded = unwrap(kek, wrapped)
+	}
+
+	// The AIV must hold the magic value and a length that fits the padded data,
+	// and the padding must be zero.
+	n := int(binary.BigEndian.Uint32(a[4:]))
+	if subtle.ConstantTimeCompare(a[:4], kwpIV[:]) != 1 || n > len(padded) || n <= len(padded)-8 {
+		return nil, ErrKeyUnwrap
+	}
+	var pad byte
+	for _, b := range padded[n:] {
+		pad |= b
+	}
+	if pad != 0 {
+		return nil, ErrKeyUnwrap
+	}
+	return padded[:n], nil
+}
+
+// wrap is the RFC 3394 wrapping process, section 2.2.1, with initial value iv.
+func wrap(kek cipher.Block, iv [8]byte, p []byte) []byte {
+	n := len(p) / 8
+	out := make([]byte, 8+len(p))
+	copy(out[8:], p)
+	var b [16]byte
+	copy(b[:8], iv[:])
+	for j := 0; j < 6; j++ {
+		for i := 1; i <= n; i++ {
+			copy(b[8:], out[8*i:])
+			kek.Encrypt(b[:], b[:])
+			t := uint64(n*j + i)
+			binary.BigEndian.PutUint64(b[:8], binary.BigEndian.Uint64(b[:8])^t)
+			copy(out[8*i:], b[8:])
+		}
+	}
+	copy(out, b[:8])
+	return out
+}
+
+// unwrap is the RFC 3394 unwrapping process, section 2.2.2.  It returns the
+// recovered initial value for the caller to check.
+func unwrap(kek cipher.Block, c []byte) (a [8]byte, p []byte) {
+	n := len(c)/8 - 1
+	p = make([]byte, len(c)-8)
+	copy(p, c[8:])
+	var b [16]byte
+	copy(b[:8], c[:8])
+	for j := 5; j >= 0; j-- {
+		for i := n; i >= 1; i-- {
+			t := uint64(n*j + i)
+			binary.BigEndian.PutUint64(b[:8], binary.BigEndian.Uint64(b[:8])^t)
+			copy(b[8:], p[8*(i-1):])
+			kek.Decrypt(b[:], b[:])
+			copy(p[8*(i-1):], b[8:])
+		}
+	}
+	copy(a[:], b[:8])
+	return a, p
+}
+
+/* vim: set noai ts=4 sw=4: */
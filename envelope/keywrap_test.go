@@ -0,0 +1,129 @@
+package envelope
+
+import (
+	"bytes"
+	"crypto/aes"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestKeyWrap(t *testing.T) {
+	var testData = []struct {
+		pad     bool
+		kek     string
+		key     string
+		wrapped string
+	}{
+		// RFC 3394 sections 4.1 and 4.6
+		{false, "000102030405060708090a0b0c0d0e0f", "00112233445566778899aabbccddeeff", "1fa68b0a8112b447aef34bd8fb5a7b829d3e862371d2cfe5"},
+		{false, "000102030405060708090a0b0c0d0e0f101112131415161718191a1b1c1d1e1f", "00112233445566778899aabbccddeeff000102030405060708090a0b0c0d0e0f", "28c9f404c4b810f4cbccb35cfb87f8263f5786e2d80ed326cbc7f0e71a99f43bfb988b9b7a02dd21"},
+		// RFC 5649 section 6
+		{true, "5840df6e29b02af1ab493b705bf16ea1ae8338f4dcc176a8", "c37b7e6492584340bed12207808941155068f738", "138bdeaa9b8fa7fc61f97742e72248ee5ae6ae5360d1ae6a5f54f373fa543b6a"},
+		{true, "5840df6e29b02af1ab493b705bf16ea1ae8338f4dcc176a8", "466f7250617369", "afbeb0f07dfbf5419200f2ccb50bb24f"},
+	}
+
+	for ii, vv := range testData {
+		kekBytes, _ := hex.DecodeString(vv.kek)
+		key, _ := hex.DecodeString(vv.key)
+		kek, _ := aes.NewCipher(kekBytes)
+		wrapFn, unwrapFn := KeyWrap, KeyUnwrap
+		if vv.pad {
+			wrapFn, unwrapFn = KeyWrapPad, KeyUnwrapPad
+		}
+		wrapped, err := wrapFn(kek, key)
+		if err != nil || hex.EncodeToString(wrapped) != vv.wrapped {
+			t.Errorf("Test %d: wrap got %x %v, expected %s", ii, wrapped, err, vv.wrapped)
+			continue
+		}
+		back, err := unwrapFn(kek, wrapped)
+		if err != nil || !bytes.Equal(back, key) {
+			t.Errorf("Test %d: unwrap got %x %v", ii, back, err)
+		}
+		wrapped[len(wrapped)-1] ^= 1
+		if _, err := unwrapFn(kek, wrapped); err != ErrKeyUnwrap {
+			t.Errorf("Test %d: altered wrapped key, expected ErrKeyUnwrap, got %v", ii, err)
+		}
+	}
+
+	kek, _ := aes.NewCipher(make([]byte, 16))
+	if _, err := KeyWrap(kek, make([]byte, 20)); err != ErrKeyWrapSize {
+		t.Errorf("KeyWrap of 20 bytes: expected ErrKeyWrapSize, got %v", err)
+	}
+	for n := 1; n <= 33; n++ {
+		key := bytes.Repeat([]byte{byte(n)}, n)
+		wrapped, _ := KeyWrapPad(kek, key)
+		if back, err := KeyUnwrapPad(kek, wrapped); err != nil || !bytes.Equal(back, key) {
+			t.Errorf("KWP round trip of %d bytes: got %x %v", n, back, err)
+		}
+	}
+}
+
+// stubKMS stands in for an external KMS in tests.
+type stubKMS struct {
+	keys map[string][]byte
+}
+
+func (s *stubKMS) WrapKey(dataKey []byte) (string, []byte, error) {
+	id := "kms-key-1"
+	s.keys[id+string(dataKey)] = append([]byte(nil), dataKey...)
+	return id, append([]byte("handle:"), dataKey...), nil
+}
+
+func (s *stubKMS) UnwrapKey(kekID string, wrapped []byte) ([]byte, error) {
+	if k, ok := s.keys[kekID+string(wrapped[7:])]; ok {
+		return append([]byte(nil), k...), nil
+	}
+	return nil, ErrUnknownKEK
+}
+
+func TestDataKeyEnvelope(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "kek")
+	os.WriteFile(path, bytes.Repeat([]byte{0x11}, 32), 0600)
+	local, err := LoadKEKFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	content := bytes.Repeat([]byte("a large object "), 10000)
+	for _, w := range []KeyWrapper{local, &stubKMS{keys: map[string][]byte{}}} {
+		e, err := SealDataKey(w, content, []byte("bucket/key"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, err := e.MarshalBinary()
+		if err != nil {
+			t.Fatal(err)
+		}
+		e2, err := ParseDataKeyEnvelope(data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if e2.KEKID != e.KEKID || len(e2.Nonce) != DataKeyNonceSize {
+			t.Errorf("ParseDataKeyEnvelope: got %q %x", e2.KEKID, e2.Nonce)
+		}
+		pt, err := OpenDataKey(w, e2, []byte("bucket/key"))
+		if err != nil || !bytes.Equal(pt, content) {
+			t.Errorf("OpenDataKey with %T: %v", w, err)
+		}
+		if _, err := OpenDataKey(w, e2, []byte("bucket/other")); err == nil {
+			t.Errorf("OpenDataKey with %T and other adata should have failed", w)
+		}
+		if _, err := ParseDataKeyEnvelope(data[:len(e.KEKID)+4]); err != ErrShortEnvelope {
+			t.Errorf("Truncated envelope: expected ErrShortEnvelope, got %v", err)
+		}
+	}
+
+	e, _ := SealDataKey(local, []byte("x"), nil)
+	other, _ := NewAESKeyWrapper(local.ID(), bytes.Repeat([]byte{0x22}, 32))
+	if _, err := OpenDataKey(other, e, nil); err != ErrKeyUnwrap {
+		t.Errorf("Wrong KEK under the same id: expected ErrKeyUnwrap, got %v", err)
+	}
+	e.KEKID = "someone else"
+	if _, err := OpenDataKey(local, e, nil); err != ErrUnknownKEK {
+		t.Errorf("Unknown KEK id: expected ErrUnknownKEK, got %v", err)
+	}
+}
+
+/* vim: set noai ts=4 sw=4: */
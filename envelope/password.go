@@ -0,0 +1,106 @@
+package envelope
+
+// Password envelopes - an envelope sealed under a key derived from a password,
+// with the key derivation parameters and salt written in front of it.
+//
+//	Offset	Size	Contents
+//	0		1		Magic, 0xCE
+//	1		1		Version, 1
+//	2		...		KDF parameters, kdf.Params binary form
+//	...		1		Salt length S
+//	...		S		Salt
+//	...				Envelope sealed with an AES-256 key, 16 byte tag, 13 byte nonce, key id 0
+//
+// Everything in front of the inner envelope is included in its additional data.
+//
+// The data picks the KDF and its cost.  OpenPassword refuses anything over
+// kdf.DefaultLimits; OpenPasswordLimits takes other limits.
+//
+// MIT Licensed.
+
+import (
+	"crypto/rand"
+	"io"
+
+	"github.com/pschlump/AesCCM/kdf"
+)
+
+const PasswordMagic = 0xCE
+const passwordSaltSize = 16
+
+// SealPassword seals plaintext under a key derived from password with p.
+func SealPassword(password []byte, p kdf.Params, plaintext, adata []byte) ([]byte, error) {
+	salt := make([]byte, passwordSaltSize)
+	if _, err := io.ReadFull(rand.Reader, salt); err != nil {
+		return nil, err
+	}
+	prefix, err := p.AppendBinary([]byte{PasswordMagic, Version})
+	if err != nil {
+		return nil, err
+	}
+	prefix = append(append(prefix, byte(len(salt))), salt...)
+
+	kr, err := passwordKeyring(password, p, salt, kdf.DefaultLimits)
+	if err != nil {
+		return nil, err
+	}
+	env, err := Seal(kr, plaintext, append(prefix[:len(prefix):len(prefix)], adata...))
+	if err != nil {
+		return nil, err
+	}
+	return append(prefix, env...), nil
+}
+
+// ParsePasswordHeader returns the KDF parameters and salt of a password envelope
+// and the length of the prefix in front of the inner envelope.
+func ParsePasswordHeader(data []byte) (p kdf.Params, salt []byte, n int, err error) {
+	if len(data) < 2 {
+		return p, nil, 0, ErrShortEnvelope
+	}
+	if data[0] != PasswordMagic {
+		return p, nil, 0, ErrNotEnvelope
+	}
+	if data[1] != Version {
+		return p, nil, 0, ErrVersion
+	}
+	p, n, err = kdf.ParseBinary(data[2:])
+	if err != nil {
+		return p, nil, 0, err
+	}
+	n += 2
+	if len(data) < n+1 || len(data) < n+1+int(data[n]) {
+		return p, nil, 0, ErrShortEnvelope
+	}
+	salt = data[n+1 : n+1+int(data[n])]
+	return p, salt, n + 1 + len(salt), nil
+}
+
+// OpenPassword opens an envelope made by SealPassword, if its KDF is within
+// kdf.DefaultLimits.
+func OpenPassword(password, data, adata []byte) ([]byte, error) {
+	return OpenPasswordLimits(password, data, adata, kdf.DefaultLimits)
+}
+
+// OpenPasswordLimits is OpenPassword with the KDF held to limits.
+func OpenPasswordLimits(password, data, adata []byte, limits kdf.Limits) ([]byte, error) {
+	p, salt, n, err := ParsePasswordHeader(data)
+	if err != nil {
+		return nil, err
+	}
+	kr, err := passwordKeyring(password, p, salt, limits)
+	if err != nil {
+		return nil, err
+	}
+	return Open(kr, data[n:], append(append(make([]byte, 0, n+len(adata)), data[:n]...), adata...))
+}
+
+func passwordKeyring(password []byte, p kdf.Params, salt []byte, limits kdf.Limits) (*SingleKey, error) {
+	key, err := limits.DeriveKey(p, password, salt, 32)
+	if err != nil {
+		return nil, err
+	}
+	defer zero(key)
+	return NewSingleKey(0, key, 16, 13)
+}
+
+/* vim: set noai ts=4 sw=4: */
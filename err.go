@@ -29,5 +29,15 @@ var ErrCiphertextTooLong = errors.New("AESCCM: ciphertext exceeds maximum length
 var ErrCiphertextTooShort = errors.New("AESCCM: ciphertext below minimum length")
 var ErrPlaintextTooLong = errors.New("AESCCM: plaintext exceeds maximum length")
 var ErrInvalidNonceLength = errors.New("AESCCM: invalid nonce length")
+var ErrSealFailed = errors.New("AESCCM: unable to seal message")
+var ErrNonceExhausted = errors.New("AESCCM: nonce counter exhausted")
+var ErrNonceLimit = errors.New("AESCCM: random nonce usage limit reached")
+var ErrCounterStore = errors.New("AESCCM: stored nonce counter has the wrong size")
+var ErrNonceReuse = errors.New("AESCCM: nonce reused with the same key")
+var ErrCommitment = errors.New("AESCCM: key commitment does not match")
+var ErrKeyDestroyed = errors.New("AESCCM: key has been destroyed")
+var ErrKeyMarshal = errors.New("AESCCM: refusing to encode key material")
+var ErrMlockUnsupported = errors.New("AESCCM: locked key memory is not supported on this platform")
+var ErrBatchFailed = errors.New("AESCCM: one or more batch items failed")
 
 /* vim: set noai ts=4 sw=4: */
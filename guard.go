@@ -0,0 +1,156 @@
+// Nonce reuse detection for development and test builds.
+//
+// GuardedAEAD wraps a CCM and remembers every (key id, nonce) pair it has sealed
+// with.  Seal refuses, or panics, on a repeat.  The pairs are kept in a
+// NonceTracker, a map bounded to a fixed number of entries with the oldest
+// dropped first, which can be shared by every wrapper in a process so that two
+// instances sealing under the same key id are checked against each other.
+//
+// This costs a map entry per message and only sees nonces used in this process -
+// it is a test aid, not a replacement for a NonceSource.
+//
+// MIT Licensed
+//
+
+package aesccm
+
+import (
+	"encoding/binary"
+	"sync"
+)
+
+const DefaultNonceTrackerSize = 1 << 20
+
+// NonceTracker remembers the most recent (key id, nonce) pairs.
+type NonceTracker struct {
+	mu      sync.Mutex          //
+	seen    map[string]struct{} //
+	order   []string            // ring of entries in the order they were added
+	next    int                 // position in order to write next
+	evicted uint64              // entries dropped to stay within the bound
+}
+
+// NewNonceTracker returns a tracker that remembers up to size pairs.  A size of 0
+// uses DefaultNonceTrackerSize.
+func NewNonceTracker(size int) *NonceTracker {
+	if size <= 0 {
+		size = DefaultNonceTrackerSize
+	}
+	return &NonceTracker{seen: make(map[string]struct{}), order: make([]string, size)}
+}
+
+// Record adds the pair and reports whether it was already present.
+func (t *NonceTracker) Record(keyID, nonce []byte) (repeat bool) {
+	k := make([]byte, 0, 4+len(keyID)+len(nonce))
+	k = binary.BigEndian.AppendUint32(k, uint32(len(keyID)))
+	k = append(append(k, keyID...), nonce...)
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if _, ok := t.seen[string(k)]; ok {
+		return true
+	}
+	if old := t.order[t.next]; old != "" {
+		delete(t.seen, old)
+		t.evicted++
+	}
+	t.order[t.next] = string(k)
+	t.next = (t.next + 1) % len(t.order)
+	t.seen[string(k)] = struct{}{}
+	return false
+}
+
+// Len returns the number of pairs currently remembered.
+func (t *NonceTracker) Len() int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return len(t.seen)
+}
+
+// Evicted returns the number of pairs dropped to stay within the size bound.
+func (t *NonceTracker) Evicted() uint64 {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.evicted
+}
+
+// GuardStats counts the calls made through a GuardedAEAD.
+type GuardStats struct {
+	Seals  uint64 // successful calls to Seal
+	Opens  uint64 // calls to Open
+	Reuses uint64 // calls to Seal rejected for a repeated nonce
+}
+
+// GuardedAEAD is a CCM that detects nonce reuse in Seal.
+type GuardedAEAD struct {
+	CCM                   // the wrapped CCM
+	Panic   bool          // panic on reuse instead of returning nil from Seal
+	keyID   []byte        //
+	tracker *NonceTracker //
+	mu      sync.Mutex    //
+	stats   GuardStats    //
+	err     error         // error from the last call to Seal
+}
+
+// NewGuardedAEAD wraps c.  keyID names the key c was built with.  A nil tracker
+// gives the wrapper a tracker of its own.
+func NewGuardedAEAD(c CCM, keyID []byte, tracker *NonceTracker) *GuardedAEAD {
+	if tracker == nil {
+		tracker = NewNonceTracker(0)
+	}
+	return &GuardedAEAD{CCM: c, keyID: append([]byte(nil), keyID...), tracker: tracker}
+}
+
+// Seal checks that nonce has not been used with this key id before and then
+// seals as the wrapped CCM does.  On reuse it returns nil and Err returns
+// ErrNonceReuse, or it panics with ErrNonceReuse if Panic is set.
+func (g *GuardedAEAD) Seal(dst, nonce, plaintext, adata []byte) []byte {
+	if ns := g.NonceSize(); len(nonce) > ns {
+		nonce = nonce[:ns] // CCM only uses the front of a long nonce
+	}
+	if g.tracker.Record(g.keyID, nonce) {
+		g.mu.Lock()
+		g.stats.Reuses++
+		g.err = ErrNonceReuse
+		g.mu.Unlock()
+		if g.Panic {
+			panic(ErrNonceReuse)
+		}
+		return nil
+	}
+	n := len(dst)
+	ret := g.CCM.Seal(dst, nonce, plaintext, adata)
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if len(ret) != n+len(plaintext)+g.Overhead() {
+		g.err = ErrSealFailed
+		return ret
+	}
+	g.stats.Seals++
+	g.err = nil
+	return ret
+}
+
+// Open is the wrapped CCM's Open.  It is only counted.
+func (g *GuardedAEAD) Open(dst, nonce, ciphertext, adata []byte) ([]byte, error) {
+	g.mu.Lock()
+	g.stats.Opens++
+	g.mu.Unlock()
+	return g.CCM.Open(dst, nonce, ciphertext, adata)
+}
+
+// Err returns the error from the last call to Seal, nil if it succeeded.
+func (g *GuardedAEAD) Err() error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.err
+}
+
+// Stats returns the counts so far.
+func (g *GuardedAEAD) Stats() GuardStats {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.stats
+}
+
+/* vim: set noai ts=4 sw=4: */
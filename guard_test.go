@@ -0,0 +1,78 @@
+package aesccm
+
+import (
+	"bytes"
+	"crypto/aes"
+	"testing"
+)
+
+func TestGuardedAEAD(t *testing.T) {
+	blk, _ := aes.NewCipher(make([]byte, 16))
+	ccm, _ := NewCCM(blk, 8, 13)
+	tracker := NewNonceTracker(0)
+	g := NewGuardedAEAD(ccm, []byte("key-1"), tracker)
+
+	nonce := make([]byte, 16) // SJCL style, only the first 13 bytes are used
+	msg := []byte("hello")
+	ct := g.Seal(nil, nonce, msg, nil)
+	if g.Err() != nil || !bytes.Equal(ct, ccm.Seal(nil, nonce, msg, nil)) {
+		t.Fatalf("Seal: got %x %v", ct, g.Err())
+	}
+	if pt, err := g.Open(nil, nonce, ct, nil); err != nil || !bytes.Equal(pt, msg) {
+		t.Errorf("Open: got %q %v", pt, err)
+	}
+
+	// Same key id, same nonce - differing only past the 13 bytes CCM uses.
+	nonce[15] = 1
+	if ct := g.Seal(nil, nonce, msg, nil); ct != nil || g.Err() != ErrNonceReuse {
+		t.Errorf("Repeated nonce: got %x %v", ct, g.Err())
+	}
+
+	// A second wrapper for the same key, e.g. after a restart, shares the tracker.
+	g2 := NewGuardedAEAD(ccm, []byte("key-1"), tracker)
+	g2.Panic = true
+	func() {
+		defer func() {
+			if r := recover(); r != ErrNonceReuse {
+				t.Errorf("Expected panic with ErrNonceReuse, got %v", r)
+			}
+		}()
+		g2.Seal(nil, nonce[:13], msg, nil)
+	}()
+
+	// Another key id may use the nonce.
+	g3 := NewGuardedAEAD(ccm, []byte("key-2"), tracker)
+	if ct := g3.Seal(nil, nonce, msg, nil); ct == nil || g3.Err() != nil {
+		t.Errorf("Other key id: got %v", g3.Err())
+	}
+
+	if s := g.Stats(); s != (GuardStats{Seals: 1, Opens: 1, Reuses: 1}) {
+		t.Errorf("Stats: got %+v", s)
+	}
+	if s := g2.Stats(); s.Reuses != 1 || s.Seals != 0 {
+		t.Errorf("Stats: got %+v", s)
+	}
+	if tracker.Len() != 2 {
+		t.Errorf("Tracker Len: got %d expected 2", tracker.Len())
+	}
+}
+
+func TestNonceTrackerBound(t *testing.T) {
+	tracker := NewNonceTracker(2)
+	for i := byte(0); i < 3; i++ {
+		if tracker.Record(nil, []byte{i}) {
+			t.Errorf("Nonce %d reported as a repeat", i)
+		}
+	}
+	if tracker.Len() != 2 || tracker.Evicted() != 1 {
+		t.Errorf("got Len %d Evicted %d", tracker.Len(), tracker.Evicted())
+	}
+	if tracker.Record(nil, []byte{0}) {
+		t.Errorf("Evicted nonce should no longer be remembered")
+	}
+	if !tracker.Record(nil, []byte{2}) {
+		t.Errorf("Nonce 2 should be remembered")
+	}
+}
+
+/* vim: set noai ts=4 sw=4: */
@@ -0,0 +1,9 @@
+package kdf
+
+import "errors"
+
+var ErrUnknownKDF = errors.New("KDF: unknown key derivation function")
+var ErrParams = errors.New("KDF: invalid key derivation parameters")
+var ErrLimit = errors.New("KDF: key derivation cost is over the limit")
+
+/* vim: set noai ts=4 sw=4: */
@@ -0,0 +1,267 @@
+package kdf
+
+// Password based key derivation for CCM keys.
+//
+// SJCL derives its key with PBKDF2-HMAC-SHA256 and only records the iteration
+// count.  For data that only Go code has to read, a memory-hard function is a
+// better choice.  Every KDF here is described by a Params, which is what gets
+// written next to the ciphertext - as extension fields in SJCL JSON, or in binary
+// form in a password envelope - so the reader can pick the same KDF.
+//
+//	Name			Cost parameters
+//	pbkdf2-sha1		Iter
+//	pbkdf2-sha256	Iter (the SJCL default, used when Name is empty)
+//	pbkdf2-sha512	Iter
+//	scrypt			N, R, P
+//	argon2id		Iter (passes), Memory (KiB), P (threads)
+//
+// The parameters come from the data, so whoever wrote it picks the cost of
+// reading it.  New and DeriveKey refuse anything over DefaultLimits; readers that
+// need more, or want less, pass their own Limits.
+//
+// MIT Licensed.
+
+import (
+	"cmp"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/binary"
+	"hash"
+	"slices"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/pbkdf2"
+	"golang.org/x/crypto/scrypt"
+)
+
+// KDF names, as written in the "kdf" field.
+const (
+	PBKDF2SHA1   = "pbkdf2-sha1"
+	PBKDF2SHA256 = "pbkdf2-sha256"
+	PBKDF2SHA512 = "pbkdf2-sha512"
+	Scrypt       = "scrypt"
+	Argon2id     = "argon2id"
+)
+
+// Params names a KDF and its cost.  Fields that do not apply to the KDF are zero.
+type Params struct {
+	Name   string `json:"kdf,omitempty"`  // one of the names above, "" is PBKDF2SHA256
+	Iter   int    `json:"iter,omitempty"` // PBKDF2 iterations, Argon2id passes
+	Memory int    `json:"m,omitempty"`    // Argon2id memory in KiB
+	N      int    `json:"n,omitempty"`    // scrypt CPU/memory cost, a power of 2
+	R      int    `json:"r,omitempty"`    // scrypt block size
+	P      int    `json:"p,omitempty"`    // scrypt parallelism, Argon2id threads
+}
+
+// KDF turns a password and salt into a key.
+type KDF interface {
+	// DeriveKey returns keyLen bytes of key.
+	DeriveKey(password, salt []byte, keyLen int) ([]byte, error)
+
+	// Params returns the parameters that select this KDF again.
+	Params() Params
+}
+
+// Recommended parameters for new data.
+var (
+	DefaultPBKDF2   = Params{Name: PBKDF2SHA256, Iter: 600000}                 // OWASP 2023 for PBKDF2-HMAC-SHA256
+	DefaultScrypt   = Params{Name: Scrypt, N: 1 << 15, R: 8, P: 1}             // RFC 7914 interactive use
+	DefaultArgon2id = Params{Name: Argon2id, Iter: 1, Memory: 64 * 1024, P: 4} // RFC 9106 second recommendation
+)
+
+// Limits caps what a KDF may cost, so data from someone else cannot ask for
+// hours of CPU or gigabytes of memory before the tag is ever checked.  A zero
+// field takes its value from DefaultLimits.
+type Limits struct {
+	MaxIter   int      // PBKDF2 iterations
+	MaxPasses int      // Argon2id passes
+	MaxMemory int      // KiB, Argon2id memory and scrypt's 128*N*R bytes
+	MaxP      int      // scrypt parallelism, Argon2id threads
+	Allow     []string // KDF names to accept, nil for all of them
+}
+
+// DefaultLimits are what New and DeriveKey enforce: well above the recommended
+// parameters, well below anything that would take a server down.
+var DefaultLimits = Limits{MaxIter: 2000000, MaxPasses: 10, MaxMemory: 1 << 20, MaxP: 16}
+
+// New returns the KDF p describes, after checking its parameters and that it is
+// within DefaultLimits.
+func New(p Params) (KDF, error) {
+	return DefaultLimits.New(p)
+}
+
+// DeriveKey is New(p) followed by DeriveKey.
+func DeriveKey(p Params, password, salt []byte, keyLen int) ([]byte, error) {
+	return DefaultLimits.DeriveKey(p, password, salt, keyLen)
+}
+
+// New returns the KDF p describes, after checking its parameters and that it is
+// within l.
+func (l Limits) New(p Params) (KDF, error) {
+	k, err := newKDF(p)
+	if err != nil {
+		return nil, err
+	}
+	if err := l.Check(k.Params()); err != nil {
+		return nil, err
+	}
+	return k, nil
+}
+
+// DeriveKey is l.New(p) followed by DeriveKey.
+func (l Limits) DeriveKey(p Params, password, salt []byte, keyLen int) ([]byte, error) {
+	k, err := l.New(p)
+	if err != nil {
+		return nil, err
+	}
+	return k.DeriveKey(password, salt, keyLen)
+}
+
+// Check returns ErrLimit if p costs more than l allows or names a KDF l does not
+// allow.  It does not check that p is otherwise valid; New does.
+func (l Limits) Check(p Params) error {
+	d := DefaultLimits
+	l.MaxIter, l.MaxPasses, l.MaxMemory, l.MaxP = cmp.Or(l.MaxIter, d.MaxIter), cmp.Or(l.MaxPasses, d.MaxPasses), cmp.Or(l.MaxMemory, d.MaxMemory), cmp.Or(l.MaxP, d.MaxP)
+	if p.Name == "" {
+		p.Name = PBKDF2SHA256
+	}
+	if l.Allow != nil && !slices.Contains(l.Allow, p.Name) && !(p.Name == PBKDF2SHA256 && slices.Contains(l.Allow, "")) {
+		return ErrLimit
+	}
+	switch p.Name {
+	case Scrypt:
+		if uint64(p.N)*uint64(p.R)/8 > uint64(l.MaxMemory) || p.P > l.MaxP {
+			return ErrLimit
+		}
+	case Argon2id:
+		if p.Iter > l.MaxPasses || p.Memory > l.MaxMemory || p.P > l.MaxP {
+			return ErrLimit
+		}
+	default:
+		if p.Iter > l.MaxIter {
+			return ErrLimit
+		}
+	}
+	return nil
+}
+
+// newKDF checks p is valid, without limits.
+func newKDF(p Params) (KDF, error) {
+	switch p.Name {
+	case "", PBKDF2SHA256, PBKDF2SHA1, PBKDF2SHA512:
+		if p.Iter < 1 || p.Memory != 0 || p.N != 0 || p.R != 0 || p.P != 0 {
+			return nil, ErrParams
+		}
+		if p.Name == "" {
+			p.Name = PBKDF2SHA256
+		}
+		return pbkdf2KDF(p), nil
+	case Scrypt:
+		if p.N < 2 || p.N&(p.N-1) != 0 || p.R < 1 || p.P < 1 || p.Iter != 0 || p.Memory != 0 || uint64(p.R)*uint64(p.P) >= 1<<30 {
+			return nil, ErrParams
+		}
+		return scryptKDF(p), nil
+	case Argon2id:
+		if p.Iter < 1 || p.Memory < 8*p.P || p.P < 1 || p.P > 255 || p.N != 0 || p.R != 0 || uint64(p.Memory) > 1<<32-1 {
+			return nil, ErrParams
+		}
+		return argon2idKDF(p), nil
+	}
+	return nil, ErrUnknownKDF
+}
+
+type pbkdf2KDF Params
+
+func (k pbkdf2KDF) Params() Params {
+	return Params(k)
+}
+
+func (k pbkdf2KDF) DeriveKey(password, salt []byte, keyLen int) ([]byte, error) {
+	var h func() hash.Hash
+	switch k.Name {
+	case PBKDF2SHA1:
+		h = sha1.New
+	case PBKDF2SHA512:
+		h = sha512.New
+	default:
+		h = sha256.New
+	}
+	return pbkdf2.Key(password, salt, k.Iter, keyLen, h), nil
+}
+
+type scryptKDF Params
+
+func (k scryptKDF) Params() Params {
+	return Params(k)
+}
+
+func (k scryptKDF) DeriveKey(password, salt []byte, keyLen int) ([]byte, error) {
+	return scrypt.Key(password, salt, k.N, k.R, k.P, keyLen)
+}
+
+type argon2idKDF Params
+
+func (k argon2idKDF) Params() Params {
+	return Params(k)
+}
+
+func (k argon2idKDF) DeriveKey(password, salt []byte, keyLen int) ([]byte, error) {
+	return argon2.IDKey(password, salt, uint32(k.Iter), uint32(k.Memory), uint8(k.P), uint32(keyLen)), nil
+}
+
+/*
+Binary form, for formats that are not JSON:
+
+	id(1) Iter Memory N R P
+
+with the five numbers as uvarints.  The id is the position of the name in
+binaryNames.
+*/
+
+var binaryNames = []string{1: PBKDF2SHA1, 2: PBKDF2SHA256, 3: PBKDF2SHA512, 4: Scrypt, 5: Argon2id}
+
+// AppendBinary appends the binary form of p to dst.
+func (p Params) AppendBinary(dst []byte) ([]byte, error) {
+	name := p.Name
+	if name == "" {
+		name = PBKDF2SHA256
+	}
+	for id, n := range binaryNames {
+		if n != "" && n == name {
+			dst = append(dst, byte(id))
+			for _, v := range []int{p.Iter, p.Memory, p.N, p.R, p.P} {
+				if v < 0 {
+					return nil, ErrParams
+				}
+				dst = binary.AppendUvarint(dst, uint64(v))
+			}
+			return dst, nil
+		}
+	}
+	return nil, ErrUnknownKDF
+}
+
+// ParseBinary reads the binary form of Params from the front of b and returns
+// the number of bytes used.
+func ParseBinary(b []byte) (p Params, n int, err error) {
+	if len(b) < 1 {
+		return p, 0, ErrParams
+	}
+	if int(b[0]) >= len(binaryNames) || binaryNames[b[0]] == "" {
+		return p, 0, ErrUnknownKDF
+	}
+	p.Name = binaryNames[b[0]]
+	n = 1
+	for _, v := range []*int{&p.Iter, &p.Memory, &p.N, &p.R, &p.P} {
+		x, m := binary.Uvarint(b[n:])
+		if m <= 0 || x > 1<<31-1 {
+			return p, 0, ErrParams
+		}
+		*v = int(x)
+		n += m
+	}
+	return p, n, nil
+}
+
+/* vim: set noai ts=4 sw=4: */
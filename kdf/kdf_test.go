@@ -0,0 +1,112 @@
+package kdf
+
+import (
+	"encoding/hex"
+	"testing"
+)
+
+func TestDeriveKey(t *testing.T) {
+	var testData = []struct {
+		params   Params
+		password string
+		salt     string
+		key      string
+	}{
+		// RFC 6070
+		{Params{Name: PBKDF2SHA1, Iter: 2}, "password", "salt", "ea6c014dc72d6f8ccd1ed92ace1d41f0d8de8957"},
+		// Widely published PBKDF2-HMAC-SHA256/512 vectors, checked against OpenSSL
+		{Params{Iter: 1}, "password", "salt", "120fb6cffcf8b32c43e7225256c4f837a86548c92ccc35480805987cb70be17b"},
+		{Params{Name: PBKDF2SHA512, Iter: 1}, "password", "salt", "867f70cf1ade02cff3752599a3a53dc4af34c7a669815ae5d513554e1c8cf252c02d470a285a0501bad999bfe943c08f050235d7d68b1da55e63f73b60a57fce"},
+		// RFC 7914 section 12
+		{Params{Name: Scrypt, N: 1024, R: 8, P: 16}, "password", "NaCl", "fdbabe1c9d3472007856e7190d01e9fe7c6ad7cbc8237830e77376634b3731622eaf30d92e22a3886ff109279d9830dac727afb94a83ee6d8360cbdfa2cc0640"},
+		// phc-winner-argon2 reference CLI
+		{Params{Name: Argon2id, Iter: 2, Memory: 64, P: 2}, "password", "somesalt", "350ac37222f436ccb5c0972f1ebd3bf6b958bf2071841362"},
+	}
+
+	for ii, vv := range testData {
+		k, err := New(vv.params)
+		if err != nil {
+			t.Fatalf("Test %d: %s", ii, err)
+		}
+		key, err := k.DeriveKey([]byte(vv.password), []byte(vv.salt), len(vv.key)/2)
+		if err != nil {
+			t.Fatalf("Test %d: %s", ii, err)
+		}
+		if got := hex.EncodeToString(key); got != vv.key {
+			t.Errorf("Test %d: got %s, expected %s", ii, got, vv.key)
+		}
+
+		b, err := k.Params().AppendBinary([]byte{0xff})
+		if err != nil {
+			t.Fatalf("Test %d: AppendBinary: %s", ii, err)
+		}
+		p, n, err := ParseBinary(append(b[1:], 0xee))
+		if err != nil || n != len(b)-1 || p != k.Params() {
+			t.Errorf("Test %d: ParseBinary returned %+v %d %v", ii, p, n, err)
+		}
+	}
+}
+
+func TestParams(t *testing.T) {
+	for ii, vv := range []struct {
+		params Params
+		err    error
+	}{
+		{Params{}, ErrParams},
+		{Params{Name: "bcrypt", Iter: 10}, ErrUnknownKDF},
+		{Params{Iter: 1000, N: 8}, ErrParams},
+		{Params{Name: Scrypt, N: 1000, R: 8, P: 1}, ErrParams},
+		{Params{Name: Scrypt, N: 1024, R: 8}, ErrParams},
+		{Params{Name: Argon2id, Iter: 1, Memory: 8, P: 2}, ErrParams},
+		{Params{Name: Argon2id, Iter: 1, Memory: 64, P: 256}, ErrParams},
+		{DefaultPBKDF2, nil},
+		{DefaultScrypt, nil},
+		{DefaultArgon2id, nil},
+	} {
+		if _, err := New(vv.params); err != vv.err {
+			t.Errorf("Test %d: expected %v, got %v", ii, vv.err, err)
+		}
+	}
+	if _, _, err := ParseBinary([]byte{9, 0, 0, 0, 0, 0}); err != ErrUnknownKDF {
+		t.Errorf("ParseBinary of unknown id: got %v", err)
+	}
+	if _, _, err := ParseBinary([]byte{2, 0x80}); err != ErrParams {
+		t.Errorf("ParseBinary of truncated data: got %v", err)
+	}
+}
+
+func TestLimits(t *testing.T) {
+	tight := Limits{MaxIter: 1000, MaxMemory: 1024, Allow: []string{PBKDF2SHA256, Scrypt}}
+	for ii, vv := range []struct {
+		limits Limits
+		params Params
+		err    error
+	}{
+		{DefaultLimits, Params{Iter: 2000000}, nil},
+		{DefaultLimits, Params{Iter: 2000001}, ErrLimit},
+		{DefaultLimits, Params{Name: PBKDF2SHA512, Iter: 1 << 30}, ErrLimit},
+		{DefaultLimits, Params{Name: Argon2id, Iter: 1, Memory: 1<<32 - 1, P: 4}, ErrLimit},
+		{DefaultLimits, Params{Name: Argon2id, Iter: 100, Memory: 64, P: 1}, ErrLimit},
+		{DefaultLimits, Params{Name: Argon2id, Iter: 1, Memory: 1024, P: 64}, ErrLimit},
+		{DefaultLimits, Params{Name: Scrypt, N: 1 << 20, R: 8, P: 1}, nil},
+		{DefaultLimits, Params{Name: Scrypt, N: 1 << 21, R: 8, P: 1}, ErrLimit},
+		{DefaultLimits, Params{Name: Scrypt, N: 1024, R: 8, P: 1 << 20}, ErrLimit},
+		{DefaultLimits, Params{Name: "bcrypt", Iter: 10}, ErrUnknownKDF},
+		{tight, Params{Iter: 1000}, nil},
+		{tight, Params{Iter: 1001}, ErrLimit},
+		{tight, Params{Name: PBKDF2SHA1, Iter: 10}, ErrLimit},
+		{tight, Params{Name: Scrypt, N: 1024, R: 8, P: 1}, nil},
+		{tight, Params{Name: Scrypt, N: 2048, R: 8, P: 1}, ErrLimit},
+		{tight, Params{Name: Argon2id, Iter: 1, Memory: 64, P: 1}, ErrLimit},
+		{Limits{MaxIter: 1 << 30}, Params{Iter: 1 << 29}, nil},
+	} {
+		if _, err := vv.limits.New(vv.params); err != vv.err {
+			t.Errorf("Test %d: expected %v, got %v", ii, vv.err, err)
+		}
+	}
+	if _, err := DeriveKey(Params{Iter: 1 << 30}, []byte("password"), []byte("salt"), 16); err != ErrLimit {
+		t.Errorf("DeriveKey over the default limit: got %v", err)
+	}
+}
+
+/* vim: set noai ts=4 sw=4: */
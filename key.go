@@ -0,0 +1,246 @@
+// Key material that can be wiped.
+//
+// A []byte key passed to aes.NewCipher is copied around and lingers until the
+// garbage collector gets to it, and prints happily with %x.  Key owns its bytes:
+//
+//   - it prints as "aesccm.Key(REDACTED)" with every fmt verb and in slog,
+//   - it contains a mutex, so go vet reports code that copies a Key by value,
+//   - Destroy zeroes the bytes and cuts off every CCM made from the key with
+//     Key.NewCCM - Seal then returns nil, Err and Open return ErrKeyDestroyed,
+//   - NewLockedKey keeps the bytes in memory that is locked so it is never
+//     written to swap (Linux only).
+//
+// The key schedule inside the AES cipher.Block is not reachable from here; once a
+// key is destroyed the CCMs drop their reference to it so it can be collected.
+// The Key only holds weak pointers to its CCMs, so a CCM that is dropped without
+// the key being destroyed is collected as usual, and forgotten by the Key.
+//
+// MIT Licensed
+//
+
+package aesccm
+
+import (
+	"crypto/aes"
+	"crypto/rand"
+	"fmt"
+	"io"
+	"log/slog"
+	"runtime"
+	"sync"
+	"weak"
+)
+
+const redactedKey = "aesccm.Key(REDACTED)"
+
+// Key holds secret key bytes.  Use a *Key; do not copy a Key.
+type Key struct {
+	mu        sync.RWMutex                      //
+	b         []byte                            // nil once destroyed
+	locked    bool                              // b is mlock'ed memory from lockedAlloc
+	ccms      map[weak.Pointer[KeyCCM]]struct{} // live instances to cut off on Destroy
+	cleanup   runtime.Cleanup                   // wipes b if the Key is collected without Destroy
+	destroyed bool                              //
+}
+
+// NewKey returns a Key holding a copy of b.  The caller should zero b.
+func NewKey(b []byte) *Key {
+	k := &Key{b: make([]byte, len(b))}
+	copy(k.b, b)
+	k.cleanup = runtime.AddCleanup(k, func(b []byte) { zero(b) }, k.b)
+	return k
+}
+
+// NewLockedKey is NewKey with the bytes in locked memory.  It fails with
+// ErrMlockUnsupported where that is not available, or with the error from
+// mlock(2) if the RLIMIT_MEMLOCK limit is too low.
+func NewLockedKey(b []byte) (*Key, error) {
+	buf, err := lockedAlloc(len(b))
+	if err != nil {
+		return nil, err
+	}
+	copy(buf, b)
+	k := &Key{b: buf, locked: true}
+	k.cleanup = runtime.AddCleanup(k, func(b []byte) { zero(b); lockedFree(b) }, buf)
+	return k, nil
+}
+
+// GenerateKey returns a random key of size bytes.
+func GenerateKey(size int) (*Key, error) {
+	k := NewKey(make([]byte, size))
+	if _, err := io.ReadFull(rand.Reader, k.b); err != nil {
+		k.Destroy()
+		return nil, err
+	}
+	return k, nil
+}
+
+// Len returns the key size in bytes, 0 once destroyed.
+func (k *Key) Len() int {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	return len(k.b)
+}
+
+// Use calls fn with the key bytes.  fn must not keep or modify them.
+func (k *Key) Use(fn func(key []byte) error) error {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	if k.destroyed {
+		return ErrKeyDestroyed
+	}
+	return fn(k.b)
+}
+
+// Destroy zeroes the key, releases locked memory and cuts off the CCMs made
+// from it.  It is safe to call more than once.
+func (k *Key) Destroy() {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	if k.destroyed {
+		return
+	}
+	k.destroyed = true
+	k.cleanup.Stop()
+	zero(k.b)
+	if k.locked {
+		lockedFree(k.b)
+	}
+	k.b = nil
+	for wp := range k.ccms {
+		if c := wp.Value(); c != nil {
+			c.mu.Lock()
+			c.ccm = nil
+			c.mu.Unlock()
+		}
+	}
+	k.ccms = nil
+}
+
+// Destroyed reports whether Destroy has been called.
+func (k *Key) Destroyed() bool {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	return k.destroyed
+}
+
+func (k *Key) String() string {
+	return redactedKey
+}
+
+func (k *Key) GoString() string {
+	return redactedKey
+}
+
+// Format keeps every fmt verb, %x included, from printing the key.
+func (k *Key) Format(f fmt.State, verb rune) {
+	io.WriteString(f, redactedKey)
+}
+
+// LogValue keeps log/slog from printing the key.
+func (k *Key) LogValue() slog.Value {
+	return slog.StringValue(redactedKey)
+}
+
+// MarshalText refuses to encode the key, so it cannot end up in JSON by mistake.
+func (k *Key) MarshalText() ([]byte, error) {
+	return nil, ErrKeyMarshal
+}
+
+// NewCCM returns AES in CCM mode with this key.  The CCM stops working when the
+// key is destroyed.
+func (k *Key) NewCCM(TagSize int, NonceSize int) (*KeyCCM, error) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	if k.destroyed {
+		return nil, ErrKeyDestroyed
+	}
+	blk, err := aes.NewCipher(k.b)
+	if err != nil {
+		return nil, err
+	}
+	ccm, err := newCCMType(blk, TagSize, NonceSize)
+	if err != nil {
+		return nil, err
+	}
+	c := &KeyCCM{ccm: ccm, nonceSize: NonceSize, tagSize: TagSize}
+	ref := keyCCMRef{key: weak.Make(k), ccm: weak.Make(c)}
+	if k.ccms == nil {
+		k.ccms = make(map[weak.Pointer[KeyCCM]]struct{})
+	}
+	k.ccms[ref.ccm] = struct{}{}
+	runtime.AddCleanup(c, keyCCMRef.forget, ref)
+	return c, nil
+}
+
+// keyCCMRef lets the cleanup of a collected KeyCCM take it out of its Key,
+// without keeping either of them alive.
+type keyCCMRef struct {
+	key weak.Pointer[Key]
+	ccm weak.Pointer[KeyCCM]
+}
+
+func (ref keyCCMRef) forget() {
+	if k := ref.key.Value(); k != nil {
+		k.mu.Lock()
+		delete(k.ccms, ref.ccm)
+		k.mu.Unlock()
+	}
+}
+
+// KeyCCM is a CCM that is cut off from its key when the key is destroyed.
+type KeyCCM struct {
+	mu        sync.RWMutex //
+	ccm       *CCMType     // nil once the key is destroyed
+	nonceSize int          //
+	tagSize   int          //
+}
+
+func (c *KeyCCM) NonceSize() int {
+	return c.nonceSize
+}
+
+func (c *KeyCCM) Overhead() int {
+	return c.tagSize
+}
+
+func (c *KeyCCM) MaxLength() int {
+	return maximumLengthForMessage(uint64(15-c.nonceSize), uint64(c.tagSize))
+}
+
+// Seal returns nil once the key has been destroyed; Err says why.
+func (c *KeyCCM) Seal(dst, nonce, plaintext, adata []byte) []byte {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	if c.ccm == nil {
+		return nil
+	}
+	return c.ccm.Seal(dst, nonce, plaintext, adata)
+}
+
+func (c *KeyCCM) Open(dst, nonce, ciphertext, adata []byte) ([]byte, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	if c.ccm == nil {
+		return nil, ErrKeyDestroyed
+	}
+	return c.ccm.Open(dst, nonce, ciphertext, adata)
+}
+
+// Err returns ErrKeyDestroyed once the key has been destroyed, nil before.
+func (c *KeyCCM) Err() error {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	if c.ccm == nil {
+		return ErrKeyDestroyed
+	}
+	return nil
+}
+
+func zero(b []byte) {
+	for i := range b {
+		b[i] = 0
+	}
+}
+
+/* vim: set noai ts=4 sw=4: */
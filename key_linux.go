@@ -0,0 +1,33 @@
+// Locked memory for Key on Linux - an anonymous private mapping that is
+// mlock(2)'ed so the key is never written to swap.
+//
+// MIT Licensed
+//
+
+package aesccm
+
+import "syscall"
+
+func lockedAlloc(n int) ([]byte, error) {
+	size := n
+	if size == 0 {
+		size = 1
+	}
+	b, err := syscall.Mmap(-1, 0, size, syscall.PROT_READ|syscall.PROT_WRITE, syscall.MAP_ANON|syscall.MAP_PRIVATE)
+	if err != nil {
+		return nil, err
+	}
+	if err := syscall.Mlock(b); err != nil {
+		syscall.Munmap(b)
+		return nil, err
+	}
+	return b[:n], nil
+}
+
+func lockedFree(b []byte) {
+	b = b[:cap(b)]
+	syscall.Munlock(b)
+	syscall.Munmap(b)
+}
+
+/* vim: set noai ts=4 sw=4: */
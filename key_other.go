@@ -0,0 +1,17 @@
+//go:build !linux
+
+// Locked memory for Key is only implemented on Linux.
+//
+// MIT Licensed
+//
+
+package aesccm
+
+func lockedAlloc(n int) ([]byte, error) {
+	return nil, ErrMlockUnsupported
+}
+
+func lockedFree(b []byte) {
+}
+
+/* vim: set noai ts=4 sw=4: */
@@ -0,0 +1,125 @@
+package aesccm
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"runtime"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestKey(t *testing.T) {
+	raw := bytes.Repeat([]byte{0xab}, 16)
+	k := NewKey(raw)
+
+	for _, format := range []string{"%v", "%+v", "%#v", "%s", "%x", "%X", "%q", "%d"} {
+		if got := fmt.Sprintf(format, k); got != redactedKey {
+			t.Errorf("Sprintf(%q): got %q", format, got)
+		}
+	}
+	var log strings.Builder
+	slog.New(slog.NewTextHandler(&log, nil)).Info("msg", "key", k)
+	if strings.Contains(log.String(), "abab") || !strings.Contains(log.String(), "REDACTED") {
+		t.Errorf("slog output: %s", log.String())
+	}
+	if _, err := json.Marshal(struct{ K *Key }{k}); err == nil {
+		t.Errorf("json.Marshal of a Key should have failed")
+	}
+
+	ccm, err := k.NewCCM(16, 13)
+	if err != nil {
+		t.Fatal(err)
+	}
+	nonce := make([]byte, 13)
+	ct := ccm.Seal(nil, nonce, []byte("hi"), nil)
+	if ct == nil || ccm.Err() != nil {
+		t.Fatalf("Seal failed: %v", ccm.Err())
+	}
+	if err := k.Use(func(b []byte) error {
+		if !bytes.Equal(b, raw) {
+			t.Errorf("Use: got the wrong bytes")
+		}
+		return nil
+	}); err != nil {
+		t.Errorf("Use: %s", err)
+	}
+
+	buf := k.b
+	k.Destroy()
+	k.Destroy()
+	if !bytes.Equal(buf, make([]byte, 16)) || !k.Destroyed() || k.Len() != 0 {
+		t.Errorf("Destroy did not zero the key: %x", buf)
+	}
+	if ccm.Seal(nil, nonce, []byte("hi"), nil) != nil || ccm.Err() != ErrKeyDestroyed {
+		t.Errorf("Seal after Destroy should return nil, Err got %v", ccm.Err())
+	}
+	if _, err := ccm.Open(nil, nonce, ct, nil); err != ErrKeyDestroyed {
+		t.Errorf("Open after Destroy: expected ErrKeyDestroyed, got %v", err)
+	}
+	if _, err := k.NewCCM(16, 13); err != ErrKeyDestroyed {
+		t.Errorf("NewCCM after Destroy: expected ErrKeyDestroyed, got %v", err)
+	}
+	if err := k.Use(func([]byte) error { return nil }); err != ErrKeyDestroyed {
+		t.Errorf("Use after Destroy: expected ErrKeyDestroyed, got %v", err)
+	}
+}
+
+// A long lived Key does not hold on to the CCMs made from it.
+func TestKeyCCMsCollected(t *testing.T) {
+	k := NewKey(bytes.Repeat([]byte{0xcd}, 16))
+	defer k.Destroy()
+	for i := 0; i < 1000; i++ {
+		if _, err := k.NewCCM(16, 13); err != nil {
+			t.Fatal(err)
+		}
+	}
+	kept, _ := k.NewCCM(8, 12)
+	n := 0
+	for i := 0; i < 100; i++ {
+		runtime.GC()
+		k.mu.RLock()
+		n = len(k.ccms)
+		k.mu.RUnlock()
+		if n == 1 {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if n != 1 {
+		t.Errorf("Key still tracks %d CCMs, expected 1", n)
+	}
+	k.Destroy()
+	if kept.Err() != ErrKeyDestroyed {
+		t.Errorf("The CCM still in use was not cut off")
+	}
+}
+
+func TestLockedKey(t *testing.T) {
+	k, err := NewLockedKey(bytes.Repeat([]byte{1}, 32))
+	switch err {
+	case nil:
+	case ErrMlockUnsupported, syscall.EPERM, syscall.ENOMEM:
+		t.Skipf("locked memory not available: %s", err)
+	default:
+		t.Fatal(err)
+	}
+	ccm, err := k.NewCCM(8, 12)
+	if err != nil {
+		t.Fatal(err)
+	}
+	nonce := make([]byte, 12)
+	ct := ccm.Seal(nil, nonce, []byte("locked"), nil)
+	if pt, err := ccm.Open(nil, nonce, ct, nil); err != nil || string(pt) != "locked" {
+		t.Errorf("Open: got %q %v", pt, err)
+	}
+	k.Destroy()
+	if k.Len() != 0 {
+		t.Errorf("Destroy left %d bytes", k.Len())
+	}
+}
+
+/* vim: set noai ts=4 sw=4: */
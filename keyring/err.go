@@ -0,0 +1,11 @@
+package keyring
+
+import "errors"
+
+var ErrNoPrimary = errors.New("KEYRING: no primary key")
+var ErrPrimaryKey = errors.New("KEYRING: the primary key cannot be disabled or destroyed")
+var ErrKeyDisabled = errors.New("KEYRING: key is disabled")
+var ErrKeyDestroyed = errors.New("KEYRING: key has been destroyed")
+var ErrBadExport = errors.New("KEYRING: invalid exported keyring")
+
+/* vim: set noai ts=4 sw=4: */
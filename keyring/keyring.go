@@ -0,0 +1,341 @@
+package keyring
+
+// A set of AES-CCM keys indexed by key id, for key rotation.
+//
+// New messages are sealed with the primary key.  Older keys stay in the ring so
+// messages sealed with them can still be opened, until they are disabled (kept,
+// but refused) or destroyed (key bytes zeroed, only the id is kept so it is never
+// handed out again).
+//
+// Keyring implements envelope.Keyring, so envelope.Seal and envelope.Open work
+// with it directly.  envelope.Seal picks nonces at random, so only a key with a
+// nonce of envelope.MinSealNonceSize or more can be the primary key; shorter ones
+// are kept for opening.  Export and Import save the ring itself as an envelope sealed
+// under a master key.
+//
+// MIT Licensed.
+
+import (
+	"crypto/aes"
+	"crypto/rand"
+	"encoding/binary"
+	"io"
+	"sort"
+	"sync"
+
+	"github.com/pschlump/AesCCM"
+	"github.com/pschlump/AesCCM/envelope"
+)
+
+// Status of a key in the ring.
+type Status uint8
+
+const (
+	Enabled   Status = 1 // usable for Open, and for Seal when primary
+	Disabled  Status = 2 // kept, but refused until enabled again
+	Destroyed Status = 3 // key bytes zeroed, the id is reserved
+)
+
+func (s Status) String() string {
+	switch s {
+	case Enabled:
+		return "enabled"
+	case Disabled:
+		return "disabled"
+	case Destroyed:
+		return "destroyed"
+	}
+	return "unknown"
+}
+
+type entry struct {
+	id        uint32     //
+	status    Status     //
+	key       []byte     // raw key bytes, kept for Export
+	tagSize   int        //
+	nonceSize int        //
+	ccm       aesccm.CCM // nil once destroyed
+}
+
+// KeyInfo describes a key without exposing it.
+type KeyInfo struct {
+	ID        uint32
+	Status    Status
+	Primary   bool
+	KeySize   int
+	TagSize   int
+	NonceSize int
+}
+
+// Keyring holds the keys.  It is safe for concurrent use.
+type Keyring struct {
+	mu      sync.RWMutex      //
+	keys    map[uint32]*entry //
+	primary uint32            // 0 if there is no primary key yet
+	lastID  uint32            // ids are handed out in increasing order from 1
+}
+
+// New returns an empty keyring.
+func New() *Keyring {
+	return &Keyring{keys: make(map[uint32]*entry)}
+}
+
+// Add puts a copy of key into the ring with the given CCM parameters and returns
+// its id.  The first key added that can seal becomes the primary key.
+func (kr *Keyring) Add(key []byte, tagSize, nonceSize int) (uint32, error) {
+	e := &entry{status: Enabled, key: append([]byte(nil), key...), tagSize: tagSize, nonceSize: nonceSize}
+	if err := e.setup(); err != nil {
+		return 0, err
+	}
+	kr.mu.Lock()
+	defer kr.mu.Unlock()
+	kr.lastID++
+	e.id = kr.lastID
+	kr.keys[e.id] = e
+	if kr.primary == 0 && e.nonceSize >= envelope.MinSealNonceSize {
+		kr.primary = e.id
+	}
+	return e.id, nil
+}
+
+// Generate adds a random key of keySize bytes and returns its id.
+func (kr *Keyring) Generate(keySize, tagSize, nonceSize int) (uint32, error) {
+	key := make([]byte, keySize)
+	defer zero(key)
+	if _, err := io.ReadFull(rand.Reader, key); err != nil {
+		return 0, err
+	}
+	return kr.Add(key, tagSize, nonceSize)
+}
+
+func (e *entry) setup() error {
+	blk, err := aes.NewCipher(e.key)
+	if err != nil {
+		return err
+	}
+	e.ccm, err = aesccm.NewCCM(blk, e.tagSize, e.nonceSize)
+	return err
+}
+
+// Promote makes id the primary key.  It must be enabled, with a nonce of at
+// least envelope.MinSealNonceSize.
+func (kr *Keyring) Promote(id uint32) error {
+	kr.mu.Lock()
+	defer kr.mu.Unlock()
+	e, err := kr.lookup(id)
+	if err != nil {
+		return err
+	}
+	if e.nonceSize < envelope.MinSealNonceSize {
+		return envelope.ErrNonceSize
+	}
+	kr.primary = e.id
+	return nil
+}
+
+// Disable stops id being used to open messages.  The primary key cannot be
+// disabled - promote another key first.
+func (kr *Keyring) Disable(id uint32) error {
+	kr.mu.Lock()
+	defer kr.mu.Unlock()
+	return kr.setStatus(id, Disabled)
+}
+
+// Enable undoes Disable.
+func (kr *Keyring) Enable(id uint32) error {
+	kr.mu.Lock()
+	defer kr.mu.Unlock()
+	return kr.setStatus(id, Enabled)
+}
+
+// Destroy zeroes the key bytes of id and forgets its CCM.  Messages sealed with
+// it can no longer be opened.  The primary key cannot be destroyed.
+func (kr *Keyring) Destroy(id uint32) error {
+	kr.mu.Lock()
+	defer kr.mu.Unlock()
+	if err := kr.setStatus(id, Destroyed); err != nil {
+		return err
+	}
+	e := kr.keys[id]
+	zero(e.key)
+	e.key, e.ccm = nil, nil
+	return nil
+}
+
+func (kr *Keyring) setStatus(id uint32, s Status) error {
+	e, ok := kr.keys[id]
+	if !ok {
+		return envelope.ErrUnknownKey
+	}
+	if e.status == Destroyed {
+		return ErrKeyDestroyed
+	}
+	if id == kr.primary && s != Enabled {
+		return ErrPrimaryKey
+	}
+	e.status = s
+	return nil
+}
+
+// lookup returns the entry for id if it is enabled.
+func (kr *Keyring) lookup(id uint32) (*entry, error) {
+	e, ok := kr.keys[id]
+	switch {
+	case !ok:
+		return nil, envelope.ErrUnknownKey
+	case e.status == Disabled:
+		return nil, ErrKeyDisabled
+	case e.status == Destroyed:
+		return nil, ErrKeyDestroyed
+	}
+	return e, nil
+}
+
+func (e *entry) envelopeKey() envelope.Key {
+	return envelope.Key{ID: e.id, KeySize: len(e.key), CCM: e.ccm}
+}
+
+// Primary returns the key to seal with.  Part of envelope.Keyring.
+func (kr *Keyring) Primary() (envelope.Key, error) {
+	kr.mu.RLock()
+	defer kr.mu.RUnlock()
+	if kr.primary == 0 {
+		return envelope.Key{}, ErrNoPrimary
+	}
+	e, err := kr.lookup(kr.primary)
+	if err != nil {
+		return envelope.Key{}, err
+	}
+	return e.envelopeKey(), nil
+}
+
+// Key returns the enabled key id.  Part of envelope.Keyring.
+func (kr *Keyring) Key(id uint32) (envelope.Key, error) {
+	kr.mu.RLock()
+	defer kr.mu.RUnlock()
+	e, err := kr.lookup(id)
+	if err != nil {
+		return envelope.Key{}, err
+	}
+	return e.envelopeKey(), nil
+}
+
+// Keys lists the keys in id order.
+func (kr *Keyring) Keys() []KeyInfo {
+	kr.mu.RLock()
+	defer kr.mu.RUnlock()
+	rv := make([]KeyInfo, 0, len(kr.keys))
+	for _, id := range kr.idsLocked() {
+		e := kr.keys[id]
+		rv = append(rv, KeyInfo{ID: e.id, Status: e.status, Primary: e.id == kr.primary, KeySize: len(e.key), TagSize: e.tagSize, NonceSize: e.nonceSize})
+	}
+	return rv
+}
+
+// Seal is envelope.Seal with this keyring.
+func (kr *Keyring) Seal(plaintext, adata []byte) ([]byte, error) {
+	return envelope.Seal(kr, plaintext, adata)
+}
+
+// Open is envelope.Open with this keyring.
+func (kr *Keyring) Open(data, adata []byte) ([]byte, error) {
+	return envelope.Open(kr, data, adata)
+}
+
+/*
+Export format, sealed as an envelope under the master key with exportAdata:
+
+	version(1) primary(4) lastID(4) count(4)
+	count times: id(4) status(1) tagSize(1) nonceSize(1) keySize(1) key(keySize)
+
+Destroyed keys are written with a key size of 0.
+*/
+
+const exportVersion = 1
+
+var exportAdata = []byte("aesccm keyring")
+
+// Export returns the keyring, keys included, sealed under master.
+func (kr *Keyring) Export(master envelope.Keyring) ([]byte, error) {
+	kr.mu.RLock()
+	size := 13
+	for _, e := range kr.keys {
+		size += 8 + len(e.key)
+	}
+	buf := append(make([]byte, 0, size), exportVersion) // sized up front so no copy of the keys is left behind
+	buf = binary.BigEndian.AppendUint32(buf, kr.primary)
+	buf = binary.BigEndian.AppendUint32(buf, kr.lastID)
+	buf = binary.BigEndian.AppendUint32(buf, uint32(len(kr.keys)))
+	for _, id := range kr.idsLocked() {
+		e := kr.keys[id]
+		buf = binary.BigEndian.AppendUint32(buf, e.id)
+		buf = append(buf, byte(e.status), byte(e.tagSize), byte(e.nonceSize), byte(len(e.key)))
+		buf = append(buf, e.key...)
+	}
+	kr.mu.RUnlock()
+	defer zero(buf)
+	return envelope.Seal(master, buf, exportAdata)
+}
+
+func (kr *Keyring) idsLocked() []uint32 {
+	ids := make([]uint32, 0, len(kr.keys))
+	for id := range kr.keys {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	return ids
+}
+
+// Import opens a keyring saved by Export.
+func Import(master envelope.Keyring, data []byte) (*Keyring, error) {
+	buf, err := envelope.Open(master, data, exportAdata)
+	if err != nil {
+		return nil, err
+	}
+	defer zero(buf)
+	if len(buf) < 13 || buf[0] != exportVersion {
+		return nil, ErrBadExport
+	}
+	kr := New()
+	kr.primary = binary.BigEndian.Uint32(buf[1:])
+	kr.lastID = binary.BigEndian.Uint32(buf[5:])
+	n := binary.BigEndian.Uint32(buf[9:])
+	buf = buf[13:]
+	for i := uint32(0); i < n; i++ {
+		if len(buf) < 8 || len(buf) < 8+int(buf[7]) {
+			return nil, ErrBadExport
+		}
+		e := &entry{id: binary.BigEndian.Uint32(buf), status: Status(buf[4]), tagSize: int(buf[5]), nonceSize: int(buf[6])}
+		e.key = append([]byte(nil), buf[8:8+int(buf[7])]...)
+		buf = buf[8+len(e.key):]
+		switch {
+		case e.status == Destroyed && len(e.key) == 0:
+			e.key = nil
+		case e.status == Enabled || e.status == Disabled:
+			if err := e.setup(); err != nil {
+				return nil, ErrBadExport
+			}
+		default:
+			return nil, ErrBadExport
+		}
+		if _, dup := kr.keys[e.id]; dup || e.id == 0 || e.id > kr.lastID {
+			return nil, ErrBadExport
+		}
+		kr.keys[e.id] = e
+	}
+	if len(buf) != 0 {
+		return nil, ErrBadExport
+	}
+	if p, ok := kr.keys[kr.primary]; kr.primary != 0 && (!ok || p.status != Enabled) {
+		return nil, ErrBadExport
+	}
+	return kr, nil
+}
+
+func zero(b []byte) {
+	for i := range b {
+		b[i] = 0
+	}
+}
+
+/* vim: set noai ts=4 sw=4: */
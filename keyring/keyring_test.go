@@ -0,0 +1,186 @@
+package keyring
+
+import (
+	"bytes"
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/pschlump/AesCCM/envelope"
+)
+
+func TestRotation(t *testing.T) {
+	kr := New()
+	if _, err := kr.Seal([]byte("x"), nil); err != ErrNoPrimary {
+		t.Errorf("Empty keyring: expected ErrNoPrimary, got %v", err)
+	}
+	id1, err := kr.Generate(16, 16, 13)
+	if err != nil {
+		t.Fatal(err)
+	}
+	old, err := kr.Seal([]byte("sealed in Q1"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Rotate: new data uses the new key, old data still opens.
+	id2, _ := kr.Generate(32, 8, 12)
+	if err := kr.Promote(id2); err != nil {
+		t.Fatal(err)
+	}
+	cur, _ := kr.Seal([]byte("sealed in Q2"), nil)
+	if h, _ := envelope.ParseHeader(cur); h.KeyID != id2 || h.KeySize != 32 || h.TagSize != 8 {
+		t.Errorf("New message sealed with %+v, expected key %d", h, id2)
+	}
+	if pt, err := kr.Open(old, nil); err != nil || string(pt) != "sealed in Q1" {
+		t.Errorf("Open of old message: %q %v", pt, err)
+	}
+
+	if err := kr.Disable(id2); err != ErrPrimaryKey {
+		t.Errorf("Disable primary: expected ErrPrimaryKey, got %v", err)
+	}
+	if err := kr.Disable(id1); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := kr.Open(old, nil); err != ErrKeyDisabled {
+		t.Errorf("Open with disabled key: expected ErrKeyDisabled, got %v", err)
+	}
+	if err := kr.Promote(id1); err != ErrKeyDisabled {
+		t.Errorf("Promote disabled key: expected ErrKeyDisabled, got %v", err)
+	}
+	kr.Enable(id1)
+	if _, err := kr.Open(old, nil); err != nil {
+		t.Errorf("Open after Enable: %v", err)
+	}
+
+	if err := kr.Destroy(id1); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := kr.Open(old, nil); err != ErrKeyDestroyed {
+		t.Errorf("Open with destroyed key: expected ErrKeyDestroyed, got %v", err)
+	}
+	if err := kr.Enable(id1); err != ErrKeyDestroyed {
+		t.Errorf("Enable destroyed key: expected ErrKeyDestroyed, got %v", err)
+	}
+	if _, err := kr.Key(99); err != envelope.ErrUnknownKey {
+		t.Errorf("Unknown key: expected envelope.ErrUnknownKey, got %v", err)
+	}
+
+	// Destroyed ids are not handed out again.
+	if id3, _ := kr.Generate(24, 16, 13); id3 != 3 {
+		t.Errorf("Expected id 3, got %d", id3)
+	}
+	info := kr.Keys()
+	if len(info) != 3 || info[0].Status != Destroyed || info[0].KeySize != 0 || !info[1].Primary || info[2].KeySize != 24 {
+		t.Errorf("Keys: got %+v", info)
+	}
+}
+
+// A key whose nonce is too short to pick at random is only kept for Open.
+func TestShortNonceKey(t *testing.T) {
+	kr := New()
+	short, _ := kr.Generate(16, 16, 8)
+	if _, err := kr.Seal([]byte("x"), nil); err != ErrNoPrimary {
+		t.Errorf("An 8 byte nonce key should not become primary, Seal got %v", err)
+	}
+	if err := kr.Promote(short); err != envelope.ErrNonceSize {
+		t.Errorf("Promote of an 8 byte nonce key: expected ErrNonceSize, got %v", err)
+	}
+	long, _ := kr.Generate(16, 16, 12)
+	if info := kr.Keys(); info[0].Primary || !info[1].Primary || info[1].ID != long {
+		t.Errorf("Keys: got %+v", info)
+	}
+}
+
+func TestExportImport(t *testing.T) {
+	kr := New()
+	id1, _ := kr.Add(bytes.Repeat([]byte{1}, 16), 16, 13)
+	id2, _ := kr.Add(bytes.Repeat([]byte{2}, 32), 12, 12)
+	id3, _ := kr.Add(bytes.Repeat([]byte{3}, 24), 8, 7)
+	kr.Promote(id2)
+	kr.Disable(id3)
+	kr.Destroy(id1)
+	msg, _ := kr.Seal([]byte("hello"), []byte("ad"))
+
+	master, _ := envelope.NewSingleKey(1, bytes.Repeat([]byte{0xee}, 32), 16, 13)
+	data, err := kr.Export(master)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(data, bytes.Repeat([]byte{2}, 32)) {
+		t.Errorf("Export contains a key in the clear")
+	}
+
+	kr2, err := Import(master, data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pt, err := kr2.Open(msg, []byte("ad")); err != nil || string(pt) != "hello" {
+		t.Errorf("Open with imported keyring: %q %v", pt, err)
+	}
+	a, b := kr.Keys(), kr2.Keys()
+	if len(a) != len(b) {
+		t.Fatalf("Keys: %+v != %+v", a, b)
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			t.Errorf("Key %d: %+v != %+v", i, a[i], b[i])
+		}
+	}
+	if id, _ := kr2.Generate(16, 16, 13); id != 4 {
+		t.Errorf("Imported keyring handed out id %d, expected 4", id)
+	}
+
+	otherMaster, _ := envelope.NewSingleKey(1, bytes.Repeat([]byte{0xef}, 32), 16, 13)
+	if _, err := Import(otherMaster, data); err == nil {
+		t.Errorf("Import with the wrong master key should have failed")
+	}
+	if _, err := Import(master, msg); err == nil {
+		t.Errorf("Import of a message that is not a keyring should have failed")
+	}
+}
+
+// Seal, Open and rotation from many goroutines at once; run with -race.
+func TestConcurrent(t *testing.T) {
+	kr := New()
+	if _, err := kr.Generate(32, 16, 13); err != nil {
+		t.Fatal(err)
+	}
+	var wg sync.WaitGroup
+	for g := 0; g < 8; g++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 200; i++ {
+				msg := []byte(fmt.Sprintf("goroutine %d message %d", g, i))
+				env, err := kr.Seal(msg, []byte("ad"))
+				if err != nil {
+					t.Errorf("Seal %d/%d: %v", g, i, err)
+					return
+				}
+				if pt, err := kr.Open(env, []byte("ad")); err != nil || !bytes.Equal(pt, msg) {
+					t.Errorf("Open %d/%d: %q %v", g, i, pt, err)
+					return
+				}
+			}
+		}()
+	}
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 10; i++ {
+			id, err := kr.Generate(16, 8, 12)
+			if err == nil {
+				err = kr.Promote(id)
+			}
+			if err != nil {
+				t.Errorf("Rotate %d: %v", i, err)
+				return
+			}
+			kr.Keys()
+		}
+	}()
+	wg.Wait()
+}
+
+/* vim: set noai ts=4 sw=4: */
@@ -0,0 +1,118 @@
+package matter
+
+// Message counter replay protection - Matter Core Specification 4.6.5 "Message
+// Reception State".
+//
+// The receiver remembers the largest counter seen from a peer and a bitmap of the
+// CounterWindowSize counters below it.  A counter is a duplicate if it has been
+// seen or if it is older than the window.  Encrypted unicast sessions never roll
+// the counter over; group sessions (and unsecured ones) may, in which case counters
+// are compared modulo 2^32.
+//
+// MIT Licensed.
+
+import "sync"
+
+const CounterWindowSize = 32
+
+// ReceptionState tracks the message counters received from one peer.
+type ReceptionState struct {
+	mu       sync.Mutex //
+	max      uint32     // largest counter accepted
+	bitmap   uint32     // bit i set means counter max-(i+1) has been accepted
+	synced   bool       // false until the first counter is accepted
+	rollover bool       // counters may wrap - group sessions
+}
+
+// NewReceptionState returns a state that accepts the first counter it sees and
+// synchronizes on it.  Set rollover for group sessions.
+func NewReceptionState(rollover bool) *ReceptionState {
+	return &ReceptionState{rollover: rollover}
+}
+
+// NewSyncedReceptionState returns a state that is already synchronized with a peer
+// whose largest known counter is max - for example from a group key's MCSP exchange.
+func NewSyncedReceptionState(max uint32, rollover bool) *ReceptionState {
+	return &ReceptionState{max: max, synced: true, rollover: rollover}
+}
+
+// Max returns the largest counter accepted so far.
+func (rs *ReceptionState) Max() uint32 {
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+	return rs.max
+}
+
+// Check reports ErrDuplicateCounter if counter has already been seen or has
+// fallen behind the window.  It does not record the counter; call Commit once the
+// message has been authenticated.
+func (rs *ReceptionState) Check(counter uint32) error {
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+	return rs.check(counter)
+}
+
+// Commit records counter as received.  Commit must only be called after Check
+// succeeded and the message MIC was verified.
+func (rs *ReceptionState) Commit(counter uint32) {
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+	rs.commit(counter)
+}
+
+// Accept is Check followed by Commit.
+func (rs *ReceptionState) Accept(counter uint32) error {
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+	if err := rs.check(counter); err != nil {
+		return err
+	}
+	rs.commit(counter)
+	return nil
+}
+
+// ahead returns how far counter is past max, or 0 if it is not ahead.
+func (rs *ReceptionState) ahead(counter uint32) uint32 {
+	if rs.rollover {
+		if d := counter - rs.max; d < 1<<31 {
+			return d
+		}
+		return 0
+	}
+	if counter > rs.max {
+		return counter - rs.max
+	}
+	return 0
+}
+
+func (rs *ReceptionState) check(counter uint32) error {
+	if !rs.synced || rs.ahead(counter) > 0 {
+		return nil
+	}
+	off := rs.max - counter
+	if off == 0 || off > CounterWindowSize || rs.bitmap&(1<<(off-1)) != 0 {
+		return ErrDuplicateCounter
+	}
+	return nil
+}
+
+func (rs *ReceptionState) commit(counter uint32) {
+	if !rs.synced {
+		rs.max, rs.bitmap, rs.synced = counter, 0, true
+		return
+	}
+	if d := rs.ahead(counter); d > 0 {
+		if d > CounterWindowSize {
+			rs.bitmap = 0
+		} else {
+			rs.bitmap = rs.bitmap<<d | 1<<(d-1)
+		}
+		rs.max = counter
+		return
+	}
+	if off := rs.max - counter; off > 0 && off <= CounterWindowSize {
+		rs.bitmap |= 1 << (off - 1)
+	}
+}
+
+/* vim: set noai ts=4 sw=4: */
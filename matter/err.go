@@ -0,0 +1,11 @@
+package matter
+
+import "errors"
+
+var ErrKeySize = errors.New("MATTER: encryption key must be 16 bytes")
+var ErrShortMessage = errors.New("MATTER: message too short")
+var ErrBadHeader = errors.New("MATTER: invalid message header")
+var ErrSealFailed = errors.New("MATTER: unable to seal message")
+var ErrDuplicateCounter = errors.New("MATTER: duplicate message counter")
+
+/* vim: set noai ts=4 sw=4: */
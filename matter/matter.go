@@ -0,0 +1,262 @@
+package matter
+
+// Matter (formerly Project CHIP) message layer security on top of aesccm.
+//
+// Matter protects every message with AES-CCM-128 using a 16 byte MIC and a 13 byte
+// nonce built from the security flags, the message counter and the source node ID.
+// The message header is the additional authenticated data.  When the privacy flag
+// is set the message counter and node ID fields of the header are then obfuscated
+// with AES-CTR under a privacy key derived from the encryption key.
+//
+// See: Matter Core Specification, section 4.8 "Message Security" and 4.9 "Privacy".
+//
+// MIT Licensed.
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"encoding/binary"
+
+	"github.com/pschlump/AesCCM"
+)
+
+const KeySize = 16   // Matter uses AES-128 only
+const NonceSize = 13 // Security Flags (1) || Message Counter (4) || Source Node ID (8)
+const MICSize = 16   // CCM `M` parameter
+
+// Message Flags
+const (
+	FlagSourcePresent = 0x04 // S flag - Source Node ID is in the header
+	DSIZMask          = 0x03 // DSIZ - size of the Destination field
+	DSIZNone          = 0x00 // no destination
+	DSIZNodeID        = 0x01 // 64 bit Destination Node ID
+	DSIZGroupID       = 0x02 // 16 bit Destination Group ID
+)
+
+// Security Flags
+const (
+	SecFlagPrivacy     = 0x80 // P flag - header is privacy obfuscated
+	SecFlagControl     = 0x40 // C flag - control message
+	SecFlagExtensions  = 0x20 // MX flag - message extensions are present
+	SessionTypeMask    = 0x03 //
+	SessionTypeUnicast = 0x00 //
+	SessionTypeGroup   = 0x01 //
+)
+
+// Header is the plaintext Matter message header.  On the wire all multi-byte
+// fields are little endian.
+type Header struct {
+	Flags          uint8  // Message Flags - version, S flag and DSIZ
+	SessionID      uint16 // Session ID, 0 for unsecured sessions
+	SecurityFlags  uint8  // Security Flags - P, C, MX and session type
+	MessageCounter uint32 // Message Counter
+	SourceNodeID   uint64 // present if Flags&FlagSourcePresent
+	DestNodeID     uint64 // present if Flags&DSIZMask == DSIZNodeID
+	DestGroupID    uint16 // present if Flags&DSIZMask == DSIZGroupID
+	Extensions     []byte // present if SecurityFlags&SecFlagExtensions
+}
+
+// Len returns the number of bytes the header occupies on the wire.
+func (h *Header) Len() int {
+	return 4 + h.obfuscatedLen() + h.extensionsLen()
+}
+
+// obfuscatedLen is the length of the part of the header that privacy covers:
+// Message Counter, Source Node ID and Destination.
+func (h *Header) obfuscatedLen() int {
+	n := 4
+	if h.Flags&FlagSourcePresent != 0 {
+		n += 8
+	}
+	switch h.Flags & DSIZMask {
+	case DSIZNodeID:
+		n += 8
+	case DSIZGroupID:
+		n += 2
+	}
+	return n
+}
+
+func (h *Header) extensionsLen() int {
+	if h.SecurityFlags&SecFlagExtensions != 0 {
+		return 2 + len(h.Extensions)
+	}
+	return 0
+}
+
+// Encode appends the wire format of the header to dst.
+func (h *Header) Encode(dst []byte) []byte {
+	var tmp [8]byte
+	dst = append(dst, h.Flags)
+	binary.LittleEndian.PutUint16(tmp[:2], h.SessionID)
+	dst = append(dst, tmp[:2]...)
+	dst = append(dst, h.SecurityFlags)
+	binary.LittleEndian.PutUint32(tmp[:4], h.MessageCounter)
+	dst = append(dst, tmp[:4]...)
+	if h.Flags&FlagSourcePresent != 0 {
+		binary.LittleEndian.PutUint64(tmp[:], h.SourceNodeID)
+		dst = append(dst, tmp[:]...)
+	}
+	switch h.Flags & DSIZMask {
+	case DSIZNodeID:
+		binary.LittleEndian.PutUint64(tmp[:], h.DestNodeID)
+		dst = append(dst, tmp[:]...)
+	case DSIZGroupID:
+		binary.LittleEndian.PutUint16(tmp[:2], h.DestGroupID)
+		dst = append(dst, tmp[:2]...)
+	}
+	if h.SecurityFlags&SecFlagExtensions != 0 {
+		binary.LittleEndian.PutUint16(tmp[:2], uint16(len(h.Extensions)))
+		dst = append(dst, tmp[:2]...)
+		dst = append(dst, h.Extensions...)
+	}
+	return dst
+}
+
+// DecodeHeader parses a message header from the front of msg and returns it with
+// the number of bytes it used.  The header must not be privacy obfuscated.
+func DecodeHeader(msg []byte) (h Header, n int, err error) {
+	if len(msg) < 8 {
+		return h, 0, ErrShortMessage
+	}
+	h.Flags = msg[0]
+	h.SessionID = binary.LittleEndian.Uint16(msg[1:])
+	h.SecurityFlags = msg[3]
+	if h.Flags&DSIZMask == 0x03 {
+		return h, 0, ErrBadHeader
+	}
+	if len(msg) < 4+h.obfuscatedLen() {
+		return h, 0, ErrShortMessage
+	}
+	h.MessageCounter = binary.LittleEndian.Uint32(msg[4:])
+	n = 8
+	if h.Flags&FlagSourcePresent != 0 {
+		h.SourceNodeID = binary.LittleEndian.Uint64(msg[n:])
+		n += 8
+	}
+	switch h.Flags & DSIZMask {
+	case DSIZNodeID:
+		h.DestNodeID = binary.LittleEndian.Uint64(msg[n:])
+		n += 8
+	case DSIZGroupID:
+		h.DestGroupID = binary.LittleEndian.Uint16(msg[n:])
+		n += 2
+	}
+	if h.SecurityFlags&SecFlagExtensions != 0 {
+		if len(msg) < n+2 {
+			return h, 0, ErrShortMessage
+		}
+		l := int(binary.LittleEndian.Uint16(msg[n:]))
+		n += 2
+		if len(msg) < n+l {
+			return h, 0, ErrShortMessage
+		}
+		h.Extensions = msg[n : n+l]
+		n += l
+	}
+	return h, n, nil
+}
+
+// Nonce builds the 13 byte CCM nonce for a message.  For unicast sessions nodeID is
+// the node ID of the sender (0 for PASE), for group sessions it is the Source Node ID
+// carried in the header.
+func Nonce(securityFlags uint8, messageCounter uint32, nodeID uint64) []byte {
+	nonce := make([]byte, NonceSize)
+	nonce[0] = securityFlags
+	binary.LittleEndian.PutUint32(nonce[1:5], messageCounter)
+	binary.LittleEndian.PutUint64(nonce[5:13], nodeID)
+	return nonce
+}
+
+// Session holds the keys for one direction of a secure session.  Matter uses
+// distinct I2R and R2I keys, so a node has one Session for sending and one for
+// receiving.
+type Session struct {
+	ccm     aesccm.CCM   // AES-CCM-128, M=16, 13 byte nonce
+	privacy cipher.Block // AES-128 under the privacy key
+}
+
+// NewSession sets up a Session from a 16 byte encryption key.  The privacy key is
+// derived from it as the specification requires.
+func NewSession(key []byte) (*Session, error) {
+	if len(key) != KeySize {
+		return nil, ErrKeySize
+	}
+	blk, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	ccm, err := aesccm.NewCCM(blk, MICSize, NonceSize)
+	if err != nil {
+		return nil, err
+	}
+	pk, err := PrivacyKey(key)
+	if err != nil {
+		return nil, err
+	}
+	pblk, err := aes.NewCipher(pk)
+	if err != nil {
+		return nil, err
+	}
+	return &Session{ccm: ccm, privacy: pblk}, nil
+}
+
+// Seal encrypts payload, authenticating the header h, and returns the complete
+// message: header || encrypted payload || MIC.  If the header has the privacy
+// flag set the header is obfuscated after the MIC is computed.  nodeID is used
+// for the nonce when the header carries no Source Node ID.
+func (s *Session) Seal(h *Header, nodeID uint64, payload []byte) ([]byte, error) {
+	if h.Flags&FlagSourcePresent != 0 {
+		nodeID = h.SourceNodeID
+	}
+	hlen := h.Len()
+	msg := h.Encode(make([]byte, 0, hlen+len(payload)+MICSize))
+	nonce := Nonce(h.SecurityFlags, h.MessageCounter, nodeID)
+	msg = s.ccm.Seal(msg, nonce, payload, msg[:hlen])
+	if len(msg) != hlen+len(payload)+MICSize {
+		return nil, ErrSealFailed
+	}
+	if h.SecurityFlags&SecFlagPrivacy != 0 {
+		s.obfuscate(msg, h.obfuscatedLen())
+	}
+	return msg, nil
+}
+
+// Open reverses Seal.  It removes privacy obfuscation if the P flag is set,
+// verifies the MIC and returns the header and decrypted payload.  nodeID is used
+// for the nonce when the header carries no Source Node ID.  msg is not modified.
+//
+// Open does not check the message counter; pass h.MessageCounter to a
+// ReceptionState once Open succeeds.
+func (s *Session) Open(msg []byte, nodeID uint64) (h Header, payload []byte, err error) {
+	if len(msg) < 8+MICSize {
+		return h, nil, ErrShortMessage
+	}
+	msg = append([]byte(nil), msg...) // Open works in place on a private copy
+	if msg[3]&SecFlagPrivacy != 0 {
+		h.Flags, h.SecurityFlags = msg[0], msg[3]
+		if n := h.obfuscatedLen(); len(msg) >= 4+n+MICSize {
+			s.obfuscate(msg, n)
+		} else {
+			return h, nil, ErrShortMessage
+		}
+	}
+	h, n, err := DecodeHeader(msg)
+	if err != nil {
+		return h, nil, err
+	}
+	if len(msg) < n+MICSize {
+		return h, nil, ErrShortMessage
+	}
+	if h.Flags&FlagSourcePresent != 0 {
+		nodeID = h.SourceNodeID
+	}
+	nonce := Nonce(h.SecurityFlags, h.MessageCounter, nodeID)
+	payload, err = s.ccm.Open(nil, nonce, msg[n:], msg[:n])
+	if err != nil {
+		return h, nil, err
+	}
+	return h, payload, nil
+}
+
+/* vim: set noai ts=4 sw=4: */
@@ -0,0 +1,278 @@
+package matter
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"encoding/hex"
+	"testing"
+
+	"github.com/pschlump/AesCCM"
+)
+
+func mustHex(t *testing.T, s string) []byte {
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		t.Fatalf("bad hex in test: %s", err)
+	}
+	return b
+}
+
+func TestNonceAndHeader(t *testing.T) {
+	h := Header{
+		Flags:          FlagSourcePresent | DSIZGroupID,
+		SessionID:      0x1234,
+		SecurityFlags:  SessionTypeGroup | SecFlagExtensions,
+		MessageCounter: 0x0a0b0c0d,
+		SourceNodeID:   0x1122334455667788,
+		DestGroupID:    0xbeef,
+		Extensions:     []byte{0xaa, 0xbb},
+	}
+	enc := h.Encode(nil)
+	expected := "06" + "3412" + "21" + "0d0c0b0a" + "8877665544332211" + "efbe" + "0200" + "aabb"
+	if got := hex.EncodeToString(enc); got != expected {
+		t.Errorf("Encode: got %s expected %s", got, expected)
+	}
+	if h.Len() != len(enc) {
+		t.Errorf("Len: got %d expected %d", h.Len(), len(enc))
+	}
+
+	h2, n, err := DecodeHeader(append(enc, 0x99))
+	if err != nil {
+		t.Fatalf("DecodeHeader: %s", err)
+	}
+	if n != len(enc) || h2.SourceNodeID != h.SourceNodeID || h2.DestGroupID != h.DestGroupID ||
+		h2.MessageCounter != h.MessageCounter || !bytes.Equal(h2.Extensions, h.Extensions) {
+		t.Errorf("DecodeHeader: got %+v n=%d", h2, n)
+	}
+
+	nonce := Nonce(h.SecurityFlags, h.MessageCounter, h.SourceNodeID)
+	if got := hex.EncodeToString(nonce); got != "21"+"0d0c0b0a"+"8877665544332211" {
+		t.Errorf("Nonce: got %s", got)
+	}
+
+	if _, _, err := DecodeHeader(enc[:10]); err != ErrShortMessage {
+		t.Errorf("DecodeHeader of truncated header: expected ErrShortMessage, got %v", err)
+	}
+}
+
+func TestSealOpen(t *testing.T) {
+	key := mustHex(t, "5eded244e5532b3cdc23409dbad052d2")
+	payload := []byte("Matter is the foundation for connected things")
+
+	for ii, h := range []Header{
+		{SessionID: 0x0001, MessageCounter: 0x00000001},
+		{Flags: DSIZNodeID, SessionID: 0x0a0b, MessageCounter: 0x12345678, DestNodeID: 0x0102030405060708},
+		{Flags: FlagSourcePresent | DSIZGroupID, SessionID: 0xdead, SecurityFlags: SessionTypeGroup | SecFlagPrivacy,
+			MessageCounter: 0xfffffffe, SourceNodeID: 0xfedcba9876543210, DestGroupID: 0x0101},
+		{SessionID: 0x0002, SecurityFlags: SecFlagPrivacy | SecFlagExtensions, MessageCounter: 7, Extensions: []byte("ext")},
+	} {
+		s, err := NewSession(key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		const peer = 0x0000000011223344
+		msg, err := s.Seal(&h, peer, payload)
+		if err != nil {
+			t.Fatalf("Test %d: Seal: %s", ii, err)
+		}
+
+		// The MIC and ciphertext must be plain AES-CCM over the clear header.
+		nodeID := uint64(peer)
+		if h.Flags&FlagSourcePresent != 0 {
+			nodeID = h.SourceNodeID
+		}
+		blk, _ := aes.NewCipher(key)
+		ccm, _ := aesccm.NewCCM(blk, MICSize, NonceSize)
+		clear := h.Encode(nil)
+		expected := ccm.Seal(nil, Nonce(h.SecurityFlags, h.MessageCounter, nodeID), payload, clear)
+		if !bytes.Equal(msg[len(clear):], expected) {
+			t.Errorf("Test %d: ciphertext does not match AES-CCM", ii)
+		}
+
+		obfuscated := !bytes.Equal(msg[:len(clear)], clear)
+		if h.SecurityFlags&SecFlagPrivacy != 0 {
+			if !obfuscated || !bytes.Equal(msg[:4], clear[:4]) {
+				t.Errorf("Test %d: privacy flag set but header not obfuscated as expected", ii)
+			}
+			if h.SecurityFlags&SecFlagExtensions != 0 && !bytes.Equal(msg[len(clear)-5:len(clear)], clear[len(clear)-5:]) {
+				t.Errorf("Test %d: message extensions must not be obfuscated", ii)
+			}
+		} else if obfuscated {
+			t.Errorf("Test %d: header changed without privacy flag", ii)
+		}
+
+		orig := append([]byte(nil), msg...)
+		h2, pt, err := s.Open(msg, peer)
+		if err != nil {
+			t.Fatalf("Test %d: Open: %s", ii, err)
+		}
+		if !bytes.Equal(pt, payload) || h2.MessageCounter != h.MessageCounter || h2.SourceNodeID != h.SourceNodeID {
+			t.Errorf("Test %d: Open returned wrong data %+v %q", ii, h2, pt)
+		}
+		if !bytes.Equal(msg, orig) {
+			t.Errorf("Test %d: Open modified its input", ii)
+		}
+
+		for pos := range msg {
+			msg[pos] ^= 0x10
+			if _, _, err := s.Open(msg, peer); err == nil {
+				t.Errorf("Test %d: altered byte %d, Open should have failed", ii, pos)
+			}
+			msg[pos] ^= 0x10
+		}
+		if h.Flags&FlagSourcePresent == 0 {
+			if _, _, err := s.Open(msg, peer+1); err == nil {
+				t.Errorf("Test %d: wrong peer node ID, Open should have failed", ii)
+			}
+		}
+	}
+}
+
+func TestPrivacy(t *testing.T) {
+	key := mustHex(t, "5eded244e5532b3cdc23409dbad052d2")
+	pk, err := PrivacyKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pk) != KeySize || bytes.Equal(pk, key) {
+		t.Errorf("PrivacyKey: bad key %x", pk)
+	}
+
+	mic := mustHex(t, "000102030405060708090a0b0c0d0e0f")
+	if got := hex.EncodeToString(PrivacyNonce(0xabcd, mic)); got != "abcd"+"05060708090a0b0c0d0e0f" {
+		t.Errorf("PrivacyNonce: got %s", got)
+	}
+
+	// Obfuscation is AES-CTR over the fields after the Security Flags with the
+	// counter block 0x01 || PrivacyNonce || 0x0001.
+	s, _ := NewSession(key)
+	h := Header{Flags: FlagSourcePresent, SessionID: 0xabcd, SecurityFlags: SecFlagPrivacy, MessageCounter: 42, SourceNodeID: 77}
+	msg, err := s.Seal(&h, 0, []byte("hello"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	pblk, _ := aes.NewCipher(pk)
+	ctr := append(append([]byte{0x01}, PrivacyNonce(h.SessionID, msg[len(msg)-MICSize:])...), 0x00, 0x01)
+	clear := make([]byte, 12)
+	cipher.NewCTR(pblk, ctr).XORKeyStream(clear, msg[4:16])
+	if !bytes.Equal(clear, h.Encode(nil)[4:16]) {
+		t.Errorf("privacy obfuscation does not match AES-CTR construction")
+	}
+}
+
+// Whole messages, privacy key and all.  These were computed apart from this
+// package with the Python cryptography package (AESCCM, HKDF and AES-CTR over
+// OpenSSL 3.0) from the layouts in Matter Core Specification 4.8 and 4.9; the
+// specification and the connectedhomeip test vectors were not to hand.
+func TestVectors(t *testing.T) {
+	key := mustHex(t, "5eded244e5532b3cdc23409dbad052d2")
+	pk, err := PrivacyKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := hex.EncodeToString(pk); got != "63d2de308899e24db053b0236df07719" {
+		t.Errorf("PrivacyKey: got %s", got)
+	}
+
+	var testData = []struct {
+		h       Header
+		nodeID  uint64
+		payload string
+		msg     string
+	}{
+		{h: Header{SessionID: 0x0001, MessageCounter: 1}, nodeID: 0x11223344,
+			payload: "Matter is the foundation for connected things",
+			msg:     "00010000010000001230f2a0840ced086bddfa9de3f3a610b215a5da541c4c24e72aa346c289c69482652526467793b929c5740e865a042c2364545ef6d6501a354f16a119"},
+		{h: Header{Flags: FlagSourcePresent | DSIZGroupID, SessionID: 0xdead, SecurityFlags: SessionTypeGroup | SecFlagPrivacy,
+			MessageCounter: 0xfffffffe, SourceNodeID: 0xfedcba9876543210, DestGroupID: 0x0101},
+			payload: "Matter is the foundation for connected things",
+			msg:     "06adde814e51bbed7c8c9b2ce3007241d55781510df173760459929f13b63942b4880b6c22433600a260f5f033ac7e43fb48b3068d270072bc49d7b2697a3d5fd7f16a70ab53fae09c55eb67b3bbee"},
+		{h: Header{Flags: FlagSourcePresent | DSIZNodeID, SessionID: 0x0a0b, SecurityFlags: SecFlagPrivacy,
+			MessageCounter: 0x12345678, SourceNodeID: 0x0102030405060708, DestNodeID: 0x1112131415161718},
+			payload: "hello",
+			msg:     "050b0a800e6e162f288ab4f5a59bd418a08a1cbe447642630b1c5ab29918c6db202c6310ee089022bc3dca6fd2"},
+	}
+
+	s, err := NewSession(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for ii, vv := range testData {
+		msg, err := s.Seal(&vv.h, vv.nodeID, []byte(vv.payload))
+		if err != nil {
+			t.Fatalf("Test %d: Seal: %s", ii, err)
+		}
+		if got := hex.EncodeToString(msg); got != vv.msg {
+			t.Errorf("Test %d: got %s, expected %s", ii, got, vv.msg)
+		}
+		h, pt, err := s.Open(mustHex(t, vv.msg), vv.nodeID)
+		if err != nil || string(pt) != vv.payload || h.MessageCounter != vv.h.MessageCounter || h.SourceNodeID != vv.h.SourceNodeID ||
+			h.DestNodeID != vv.h.DestNodeID || h.DestGroupID != vv.h.DestGroupID {
+			t.Errorf("Test %d: Open returned %+v %q err=%v", ii, h, pt, err)
+		}
+	}
+}
+
+func TestReceptionState(t *testing.T) {
+	rs := NewReceptionState(false)
+	steps := []struct {
+		counter uint32
+		ok      bool
+	}{
+		{100, true}, // first message synchronizes
+		{100, false},
+		{101, true},
+		{99, true},
+		{99, false},
+		{69, true},  // exactly at the edge of the window
+		{68, false}, // behind the window
+		{140, true},
+		{108, true},
+		{107, false}, // 140-33, now behind the window
+		{108, false},
+		{0xffffffff, true},
+		{0, false}, // no rollover for unicast
+	}
+	for ii, vv := range steps {
+		err := rs.Accept(vv.counter)
+		if vv.ok && err != nil {
+			t.Errorf("Step %d: counter %d should have been accepted: %s", ii, vv.counter, err)
+		} else if !vv.ok && err != ErrDuplicateCounter {
+			t.Errorf("Step %d: counter %d should have been rejected", ii, vv.counter)
+		}
+	}
+
+	grp := NewSyncedReceptionState(0xfffffff0, true)
+	for ii, vv := range []struct {
+		counter uint32
+		ok      bool
+	}{
+		{0xfffffff0, false},
+		{0xfffffffa, true},
+		{2, true}, // rolls over
+		{0xfffffffb, true},
+		{0xfffffffa, false},
+		{0x80000010, false}, // half the counter space behind
+	} {
+		err := grp.Accept(vv.counter)
+		if vv.ok != (err == nil) {
+			t.Errorf("Group step %d: counter %#x, got err=%v", ii, vv.counter, err)
+		}
+	}
+	if grp.Max() != 2 {
+		t.Errorf("Group Max: got %d expected 2", grp.Max())
+	}
+
+	// Check does not record
+	rs = NewSyncedReceptionState(10, false)
+	if rs.Check(11) != nil || rs.Check(11) != nil {
+		t.Errorf("Check should not record the counter")
+	}
+	rs.Commit(11)
+	if rs.Check(11) == nil {
+		t.Errorf("Commit should record the counter")
+	}
+}
+
+/* vim: set noai ts=4 sw=4: */
@@ -0,0 +1,51 @@
+package matter
+
+// Message privacy - obfuscation of the Message Counter, Source Node ID and
+// Destination fields of the header.
+//
+//	PrivacyKey   = Crypto_KDF(EncryptionKey, [], "PrivacyKey", 128)
+//	PrivacyNonce = Session ID (2 bytes, big endian) || MIC[5..15]
+//
+// The obfuscated fields are encrypted with AES-CTR under the privacy key using the
+// same counter block layout as AES-CCM with a 13 byte nonce, starting at counter 1.
+//
+// MIT Licensed.
+
+import (
+	"crypto/cipher"
+	"crypto/hkdf"
+	"crypto/sha256"
+	"encoding/binary"
+
+	"github.com/pschlump/AesCCM"
+)
+
+const privacyKeyInfo = "PrivacyKey"
+
+// PrivacyKey derives the privacy key from an encryption key with HKDF-SHA256.
+func PrivacyKey(encryptionKey []byte) ([]byte, error) {
+	return hkdf.Key(sha256.New, encryptionKey, nil, privacyKeyInfo, KeySize)
+}
+
+// PrivacyNonce builds the 13 byte privacy nonce from the session ID and MIC.
+func PrivacyNonce(sessionID uint16, mic []byte) []byte {
+	nonce := make([]byte, NonceSize)
+	binary.BigEndian.PutUint16(nonce[0:2], sessionID)
+	copy(nonce[2:], mic[5:16])
+	return nonce
+}
+
+// obfuscate applies (or removes - it is its own inverse) privacy to the n bytes of
+// the header that follow the Security Flags.  msg must hold a complete message so
+// the MIC can be found at the end.
+func (s *Session) obfuscate(msg []byte, n int) {
+	var ctr [aesccm.CcmBlockSize]byte
+	sessionID := binary.LittleEndian.Uint16(msg[1:3])
+	ctr[0] = 15 - NonceSize - 1 // L' = L-1
+	copy(ctr[1:], PrivacyNonce(sessionID, msg[len(msg)-MICSize:]))
+	ctr[aesccm.CcmBlockSize-1] = 1
+	stream := cipher.NewCTR(s.privacy, ctr[:])
+	stream.XORKeyStream(msg[4:4+n], msg[4:4+n])
+}
+
+/* vim: set noai ts=4 sw=4: */
@@ -0,0 +1,298 @@
+// Nonce generation for CCM.
+//
+// CCM fails completely if a nonce is ever used twice with the same key - the
+// keystream repeats and the CBC-MAC can be forged.  Seal takes whatever nonce the
+// caller hands it, so these generators exist to take that choice away:
+//
+//	CounterNonce	a big-endian counter, saved to a CounterStore before each use
+//	RandomNonce		crypto/rand nonces, limited to stay under the birthday bound
+//	PrefixNonce		a fixed per-instance prefix followed by a counter
+//
+// AutoNonceAEAD pairs a CCM with a NonceSource and puts the nonce in front of the
+// ciphertext so the receiver does not need to be told it.
+//
+// MIT Licensed
+//
+
+package aesccm
+
+import (
+	"crypto/rand"
+	"io"
+	"os"
+	"sync"
+)
+
+// NonceSource hands out nonces that are never repeated for the life of a key.
+type NonceSource interface {
+	// NonceSize returns the length of the nonces returned by Next.
+	NonceSize() int
+
+	// Next returns a fresh nonce.  Once the source can no longer guarantee
+	// uniqueness it returns an error and no nonce.
+	Next() ([]byte, error)
+}
+
+// CounterStore persists the last counter value handed out so a restart does not
+// reuse nonces.  Load returns nil if nothing has been saved yet.
+type CounterStore interface {
+	Load() ([]byte, error)
+	Save(counter []byte) error
+}
+
+// MemoryCounterStore keeps the counter in memory.  It is only safe when the key
+// does not outlive the process.
+type MemoryCounterStore struct {
+	mu      sync.Mutex //
+	counter []byte     //
+}
+
+func (m *MemoryCounterStore) Load() ([]byte, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]byte(nil), m.counter...), nil
+}
+
+func (m *MemoryCounterStore) Save(counter []byte) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.counter = append(m.counter[:0], counter...)
+	return nil
+}
+
+// FileCounterStore keeps the counter in a file.  Save writes a temporary file,
+// syncs it and renames it over Path so a crash leaves either the old or the new
+// value.
+type FileCounterStore struct {
+	Path string
+}
+
+func (f *FileCounterStore) Load() ([]byte, error) {
+	b, err := os.ReadFile(f.Path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	return b, err
+}
+
+func (f *FileCounterStore) Save(counter []byte) error {
+	tmp := f.Path + ".tmp"
+	fp, err := os.OpenFile(tmp, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+	if _, err = fp.Write(counter); err == nil {
+		err = fp.Sync()
+	}
+	if cerr := fp.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return os.Rename(tmp, f.Path)
+}
+
+// CounterNonce returns the nonces 0, 1, 2 ... 2^(8*NonceSize)-1 and then stops.
+// Each value is saved to the store before it is returned.
+type CounterNonce struct {
+	mu    sync.Mutex   //
+	size  int          // nonce size in bytes
+	store CounterStore //
+	last  []byte       // last value handed out, nil if none
+}
+
+// NewCounterNonce returns a counter of size bytes that resumes from the value in
+// store.  A nil store keeps the counter in memory.
+func NewCounterNonce(size int, store CounterStore) (*CounterNonce, error) {
+	if size < 1 {
+		return nil, ErrNonceSize
+	}
+	if store == nil {
+		store = &MemoryCounterStore{}
+	}
+	last, err := store.Load()
+	if err != nil {
+		return nil, err
+	}
+	if last != nil && len(last) != size {
+		return nil, ErrCounterStore
+	}
+	return &CounterNonce{size: size, store: store, last: last}, nil
+}
+
+func (c *CounterNonce) NonceSize() int {
+	return c.size
+}
+
+func (c *CounterNonce) Next() ([]byte, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	next := make([]byte, c.size)
+	if c.last != nil {
+		copy(next, c.last)
+		if !increment(next) {
+			return nil, ErrNonceExhausted
+		}
+	}
+	if err := c.store.Save(next); err != nil {
+		return nil, err
+	}
+	c.last = next
+	return append([]byte(nil), next...), nil
+}
+
+// increment adds one to the big-endian number in b.  It returns false, leaving b
+// unchanged, if b is already all 0xff.
+func increment(b []byte) bool {
+	for i := len(b) - 1; i >= 0; i-- {
+		if b[i] != 0xff {
+			b[i]++
+			for j := i + 1; j < len(b); j++ {
+				b[j] = 0
+			}
+			return true
+		}
+	}
+	return false
+}
+
+// RandomNonce returns random nonces until its limit has been handed out.
+type RandomNonce struct {
+	mu    sync.Mutex //
+	size  int        // nonce size in bytes
+	limit uint64     // number of nonces that may be handed out
+	used  uint64     // number handed out so far
+	Rand  io.Reader  // source of randomness, crypto/rand.Reader by default
+}
+
+// DefaultRandomNonceLimit is the number of random nonces of size bytes that keeps
+// the chance of any two being equal below 2^-32, that is 2^(4*size-16).  For a
+// 12 byte nonce it is 2^32, the limit NIST SP 800-38D sets for GCM.
+func DefaultRandomNonceLimit(size int) uint64 {
+	bits := 4*size - 16
+	switch {
+	case bits <= 0:
+		return 1
+	case bits >= 64:
+		return 1<<64 - 1
+	}
+	return 1 << uint(bits)
+}
+
+// NewRandomNonce returns a random nonce source of size bytes.  A limit of 0 uses
+// DefaultRandomNonceLimit.
+func NewRandomNonce(size int, limit uint64) (*RandomNonce, error) {
+	if size < 1 {
+		return nil, ErrNonceSize
+	}
+	if limit == 0 {
+		limit = DefaultRandomNonceLimit(size)
+	}
+	return &RandomNonce{size: size, limit: limit, Rand: rand.Reader}, nil
+}
+
+func (r *RandomNonce) NonceSize() int {
+	return r.size
+}
+
+// Used returns the number of nonces handed out so far.
+func (r *RandomNonce) Used() uint64 {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.used
+}
+
+func (r *RandomNonce) Next() ([]byte, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.used >= r.limit {
+		return nil, ErrNonceLimit
+	}
+	nonce := make([]byte, r.size)
+	if _, err := io.ReadFull(r.Rand, nonce); err != nil {
+		return nil, err
+	}
+	r.used++
+	return nonce, nil
+}
+
+// PrefixNonce is a fixed prefix, unique to each instance sharing a key, followed
+// by a CounterNonce for the remaining bytes.
+type PrefixNonce struct {
+	prefix  []byte        //
+	counter *CounterNonce //
+}
+
+// NewPrefixNonce returns nonces of size bytes that start with prefix.  The
+// counter part resumes from store, or is kept in memory if store is nil.
+func NewPrefixNonce(prefix []byte, size int, store CounterStore) (*PrefixNonce, error) {
+	if len(prefix) >= size {
+		return nil, ErrNonceSize
+	}
+	counter, err := NewCounterNonce(size-len(prefix), store)
+	if err != nil {
+		return nil, err
+	}
+	return &PrefixNonce{prefix: append([]byte(nil), prefix...), counter: counter}, nil
+}
+
+func (p *PrefixNonce) NonceSize() int {
+	return len(p.prefix) + p.counter.NonceSize()
+}
+
+func (p *PrefixNonce) Next() ([]byte, error) {
+	ctr, err := p.counter.Next()
+	if err != nil {
+		return nil, err
+	}
+	return append(append(make([]byte, 0, p.NonceSize()), p.prefix...), ctr...), nil
+}
+
+// AutoNonceAEAD seals with nonces from a NonceSource.  The output of Seal is
+// nonce || ciphertext || tag, which is what Open expects.
+type AutoNonceAEAD struct {
+	ccm    CCM         //
+	nonces NonceSource //
+}
+
+// NewAutoNonceAEAD pairs ccm with nonces.  The nonce sizes must agree.
+func NewAutoNonceAEAD(ccm CCM, nonces NonceSource) (*AutoNonceAEAD, error) {
+	if nonces.NonceSize() != ccm.NonceSize() {
+		return nil, ErrNonceSize
+	}
+	return &AutoNonceAEAD{ccm: ccm, nonces: nonces}, nil
+}
+
+// Overhead returns the nonce and tag size together.
+func (a *AutoNonceAEAD) Overhead() int {
+	return a.ccm.NonceSize() + a.ccm.Overhead()
+}
+
+// Seal takes the next nonce, encrypts plaintext and appends nonce || ciphertext
+// || tag to dst.
+func (a *AutoNonceAEAD) Seal(dst, plaintext, adata []byte) ([]byte, error) {
+	nonce, err := a.nonces.Next()
+	if err != nil {
+		return nil, err
+	}
+	n := len(dst)
+	ret := a.ccm.Seal(append(dst, nonce...), nonce, plaintext, adata)
+	if len(ret) != n+len(nonce)+len(plaintext)+a.ccm.Overhead() {
+		return nil, ErrSealFailed
+	}
+	return ret, nil
+}
+
+// Open splits the nonce off the front of ciphertext, then authenticates and
+// decrypts the rest.
+func (a *AutoNonceAEAD) Open(dst, ciphertext, adata []byte) ([]byte, error) {
+	ns := a.ccm.NonceSize()
+	if len(ciphertext) < ns+a.ccm.Overhead() {
+		return nil, ErrCiphertextTooShort
+	}
+	return a.ccm.Open(dst, ciphertext[:ns], ciphertext[ns:], adata)
+}
+
+/* vim: set noai ts=4 sw=4: */
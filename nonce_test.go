@@ -0,0 +1,120 @@
+package aesccm
+
+import (
+	"bytes"
+	"crypto/aes"
+	"encoding/hex"
+	"path/filepath"
+	"testing"
+)
+
+func TestCounterNonce(t *testing.T) {
+	store := &FileCounterStore{Path: filepath.Join(t.TempDir(), "counter")}
+	c, err := NewCounterNonce(2, store)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for ii, expected := range []string{"0000", "0001", "0002"} {
+		n, err := c.Next()
+		if err != nil || hex.EncodeToString(n) != expected {
+			t.Errorf("Test %d: got %x %v, expected %s", ii, n, err, expected)
+		}
+	}
+
+	// A restart resumes after the last saved value.
+	c, err = NewCounterNonce(2, store)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n, _ := c.Next(); hex.EncodeToString(n) != "0003" {
+		t.Errorf("After restart: got %x, expected 0003", n)
+	}
+	if _, err := NewCounterNonce(3, store); err != ErrCounterStore {
+		t.Errorf("Size mismatch: expected ErrCounterStore, got %v", err)
+	}
+
+	// Stop at 2^16-1.
+	store.Save([]byte{0xff, 0xfe})
+	c, _ = NewCounterNonce(2, store)
+	if n, err := c.Next(); err != nil || hex.EncodeToString(n) != "ffff" {
+		t.Errorf("Last nonce: got %x %v", n, err)
+	}
+	if _, err := c.Next(); err != ErrNonceExhausted {
+		t.Errorf("Expected ErrNonceExhausted, got %v", err)
+	}
+}
+
+func TestRandomNonce(t *testing.T) {
+	if l := DefaultRandomNonceLimit(12); l != 1<<32 {
+		t.Errorf("DefaultRandomNonceLimit(12): got %d", l)
+	}
+	r, err := NewRandomNonce(13, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	seen := make(map[string]bool)
+	for i := 0; i < 3; i++ {
+		n, err := r.Next()
+		if err != nil || len(n) != 13 || seen[string(n)] {
+			t.Errorf("Nonce %d: got %x %v", i, n, err)
+		}
+		seen[string(n)] = true
+	}
+	if _, err := r.Next(); err != ErrNonceLimit || r.Used() != 3 {
+		t.Errorf("Expected ErrNonceLimit after 3 nonces, got %v, used %d", err, r.Used())
+	}
+}
+
+func TestPrefixNonce(t *testing.T) {
+	p, err := NewPrefixNonce([]byte{0xaa, 0xbb, 0xcc, 0xdd}, 12, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.Next()
+	if n, _ := p.Next(); hex.EncodeToString(n) != "aabbccdd0000000000000001" {
+		t.Errorf("got %x", n)
+	}
+	if _, err := NewPrefixNonce(make([]byte, 12), 12, nil); err != ErrNonceSize {
+		t.Errorf("Prefix as long as the nonce: expected ErrNonceSize, got %v", err)
+	}
+}
+
+func TestAutoNonceAEAD(t *testing.T) {
+	blk, _ := aes.NewCipher(make([]byte, 16))
+	ccm, _ := NewCCM(blk, 16, 13)
+	if _, err := NewAutoNonceAEAD(ccm, &RandomNonce{size: 12}); err != ErrNonceSize {
+		t.Errorf("Nonce size mismatch: expected ErrNonceSize, got %v", err)
+	}
+	ns, _ := NewCounterNonce(13, nil)
+	a, err := NewAutoNonceAEAD(ccm, ns)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	msg, adata := []byte("attack at dawn"), []byte("header")
+	ct1, err := a.Seal([]byte("prefix"), msg, adata)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ct2, _ := a.Seal(nil, msg, adata)
+	if len(ct1) != 6+len(msg)+a.Overhead() || bytes.Equal(ct1[6:], ct2) {
+		t.Fatalf("Seal: bad output %x %x", ct1, ct2)
+	}
+	if !bytes.Equal(ct2[:13], []byte{12: 1}) || !bytes.Equal(ct2[13:], ccm.Seal(nil, ct2[:13], msg, adata)) {
+		t.Errorf("Seal: output is not nonce || CCM ciphertext")
+	}
+
+	pt, err := a.Open(nil, ct1[6:], adata)
+	if err != nil || !bytes.Equal(pt, msg) {
+		t.Errorf("Open: got %q %v", pt, err)
+	}
+	ct2[0] ^= 1
+	if _, err := a.Open(nil, ct2, adata); err == nil {
+		t.Errorf("Open with altered nonce should have failed")
+	}
+	if _, err := a.Open(nil, ct2[:20], adata); err != ErrCiphertextTooShort {
+		t.Errorf("Short input: expected ErrCiphertextTooShort, got %v", err)
+	}
+}
+
+/* vim: set noai ts=4 sw=4: */
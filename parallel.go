@@ -0,0 +1,107 @@
+// Parallel CTR for large messages.
+//
+// The keystream block for counter i does not depend on any other block, so the
+// CTR half of CCM splits cleanly: the message is cut into parallelChunk sized
+// pieces and each piece is encrypted from its own starting counter,
+//
+//	A_(1 + k*parallelChunk/16)  for chunk k,
+//
+// by a pool of goroutines.  The CBC-MAC is a serial chain and stays on a single
+// goroutine, the calling one, running alongside the pool.  On Open it follows the
+// workers chunk by chunk, as the MAC covers the plaintext they produce.  On Seal
+// it reads the plaintext directly, unless the output overwrites the plaintext in
+// place; then each chunk is only encrypted once the MAC has passed it.
+//
+// The MAC bounds the speed, so expect around twice the single goroutine rate,
+// not a multiple of the core count.
+//
+// MIT Licensed
+//
+
+package aesccm
+
+import (
+	"crypto/cipher"
+	"encoding/binary"
+	"runtime"
+	"sync"
+	"sync/atomic"
+)
+
+const DefaultParallelThreshold = 1 << 20
+const parallelChunk = 64 << 10 // a multiple of CcmBlockSize
+
+// SetParallel makes Seal and Open of messages of threshold bytes or more run the
+// keystream on workers goroutines (GOMAXPROCS if workers <= 0) next to the
+// CBC-MAC.  A threshold <= 0 turns the parallel path off.  Call it before the
+// CCMType is in use.
+func (ccmt *CCMType) SetParallel(threshold, workers int) {
+	if workers <= 0 {
+		workers = runtime.GOMAXPROCS(0)
+	}
+	ccmt.parallel, ccmt.workers = max(threshold, 0), workers
+}
+
+// parallelBlocks does the work of sealBlocks, or of openBlocks if open is set,
+// with the keystream spread over ccmt.workers goroutines.
+func (ccmt *CCMType) parallelBlocks(st *ccmState, out, in []byte, open bool) {
+	chunks := (len(in) + parallelChunk - 1) / parallelChunk
+	chunk := func(k int) (o, i []byte) {
+		lo, hi := k*parallelChunk, min((k+1)*parallelChunk, len(in))
+		return out[lo:hi], in[lo:hi]
+	}
+
+	// Sealing in place, a chunk must not be encrypted before the MAC has read it.
+	// Opening, the MAC must not read a chunk before it is decrypted.
+	inPlace := len(in) > 0 && &out[0] == &in[0]
+	var done []chan struct{}
+	if open || inPlace {
+		done = make([]chan struct{}, chunks)
+		for k := range done {
+			done[k] = make(chan struct{})
+		}
+	}
+
+	first := binary.BigEndian.Uint64(st.ctr[8:]) + 1 // A_1
+	var next atomic.Int64
+	var wg sync.WaitGroup
+	for w := 0; w < min(ccmt.workers, chunks); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			ctr := st.ctr
+			for {
+				k := int(next.Add(1) - 1)
+				if k >= chunks {
+					return
+				}
+				if !open && inPlace {
+					<-done[k]
+				}
+				binary.BigEndian.PutUint64(ctr[8:], first+uint64(k*parallelChunk/CcmBlockSize))
+				o, i := chunk(k)
+				cipher.NewCTR(ccmt.blk, ctr[:]).XORKeyStream(o, i)
+				if open {
+					close(done[k])
+				}
+			}
+		}()
+	}
+
+	for k := 0; k < chunks; k++ {
+		o, i := chunk(k)
+		if open {
+			<-done[k]
+			ccmt.cbcString(st.mac[:], o)
+		} else {
+			ccmt.cbcString(st.mac[:], i)
+			if inPlace {
+				close(done[k])
+			}
+		}
+	}
+	wg.Wait()
+	ccmt.skipCounter(&st.ctr, (len(in)+CcmBlockSize-1)/CcmBlockSize)
+}
+
+/* vim: set noai ts=4 sw=4: */
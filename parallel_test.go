@@ -0,0 +1,79 @@
+package aesccm
+
+import (
+	"bytes"
+	"crypto/aes"
+	"testing"
+)
+
+// The parallel path produces the same bytes as the sequential one, in and out of
+// place, for lengths around the chunk boundaries.
+func TestParallel(t *testing.T) {
+	blk, _ := aes.NewCipher(make([]byte, 16))
+	seq, _ := newCCMType(blk, 16, 12)
+	par, _ := newCCMType(blk, 16, 12)
+	par.SetParallel(1, 3)
+	nonce := []byte("parallel ccm")
+	adata := []byte("adata")
+
+	for _, n := range []int{1, 100, parallelChunk - 1, parallelChunk, 3*parallelChunk + 17, 8 * parallelChunk} {
+		plaintext := make([]byte, n)
+		for i := range plaintext {
+			plaintext[i] = byte(i * 7)
+		}
+		expect := seq.Seal(nil, nonce, plaintext, adata)
+
+		ct := par.Seal(nil, nonce, plaintext, adata)
+		if !bytes.Equal(ct, expect) {
+			t.Errorf("Len %d: parallel Seal differs", n)
+			continue
+		}
+		inPlace := append(make([]byte, 0, n+16), plaintext...)
+		if ct := par.Seal(inPlace[:0], nonce, inPlace, adata); !bytes.Equal(ct, expect) {
+			t.Errorf("Len %d: in place parallel Seal differs", n)
+		}
+
+		if pt, err := par.Open(nil, nonce, ct, adata); err != nil || !bytes.Equal(pt, plaintext) {
+			t.Errorf("Len %d: parallel Open failed, err=%v", n, err)
+		}
+		if pt, err := par.Open(ct[:0], nonce, ct, adata); err != nil || !bytes.Equal(pt, plaintext) {
+			t.Errorf("Len %d: in place parallel Open failed, err=%v", n, err)
+		}
+
+		bad := append([]byte(nil), expect...)
+		bad[n/2] ^= 1
+		if _, err := par.Open(nil, nonce, bad, adata); err != ErrOpenError {
+			t.Errorf("Len %d: expected ErrOpenError, got %v", n, err)
+		}
+	}
+}
+
+func BenchmarkParallel(b *testing.B) {
+	blk, _ := aes.NewCipher(make([]byte, 16))
+	nonce := make([]byte, 11) // L = 4, room for 16 MiB
+	buf := make([]byte, 16<<20)
+	for _, parallel := range []bool{false, true} {
+		ccm, _ := newCCMType(blk, 16, 11)
+		name := "Sequential"
+		if parallel {
+			ccm.SetParallel(DefaultParallelThreshold, 0)
+			name = "Parallel"
+		}
+		ct := ccm.Seal(nil, nonce, buf, nil)
+		out := make([]byte, 0, len(ct))
+		b.Run(name+"Seal", func(b *testing.B) {
+			b.SetBytes(int64(len(buf)))
+			for i := 0; i < b.N; i++ {
+				out = ccm.Seal(out[:0], nonce, buf, nil)
+			}
+		})
+		b.Run(name+"Open", func(b *testing.B) {
+			b.SetBytes(int64(len(buf)))
+			for i := 0; i < b.N; i++ {
+				out, _ = ccm.Open(out[:0], nonce, ct, nil)
+			}
+		})
+	}
+}
+
+/* vim: set noai ts=4 sw=4: */
@@ -0,0 +1,201 @@
+package sjcl
+
+// Password based encrypt/decrypt in the SJCL JSON format, with the key derivation
+// function picked from the JSON.
+//
+// sjcl.encrypt() in JavaScript always uses PBKDF2-HMAC-SHA256 and writes only
+// "iter".  Go to Go data can ask for another KDF; it is recorded in the extension
+// fields "kdf", "m", "n", "r" and "p" (see the kdf package), which SJCL itself
+// ignores.  Data without "kdf" is PBKDF2-HMAC-SHA256, so JSON from SJCL decrypts
+// unchanged.
+//
+// MIT Licensed.
+
+import (
+	"crypto/aes"
+	"crypto/rand"
+	"io"
+
+	"github.com/pschlump/AesCCM"
+	"github.com/pschlump/AesCCM/base64data"
+	"github.com/pschlump/AesCCM/kdf"
+	"github.com/pschlump/json"
+)
+
+// SJCL defaults for sjcl.encrypt()
+const (
+	DefaultKeySize = 128 // bits
+	DefaultTagSize = 64  // bits
+	DefaultIter    = 10000
+	ivSize         = 16 // SJCL generates a 4 word IV and uses the front of it
+	saltSize       = 8  // SJCL generates a 2 word salt
+)
+
+// KDFParams returns the key derivation parameters recorded in the JSON.
+func (eBlob *SJCL_DataStruct) KDFParams() kdf.Params {
+	return kdf.Params{Name: eBlob.KDF, Iter: eBlob.Iter, Memory: eBlob.KDFMemory, N: eBlob.KDFCost, R: eBlob.KDFBlockSize, P: eBlob.KDFParallelism}
+}
+
+// SetKDFParams records p in the JSON fields.
+func (eBlob *SJCL_DataStruct) SetKDFParams(p kdf.Params) {
+	if p.Name == kdf.PBKDF2SHA256 {
+		p.Name = "" // leave it looking like plain SJCL
+	}
+	eBlob.KDF, eBlob.Iter, eBlob.KDFMemory, eBlob.KDFCost, eBlob.KDFBlockSize, eBlob.KDFParallelism = p.Name, p.Iter, p.Memory, p.N, p.R, p.P
+}
+
+// Encrypt seals plaintext with a key derived from password using p.  keySize and
+// tagSize are in bits as in the JSON; 0 selects the SJCL defaults.  With p set to
+// kdf.Params{Iter: DefaultIter} the result is what sjcl.encrypt() produces.
+func Encrypt(password, plaintext, adata []byte, p kdf.Params, keySize, tagSize int) (eBlob SJCL_DataStruct, err error) {
+	if eBlob, err = newBlob(adata, p, keySize, tagSize); err != nil {
+		return
+	}
+	err = eBlob.Seal(password, plaintext)
+	return
+}
+
+// Seal encrypts plaintext into CipherText with the sizes, KDF, salt, IV and adata
+// already in eBlob, as sjcl.encrypt() does with all of them given in its params.
+// Given the fields of an existing blob and its plaintext, Seal reproduces the
+// blob exactly.  The IV is 8 to 16 bytes; the nonce is as much of the front of it
+// as the message length leaves room for.
+func (eBlob *SJCL_DataStruct) Seal(password, plaintext []byte) error {
+	if err := eBlob.check(); err != nil {
+		return err
+	}
+	iv := eBlob.InitilizationVector
+	if len(iv) < 8 || len(iv) > ivSize {
+		return BadSJCLData
+	}
+	ccm, err := newCCM(password, eBlob, min(aesccm.CalculateNonceLengthFromMessageLength(len(plaintext)), len(iv)), kdf.DefaultLimits)
+	if err != nil {
+		return err
+	}
+	eBlob.CipherText = ccm.Seal(nil, iv, plaintext, eBlob.AdditionalData)
+	if eBlob.CipherText == nil {
+		return aesccm.ErrSealFailed
+	}
+	return nil
+}
+
+// newBlob fills in everything Encrypt writes but the ciphertext, with a new
+// random salt and IV.
+func newBlob(adata []byte, p kdf.Params, keySize, tagSize int) (eBlob SJCL_DataStruct, err error) {
+	if keySize == 0 {
+		keySize = DefaultKeySize
+	}
+	if tagSize == 0 {
+		tagSize = DefaultTagSize
+	}
+	eBlob = SJCL_DataStruct{Version: 1, KeySize: keySize, TagSize: tagSize, Mode: "ccm", Cipher: "aes", TagSizeBytes: tagSize / 8, KeySizeBytes: keySize / 8}
+	eBlob.SetKDFParams(p)
+	eBlob.AdditionalData = append(eBlob.AdditionalData, adata...)
+	eBlob.Salt = make([]byte, saltSize)
+	eBlob.InitilizationVector = make([]byte, ivSize)
+	if _, err = io.ReadFull(rand.Reader, eBlob.Salt); err != nil {
+		return
+	}
+	_, err = io.ReadFull(rand.Reader, eBlob.InitilizationVector)
+	return
+}
+
+// Decrypt opens JSON produced by sjcl.encrypt() or Encrypt.  The KDF the JSON
+// asks for has to be within kdf.DefaultLimits.
+func Decrypt(password []byte, eBlob SJCL_DataStruct) ([]byte, error) {
+	return DecryptLimits(password, eBlob, kdf.DefaultLimits)
+}
+
+// DecryptLimits is Decrypt with the KDF held to limits.
+func DecryptLimits(password []byte, eBlob SJCL_DataStruct, limits kdf.Limits) ([]byte, error) {
+	if err := eBlob.check(); err != nil {
+		return nil, err
+	}
+	nonce, nlen := GetNonce(eBlob)
+	ccm, err := newCCM(password, &eBlob, nlen, limits)
+	if err != nil {
+		return nil, err
+	}
+	return ccm.Open(nil, nonce, eBlob.CipherText, eBlob.AdditionalData)
+}
+
+// check rejects anything but version 1 AES-CCM with the key and tag sizes SJCL
+// allows - an AES key size and a CCM tag of 32 to 128 bits in steps of 16 - and
+// fills in the sizes in bytes.  It runs before the key is derived: "ks" is the
+// length asked of the KDF.
+func (eBlob *SJCL_DataStruct) check() error {
+	if eBlob.Cipher != "aes" || eBlob.Mode != "ccm" || eBlob.Version != 1 {
+		return BadSJCLData
+	}
+	if ks := eBlob.KeySize; ks != 128 && ks != 192 && ks != 256 {
+		return BadSJCLData
+	}
+	if ts := eBlob.TagSize; ts < 32 || ts > 128 || ts%16 != 0 {
+		return BadSJCLData
+	}
+	eBlob.TagSizeBytes = eBlob.TagSize / 8
+	eBlob.KeySizeBytes = eBlob.KeySize / 8
+	return nil
+}
+
+// encryptedJSON is SJCL_DataStruct without the "status" and "msg" of the
+// aesccm/restful responses.  The fields are in the order sjcl.encrypt() writes them.
+type encryptedJSON struct {
+	InitilizationVector base64data.Base64Data `json:"iv"`
+	Version             int                   `json:"v"`
+	Iter                int                   `json:"iter"`
+	KDF                 string                `json:"kdf,omitempty"`
+	KDFMemory           int                   `json:"m,omitempty"`
+	KDFCost             int                   `json:"n,omitempty"`
+	KDFBlockSize        int                   `json:"r,omitempty"`
+	KDFParallelism      int                   `json:"p,omitempty"`
+	KeySize             int                   `json:"ks"`
+	TagSize             int                   `json:"ts"`
+	Mode                string                `json:"mode"`
+	AdditionalData      base64data.Base64Data `json:"adata"`
+	Cipher              string                `json:"cipher"`
+	Salt                base64data.Base64Data `json:"salt"`
+	CipherText          base64data.Base64Data `json:"ct"`
+}
+
+// MarshalSJCL returns the JSON in the same shape as sjcl.encrypt(), so it can be
+// pasted into anything that takes SJCL output.  json.Marshal of the struct itself
+// adds "status" and "msg".
+func (eBlob *SJCL_DataStruct) MarshalSJCL() ([]byte, error) {
+	return json.Marshal(encryptedJSON{
+		InitilizationVector: eBlob.InitilizationVector,
+		Version:             eBlob.Version,
+		Iter:                eBlob.Iter,
+		KDF:                 eBlob.KDF,
+		KDFMemory:           eBlob.KDFMemory,
+		KDFCost:             eBlob.KDFCost,
+		KDFBlockSize:        eBlob.KDFBlockSize,
+		KDFParallelism:      eBlob.KDFParallelism,
+		KeySize:             eBlob.KeySize,
+		TagSize:             eBlob.TagSize,
+		Mode:                eBlob.Mode,
+		AdditionalData:      eBlob.AdditionalData,
+		Cipher:              eBlob.Cipher,
+		Salt:                eBlob.Salt,
+		CipherText:          eBlob.CipherText,
+	})
+}
+
+func newCCM(password []byte, eBlob *SJCL_DataStruct, nonceSize int, limits kdf.Limits) (aesccm.StreamCCM, error) {
+	key, err := limits.DeriveKey(eBlob.KDFParams(), password, eBlob.Salt, eBlob.KeySize/8)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		for i := range key {
+			key[i] = 0
+		}
+	}()
+	blk, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return aesccm.NewStreamCCM(blk, eBlob.TagSize/8, nonceSize)
+}
+
+/* vim: set noai ts=4 sw=4: */
@@ -21,20 +21,25 @@ import (
 // "github.com/pschlump/AesCCM"                 //
 
 type SJCL_DataStruct struct {
-	InitilizationVector base64data.Base64Data `json:"iv"`     // initilization vector or nonce for CCM mode
-	Version             int                   `json:"v"`      // should be constant 1 - version - only version suppoted
-	Iter                int                   `json:"iter"`   // PBKDF2 iteration count
-	KeySize             int                   `json:"ks"`     // keysize in bits - devide by 8 to get GO key size for pbkdf2
-	TagSize             int                   `json:"ts"`     // CCM tag size in bits
-	Mode                string                `json:"mode"`   // - should be constant "ccm" - only format supported
-	AdditionalData      base64data.Base64Data `json:"adata"`  // additional authenticated data
-	Cipher              string                `json:"cipher"` // - should be constant "aes" - only fomrat supported
-	Salt                base64data.Base64Data `json:"salt"`   // PBKDF2 salt
-	CipherText          base64data.Base64Data `json:"ct"`     // ciphertext
-	TagSizeBytes        int                   `json:"-"`      // Tag size converted to bytes
-	KeySizeBytes        int                   `json:"-"`      // Key size converted to bytes
-	Status              string                `json:"status"` // Response messages include a status of success/error
-	Msg                 string                `json:"msg"`    // Error response messages include a "msg"
+	InitilizationVector base64data.Base64Data `json:"iv"`            // initilization vector or nonce for CCM mode
+	Version             int                   `json:"v"`             // should be constant 1 - version - only version suppoted
+	Iter                int                   `json:"iter"`          // PBKDF2 iteration count, Argon2id passes
+	KDF                 string                `json:"kdf,omitempty"` // extension - key derivation function, see kdf package, "" is PBKDF2-SHA256
+	KDFMemory           int                   `json:"m,omitempty"`   // extension - Argon2id memory in KiB
+	KDFCost             int                   `json:"n,omitempty"`   // extension - scrypt N
+	KDFBlockSize        int                   `json:"r,omitempty"`   // extension - scrypt r
+	KDFParallelism      int                   `json:"p,omitempty"`   // extension - scrypt p, Argon2id threads
+	KeySize             int                   `json:"ks"`            // keysize in bits - devide by 8 to get GO key size for pbkdf2
+	TagSize             int                   `json:"ts"`            // CCM tag size in bits
+	Mode                string                `json:"mode"`          // - should be constant "ccm" - only format supported
+	AdditionalData      base64data.Base64Data `json:"adata"`         // additional authenticated data
+	Cipher              string                `json:"cipher"`        // - should be constant "aes" - only fomrat supported
+	Salt                base64data.Base64Data `json:"salt"`          // PBKDF2 salt
+	CipherText          base64data.Base64Data `json:"ct"`            // ciphertext
+	TagSizeBytes        int                   `json:"-"`             // Tag size converted to bytes
+	KeySizeBytes        int                   `json:"-"`             // Key size converted to bytes
+	Status              string                `json:"status"`        // Response messages include a status of success/error
+	Msg                 string                `json:"msg"`           // Error response messages include a "msg"
 }
 
 func ReadSJCL(fn string) (eBlob SJCL_DataStruct) {
@@ -66,6 +71,7 @@ func ReadSJCL(fn string) (eBlob SJCL_DataStruct) {
 }
 
 var BadSJCLData = errors.New("Invalid data in SJCL JSON message")
+var BadSJCLStream = errors.New("Invalid JSON in SJCL stream")
 
 func ConvertSJCL(file string) (eBlob SJCL_DataStruct, err error, msg string) {
 
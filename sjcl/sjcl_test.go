@@ -0,0 +1,91 @@
+package sjcl
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+
+	"github.com/pschlump/AesCCM/kdf"
+)
+
+// Made with PBKDF2-HMAC-SHA256 and AES-128-CCM exactly as sjcl.encrypt() does it:
+// 13 byte nonce from the front of the 16 byte IV, 64 bit tag.
+const sjclJSON = `{"iv":"oKGio6SlpqeoqaqrrK2urw==","v":1,"iter":1000,"ks":128,"ts":64,"mode":"ccm","adata":"YWRhdGE=","cipher":"aes","salt":"AQIDBAUGBwg=","ct":"qKFDdQ2BYOk0WYSpwylEILwS"}`
+
+func TestDecryptSJCL(t *testing.T) {
+	eBlob, err, msg := ConvertSJCL(sjclJSON)
+	if err != nil {
+		t.Fatalf("%s %s", err, msg)
+	}
+	pt, err := Decrypt([]byte("password"), eBlob)
+	if err != nil || string(pt) != "hello sjcl" {
+		t.Errorf("Decrypt: got %q %v", pt, err)
+	}
+	if _, err := Decrypt([]byte("Password"), eBlob); err == nil {
+		t.Errorf("Decrypt with the wrong password should have failed")
+	}
+	if _, err := DecryptLimits([]byte("password"), eBlob, kdf.Limits{MaxIter: 999}); err != kdf.ErrLimit {
+		t.Errorf("DecryptLimits under the iteration count: got %v", err)
+	}
+	eBlob.SetKDFParams(kdf.Params{Name: kdf.Argon2id, Iter: 1, Memory: 1<<32 - 1, P: 1})
+	if _, err := Decrypt([]byte("password"), eBlob); err != kdf.ErrLimit {
+		t.Errorf("Decrypt asking for 4 TiB of memory: got %v", err)
+	}
+
+	// Sizes SJCL does not allow are turned away before the key is derived; "ks"
+	// is how much key the KDF is asked for.
+	for ii, vv := range []struct{ ks, ts int }{
+		{ks: 2621440, ts: 64}, {ks: 64, ts: 64}, {ks: 136, ts: 64},
+		{ks: 128, ts: 0}, {ks: 128, ts: 16}, {ks: 128, ts: 40}, {ks: 128, ts: 144},
+	} {
+		bad := eBlob
+		bad.SetKDFParams(kdf.Params{Iter: 2000000})
+		bad.KeySize, bad.TagSize = vv.ks, vv.ts
+		if _, err := Decrypt([]byte("password"), bad); err != BadSJCLData {
+			t.Errorf("Test %d: ks %d ts %d: got %v", ii, vv.ks, vv.ts, err)
+		}
+	}
+}
+
+func TestEncryptKDFs(t *testing.T) {
+	for ii, p := range []kdf.Params{
+		{Iter: 1000},
+		{Name: kdf.PBKDF2SHA512, Iter: 1000},
+		{Name: kdf.Scrypt, N: 1024, R: 8, P: 1},
+		{Name: kdf.Argon2id, Iter: 1, Memory: 1024, P: 1},
+	} {
+		eBlob, err := Encrypt([]byte("secret"), []byte("a message"), []byte("adata"), p, 256, 128)
+		if err != nil {
+			t.Fatalf("Test %d: %s", ii, err)
+		}
+		buf, _ := json.Marshal(eBlob)
+		if p.Name == "" && bytes.Contains(buf, []byte(`"kdf"`)) {
+			t.Errorf("Test %d: PBKDF2-SHA256 output should look like plain SJCL: %s", ii, buf)
+		}
+		if p.Name != "" && !bytes.Contains(buf, []byte(`"kdf":"`+p.Name+`"`)) {
+			t.Errorf("Test %d: kdf not recorded: %s", ii, buf)
+		}
+
+		back, err, msg := ConvertSJCL(string(buf))
+		if err != nil {
+			t.Fatalf("Test %d: %s %s", ii, err, msg)
+		}
+		pt, err := Decrypt([]byte("secret"), back)
+		if err != nil || string(pt) != "a message" {
+			t.Errorf("Test %d: Decrypt got %q %v", ii, pt, err)
+		}
+	}
+}
+
+func TestMarshalSJCL(t *testing.T) {
+	eBlob, err, msg := ConvertSJCL(sjclJSON)
+	if err != nil {
+		t.Fatalf("%s %s", err, msg)
+	}
+	buf, err := eBlob.MarshalSJCL()
+	if err != nil || string(buf) != sjclJSON {
+		t.Errorf("MarshalSJCL: got %s %v, expected %s", buf, err, sjclJSON)
+	}
+}
+
+/* vim: set noai ts=4 sw=4: */
@@ -0,0 +1,324 @@
+package sjcl
+
+// Streaming SJCL JSON, for ciphertexts too large to hold in memory.
+//
+// Decrypt takes the whole SJCL_DataStruct, so a 200 MB upload is held three
+// times over: the JSON, the Base64 string inside it and the decoded bytes.
+// DecryptStream reads the JSON a field at a time and passes "ct" through a
+// Base64 decoder straight into a spool file; EncryptStream writes the other
+// fields and then "ct" through a Base64 encoder as the ciphertext is made.
+// Either way memory use is a few buffers, whatever the size.
+//
+// The ciphertext has to be spooled.  CCM needs its length before the first
+// block, SJCL picks the nonce length from it, and the tag at the very end has to
+// be checked before any plaintext is let out.  DecryptStream reads the spool
+// twice, once to check the tag and once for the plaintext.
+//
+// MIT Licensed.
+
+import (
+	"bufio"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/pschlump/AesCCM"
+	"github.com/pschlump/AesCCM/base64data"
+	"github.com/pschlump/AesCCM/kdf"
+	"github.com/pschlump/json"
+)
+
+const maxFields = 64 << 10 // the most JSON DecryptStream holds: everything but "ct"
+
+// EncryptStream is Encrypt reading the n bytes of plaintext from r and writing
+// the JSON to w, as MarshalSJCL would give it.
+func EncryptStream(w io.Writer, r io.Reader, n int64, password, adata []byte, p kdf.Params, keySize, tagSize int) error {
+	eBlob, err := newBlob(adata, p, keySize, tagSize)
+	if err != nil {
+		return err
+	}
+	ccm, err := newCCM(password, &eBlob, aesccm.CalculateNonceLengthFromMessageLength(int(n)), kdf.DefaultLimits)
+	if err != nil {
+		return err
+	}
+	head, err := eBlob.MarshalSJCL()
+	if err != nil {
+		return err
+	}
+
+	bw := bufio.NewWriter(w)
+	bw.Write(head[:len(head)-len(`"}`)]) // "ct" is last, and empty: ..."ct":""}
+	enc := base64.NewEncoder(base64.StdEncoding, bw)
+	if err := ccm.SealStream(enc, r, n, eBlob.InitilizationVector, adata); err != nil {
+		return err
+	}
+	if err := enc.Close(); err != nil {
+		return err
+	}
+	bw.WriteString(`"}`)
+	return bw.Flush()
+}
+
+// DecryptStream is Decrypt reading the JSON from r and writing the plaintext to
+// w.  The ciphertext is spooled to a temporary file in dir, os.TempDir() if dir
+// is "", which is removed before it returns.  Nothing is written to w unless the
+// tag matches.  The fields of the JSON are returned, without the ciphertext.
+// The KDF the JSON asks for has to be within kdf.DefaultLimits.
+func DecryptStream(w io.Writer, r io.Reader, password []byte, dir string) (eBlob SJCL_DataStruct, err error) {
+	return DecryptStreamLimits(w, r, password, dir, kdf.DefaultLimits)
+}
+
+// DecryptStreamLimits is DecryptStream with the KDF held to limits.
+func DecryptStreamLimits(w io.Writer, r io.Reader, password []byte, dir string, limits kdf.Limits) (eBlob SJCL_DataStruct, err error) {
+	spool, err := os.CreateTemp(dir, "sjcl-ct-")
+	if err != nil {
+		return
+	}
+	defer func() {
+		spool.Close()
+		os.Remove(spool.Name())
+	}()
+
+	var n int64
+	eBlob, err = decodeStream(r, func(ct io.Reader) (err error) {
+		n, err = io.Copy(spool, base64data.NewDecoder(ct))
+		return
+	})
+	if err != nil {
+		return
+	}
+	if err = eBlob.check(); err != nil {
+		return
+	}
+	nonce, nlen := streamNonce(eBlob, n)
+	ccm, err := newCCM(password, &eBlob, nlen, limits)
+	if err != nil {
+		return
+	}
+	for _, out := range []io.Writer{io.Discard, w} {
+		if _, err = spool.Seek(0, io.SeekStart); err != nil {
+			return
+		}
+		if err = ccm.OpenStream(out, spool, n, nonce, eBlob.AdditionalData); err != nil {
+			return
+		}
+	}
+	return
+}
+
+// streamNonce is GetNonce for n bytes of ciphertext and tag.
+func streamNonce(eBlob SJCL_DataStruct, n int64) (nonce []byte, nlen int) {
+	nonce = eBlob.InitilizationVector
+	nlen = min(aesccm.MaxNonceLength(int(n)-eBlob.TagSizeBytes), len(nonce))
+	return nonce[:nlen], nlen
+}
+
+// decodeStream reads one JSON object from r.  The string value of "ct" is passed
+// to ct as it is read, still Base64; the other fields, short and flat in SJCL,
+// are gathered up and unmarshalled into eBlob.
+func decodeStream(r io.Reader, ct func(io.Reader) error) (eBlob SJCL_DataStruct, err error) {
+	br := bufio.NewReader(r)
+	if err = expect(br, '{'); err != nil {
+		return
+	}
+	fields := []byte{'{'}
+	seenCT := false
+	for first := true; ; first = false {
+		c, err := nextByte(br)
+		if err != nil {
+			return eBlob, err
+		}
+		if c == '}' && first {
+			break
+		}
+		if c != '"' {
+			return eBlob, fmt.Errorf("%w: expected a field name, found %q", BadSJCLStream, c)
+		}
+		key, err := readString(br)
+		if err != nil {
+			return eBlob, err
+		}
+		if err = expect(br, ':'); err != nil {
+			return eBlob, err
+		}
+		var name string
+		if err = json.Unmarshal(key, &name); err != nil {
+			return eBlob, fmt.Errorf("%w: %v", BadSJCLStream, err)
+		}
+
+		if name == "ct" {
+			if seenCT {
+				return eBlob, fmt.Errorf(`%w: "ct" given twice`, BadSJCLStream)
+			}
+			seenCT = true
+			if err = expect(br, '"'); err != nil {
+				return eBlob, err
+			}
+			s := &stringReader{r: br}
+			if err = ct(s); err != nil {
+				return eBlob, err
+			}
+			if _, err = io.Copy(io.Discard, s); err != nil {
+				return eBlob, err
+			}
+		} else {
+			value, err := readValue(br)
+			if err != nil {
+				return eBlob, err
+			}
+			if len(fields) > 1 {
+				fields = append(fields, ',')
+			}
+			fields = append(append(append(fields, key...), ':'), value...)
+			if len(fields) > maxFields {
+				return eBlob, fmt.Errorf("%w: fields other than \"ct\" over %d bytes", BadSJCLStream, maxFields)
+			}
+		}
+
+		if c, err = nextByte(br); err != nil {
+			return eBlob, err
+		}
+		if c == '}' {
+			break
+		}
+		if c != ',' {
+			return eBlob, fmt.Errorf("%w: expected ',' or '}', found %q", BadSJCLStream, c)
+		}
+	}
+	if _, err = nextByte(br); err != io.ErrUnexpectedEOF {
+		return eBlob, fmt.Errorf("%w: data after the object", BadSJCLStream)
+	}
+	if !seenCT {
+		return eBlob, fmt.Errorf(`%w: no "ct"`, BadSJCLStream)
+	}
+	if err = json.Unmarshal(append(fields, '}'), &eBlob); err != nil {
+		err = fmt.Errorf("%w: %v", BadSJCLStream, err)
+	}
+	return
+}
+
+// nextByte returns the next byte that is not JSON white space.
+func nextByte(br *bufio.Reader) (byte, error) {
+	for {
+		c, err := br.ReadByte()
+		if err != nil {
+			return 0, unexpectedEOF(err)
+		}
+		if c != ' ' && c != '\t' && c != '\n' && c != '\r' {
+			return c, nil
+		}
+	}
+}
+
+func expect(br *bufio.Reader, want byte) error {
+	c, err := nextByte(br)
+	if err == nil && c != want {
+		err = fmt.Errorf("%w: expected %q, found %q", BadSJCLStream, want, c)
+	}
+	return err
+}
+
+// readString returns a JSON string, quotes and escapes and all, the opening
+// quote having been read.
+func readString(br *bufio.Reader) ([]byte, error) {
+	s := []byte{'"'}
+	for escaped := false; ; {
+		c, err := br.ReadByte()
+		if err != nil {
+			return nil, unexpectedEOF(err)
+		}
+		s = append(s, c)
+		switch {
+		case len(s) > maxFields:
+			return nil, fmt.Errorf("%w: string over %d bytes", BadSJCLStream, maxFields)
+		case escaped:
+			escaped = false
+		case c == '\\':
+			escaped = true
+		case c == '"':
+			return s, nil
+		}
+	}
+}
+
+// readValue returns the next JSON value, which in SJCL is a string or a number.
+func readValue(br *bufio.Reader) ([]byte, error) {
+	c, err := nextByte(br)
+	if err != nil {
+		return nil, err
+	}
+	switch c {
+	case '"':
+		return readString(br)
+	case '{', '[':
+		return nil, fmt.Errorf("%w: unexpected %q", BadSJCLStream, c)
+	}
+	// A number, true, false or null; json.Unmarshal checks which.
+	v := []byte{c}
+	for len(v) <= maxFields {
+		b, err := br.Peek(1)
+		if err == io.EOF || (err == nil && (b[0] == ',' || b[0] == '}' || b[0] == ']' || b[0] == ' ' || b[0] == '\t' || b[0] == '\n' || b[0] == '\r')) {
+			return v, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		br.ReadByte()
+		v = append(v, b[0])
+	}
+	return nil, fmt.Errorf("%w: value over %d bytes", BadSJCLStream, maxFields)
+}
+
+// stringReader reads the contents of a JSON string up to its closing quote,
+// undoing the escapes JSON encoders use for Base64: "\/", and the white space
+// some wrap it with.
+type stringReader struct {
+	r    *bufio.Reader
+	done bool
+}
+
+func (s *stringReader) Read(p []byte) (int, error) {
+	n := 0
+	for n < len(p) && !s.done {
+		c, err := s.r.ReadByte()
+		if err != nil {
+			return n, unexpectedEOF(err)
+		}
+		switch c {
+		case '"':
+			s.done = true
+			continue
+		case '\\':
+			if c, err = s.r.ReadByte(); err != nil {
+				return n, unexpectedEOF(err)
+			}
+			switch c {
+			case '/':
+			case 'n':
+				c = '\n'
+			case 'r':
+				c = '\r'
+			case 't':
+				c = '\t'
+			default:
+				return n, fmt.Errorf("%w: escape \\%c in \"ct\"", BadSJCLStream, c)
+			}
+		}
+		p[n] = c
+		n++
+	}
+	if n == 0 && s.done {
+		return 0, io.EOF
+	}
+	return n, nil
+}
+
+func unexpectedEOF(err error) error {
+	if err == io.EOF {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
+
+/* vim: set noai ts=4 sw=4: */
@@ -0,0 +1,165 @@
+package sjcl
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"testing/iotest"
+
+	"github.com/pschlump/AesCCM/kdf"
+)
+
+func TestDecryptStream(t *testing.T) {
+	var testData = []struct {
+		json   string
+		expect string
+		err    error
+	}{
+		{json: sjclJSON, expect: "hello sjcl"},
+		{json: "\n  " + strings.Replace(sjclJSON, `"ct":"qKFDdQ2BYOk0WYSpwylEILwS"`, `"ct" : "qKFDdQ2B\nYOk0WYSp\nwylEILwS"`, 1) + "\n", expect: "hello sjcl"},
+		{json: `{"ct":"qKFDdQ2BYOk0WYSpwylEILwS",` + sjclJSON[1:strings.Index(sjclJSON, `,"ct"`)] + "}", expect: "hello sjcl"},
+		{json: strings.Replace(sjclJSON, `"ct"`, `"c\u0074"`, 1), expect: "hello sjcl"},
+		{json: strings.Replace(sjclJSON, `"v":1`, `"v":2`, 1), err: BadSJCLData},
+		{json: strings.Replace(sjclJSON, `,"ct":"qKFDdQ2BYOk0WYSpwylEILwS"`, ``, 1), err: BadSJCLStream},
+		{json: strings.Replace(sjclJSON, `"ct"`, `"ct":"qKFD","ct"`, 1), err: BadSJCLStream},
+		{json: strings.Replace(sjclJSON, `"iter":1000`, `"iter":[1000]`, 1), err: BadSJCLStream},
+		{json: sjclJSON + "{}", err: BadSJCLStream},
+		{json: strings.Replace(sjclJSON, `"iter":1000`, `"iter":1000000000`, 1), err: kdf.ErrLimit},
+		{json: strings.Replace(sjclJSON, `"iter":1000`, `"iter":1,"kdf":"argon2id","m":4294967295,"p":1`, 1), err: kdf.ErrLimit},
+		{json: sjclJSON[:len(sjclJSON)-10], err: io.ErrUnexpectedEOF},
+	}
+
+	for ii, vv := range testData {
+		var pt bytes.Buffer
+		_, err := DecryptStream(&pt, iotest.OneByteReader(strings.NewReader(vv.json)), []byte("password"), t.TempDir())
+		switch {
+		case !errors.Is(err, vv.err):
+			t.Errorf("Test %d: got error %v, expected %v", ii, err, vv.err)
+		case err == nil && pt.String() != vv.expect:
+			t.Errorf("Test %d: got %q, expected %q", ii, pt.String(), vv.expect)
+		}
+	}
+}
+
+// What EncryptStream writes is what Encrypt would, and both decrypt either way.
+func TestStreamRoundTrip(t *testing.T) {
+	password := []byte("password")
+	p := kdf.Params{Iter: 1000}
+	dir := t.TempDir()
+
+	for _, n := range []int{0, 1, 100, 64<<10 + 17, 300 << 10} {
+		plaintext := make([]byte, n)
+		for i := range plaintext {
+			plaintext[i] = byte(i * 31)
+		}
+		var js bytes.Buffer
+		if err := EncryptStream(&js, bytes.NewReader(plaintext), int64(n), password, []byte("adata"), p, 256, 128); err != nil {
+			t.Fatalf("Len %d: EncryptStream %s", n, err)
+		}
+		var eBlob SJCL_DataStruct
+		if err := json.Unmarshal(js.Bytes(), &eBlob); err != nil {
+			t.Fatalf("Len %d: %s", n, err)
+		}
+		if again, _ := eBlob.MarshalSJCL(); !bytes.Equal(again, js.Bytes()) {
+			t.Errorf("Len %d: EncryptStream wrote\n%.200s, MarshalSJCL gives\n%.200s", n, js.Bytes(), again)
+		}
+		if pt, err := Decrypt(password, eBlob); err != nil || !bytes.Equal(pt, plaintext) {
+			t.Errorf("Len %d: Decrypt of EncryptStream failed, err=%v", n, err)
+		}
+
+		eBlob, err := Encrypt(password, plaintext, nil, p, 0, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		js.Reset()
+		buf, _ := eBlob.MarshalSJCL()
+		js.Write(bytes.ReplaceAll(buf, []byte("/"), []byte(`\/`))) // as PHP and others write it
+		var pt bytes.Buffer
+		if _, err := DecryptStream(&pt, &js, password, dir); err != nil || !bytes.Equal(pt.Bytes(), plaintext) {
+			t.Errorf("Len %d: DecryptStream of Encrypt failed, err=%v", n, err)
+		}
+		if _, err := DecryptStream(&pt, bytes.NewReader(buf), []byte("Password"), dir); err == nil {
+			t.Errorf("Len %d: DecryptStream with the wrong password should have failed", n)
+		}
+	}
+	if left, _ := filepath.Glob(filepath.Join(dir, "*")); len(left) != 0 {
+		t.Errorf("Spool files left behind: %v", left)
+	}
+}
+
+// Nothing reaches w when the tag does not match.
+func TestDecryptStreamTampered(t *testing.T) {
+	ct := strings.Index(sjclJSON, `"ct":"`) + len(`"ct":"`)
+	bad := sjclJSON[:ct] + "A" + sjclJSON[ct+1:]
+	var pt bytes.Buffer
+	if _, err := DecryptStream(&pt, strings.NewReader(bad), []byte("password"), t.TempDir()); err == nil || pt.Len() != 0 {
+		t.Errorf("Tampered ciphertext: err=%v, %d bytes written", err, pt.Len())
+	}
+}
+
+// Memory use does not grow with the size of the ciphertext.
+func TestStreamMemory(t *testing.T) {
+	if testing.Short() {
+		t.Skip("writes 32 MB")
+	}
+	const n = 24 << 20
+	f, err := os.Create(filepath.Join(t.TempDir(), "big.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	password := []byte("password")
+	p := kdf.Params{Iter: 1000}
+
+	alloc := allocated(func() {
+		err = EncryptStream(f, io.LimitReader(zeros{}, n), n, password, nil, p, 0, 0)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if alloc > 4<<20 {
+		t.Errorf("EncryptStream of %d bytes allocated %d", n, alloc)
+	}
+
+	f.Seek(0, io.SeekStart)
+	var out counter
+	alloc = allocated(func() {
+		_, err = DecryptStream(&out, f, password, t.TempDir())
+	})
+	if err != nil || out != n {
+		t.Fatalf("DecryptStream got %d bytes, err=%v", out, err)
+	}
+	if alloc > 4<<20 {
+		t.Errorf("DecryptStream of %d bytes allocated %d", n, alloc)
+	}
+}
+
+func allocated(f func()) uint64 {
+	var before, after runtime.MemStats
+	runtime.ReadMemStats(&before)
+	f()
+	runtime.ReadMemStats(&after)
+	return after.TotalAlloc - before.TotalAlloc
+}
+
+type zeros struct{}
+
+func (zeros) Read(p []byte) (int, error) {
+	clear(p)
+	return len(p), nil
+}
+
+type counter int64
+
+func (c *counter) Write(p []byte) (int, error) {
+	*c += counter(len(p))
+	return len(p), nil
+}
+
+/* vim: set noai ts=4 sw=4: */
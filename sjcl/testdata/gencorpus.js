@@ -0,0 +1,177 @@
+// Writes corpus.json, the SJCL compatibility vectors for corpus_test.go.
+//
+//	npm install sjcl
+//	node gencorpus.js > corpus.json
+//
+// Every blob is made by sjcl.encrypt() from the sjcl npm package, and
+// "generator" in the output names the package and its version; TestSJCLCorpus
+// fails on a corpus.json made any other way.  Salts, IVs and binary plaintexts
+// come from SHA-256 of fixed labels, so the output only changes when the
+// vectors or sjcl do.
+//
+//	node gencorpus.js -emulate > corpus-emulated.json
+//
+// writes the same vectors without the sjcl package: sjclEncrypt below follows
+// sjcl.encrypt() step for step - convenience.js and mode/ccm.js of SJCL 1.0 -
+// with Node's PBKDF2 and AES-CCM from OpenSSL underneath.  That only checks the
+// Go code against OpenSSL, not against SJCL.
+//
+// MIT Licensed
+
+const crypto = require('crypto');
+
+const emulate = process.argv.includes('-emulate');
+let sjcl = null;
+if (!emulate) {
+	try {
+		sjcl = require('sjcl');
+	} catch (e) {
+		process.stderr.write('gencorpus.js: the sjcl npm package is needed (npm install sjcl), or -emulate for corpus-emulated.json\n');
+		process.exit(1);
+	}
+}
+
+// Plaintexts longer than this are not written out: "pt_len" bytes of
+// byte(i % 251), and the ciphertext as "ct_len" and "ct_sha256".
+const inlineMax = 1024;
+
+function det(label, n) {
+	const out = [];
+	for (let i = 0; out.length * 32 < n; i++) {
+		out.push(crypto.createHash('sha256').update(label + '/' + i).digest());
+	}
+	return Buffer.concat(out).subarray(0, n);
+}
+
+function pattern(n) {
+	const b = Buffer.alloc(n);
+	for (let i = 0; i < n; i++) {
+		b[i] = i % 251;
+	}
+	return b;
+}
+
+// sjclEncrypt is sjcl.encrypt(password, pt, {iter, ks, ts, adata, salt, iv})
+// returning the same JSON string.
+function sjclEncrypt(password, pt, p) {
+	const key = crypto.pbkdf2Sync(Buffer.from(password, 'utf8'), p.salt, p.iter, p.ks / 8, 'sha256');
+
+	// mode/ccm.js: the length of the length, and the IV clamped to what is left.
+	const ivl = p.iv.length;
+	let L;
+	for (L = 2; L < 4 && (pt.length >>> 8 * L); L++) {
+	}
+	if (L < 15 - ivl) {
+		L = 15 - ivl;
+	}
+	const nonce = p.iv.subarray(0, 15 - L);
+	const tlen = p.ts / 8;
+
+	let ct;
+	if (pt.length === 0 && p.adata.length === 0) {
+		// OpenSSL will not make a tag over nothing at all: T = E(B_0) ^ E(A_0).
+		const ecb = crypto.createCipheriv('aes-' + p.ks + '-ecb', key, null);
+		const b0 = Buffer.alloc(16), a0 = Buffer.alloc(16);
+		b0[0] = ((tlen - 2) / 2) << 3 | (L - 1);
+		a0[0] = L - 1;
+		nonce.copy(b0, 1);
+		nonce.copy(a0, 1);
+		const e = ecb.update(Buffer.concat([b0, a0]));
+		ct = Buffer.alloc(tlen);
+		for (let i = 0; i < tlen; i++) {
+			ct[i] = e[i] ^ e[16 + i];
+		}
+	} else {
+		const c = crypto.createCipheriv('aes-' + p.ks + '-ccm', key, nonce, {authTagLength: tlen});
+		c.setAAD(p.adata, {plaintextLength: pt.length});
+		ct = Buffer.concat([c.update(pt), c.final(), c.getAuthTag()]);
+	}
+
+	// convenience.js writes the fields in this order.
+	return '{"iv":"' + p.iv.toString('base64') + '","v":1,"iter":' + p.iter + ',"ks":' + p.ks + ',"ts":' + p.ts +
+		',"mode":"ccm","adata":"' + p.adata.toString('base64') + '","cipher":"aes","salt":"' + p.salt.toString('base64') +
+		'","ct":"' + ct.toString('base64') + '"}';
+}
+
+function encrypt(password, pt, p) {
+	if (!sjcl) {
+		return sjclEncrypt(password, pt, p);
+	}
+	const bits = (b) => sjcl.codec.base64.toBits(b.toString('base64'));
+	return sjcl.encrypt(password, bits(pt), {iter: p.iter, ks: p.ks, ts: p.ts, adata: bits(p.adata), salt: bits(p.salt), iv: bits(p.iv)});
+}
+
+const vectors = [];
+
+function add(name, password, pt, params) {
+	const p = Object.assign({iter: 1000, ks: 128, ts: 64, adata: Buffer.alloc(0), ivl: 16}, params);
+	p.salt = det(name + '/salt', 8);
+	p.iv = det(name + '/iv', p.ivl);
+	const js = encrypt(password, pt, p);
+	const v = {name: name, password: password};
+	if (pt.length > inlineMax) {
+		const ct = Buffer.from(JSON.parse(js).ct, 'base64');
+		v.pt_len = pt.length;
+		v.ct_len = ct.length;
+		v.ct_sha256 = crypto.createHash('sha256').update(ct).digest('hex');
+		v.json = js.replace(/"ct":"[^"]*"/, '"ct":""');
+	} else {
+		const text = pt.toString('utf8');
+		if (Buffer.from(text, 'utf8').equals(pt)) {
+			v.pt = text;
+		} else {
+			v.pt_base64 = pt.toString('base64');
+		}
+		v.json = js;
+	}
+	vectors.push(v);
+}
+
+// Every key size, tag size and adata against short plaintexts around a block.
+const texts = {
+	empty: Buffer.alloc(0),
+	one: Buffer.from('a'),
+	fifteen: Buffer.from('fifteen bytes!!'),
+	sixteen: Buffer.from('sixteen bytes!!!'),
+	seventeen: Buffer.from('seventeen bytes!!'),
+	binary: det('binary', 100),
+};
+for (const ks of [128, 192, 256]) {
+	for (const ts of [64, 96, 128]) {
+		for (const adata of ['', 'adata']) {
+			for (const [tn, pt] of Object.entries(texts)) {
+				add(`ks${ks}/ts${ts}/adata${adata.length}/${tn}`, 'password', pt, {ks: ks, ts: ts, adata: Buffer.from(adata)});
+			}
+		}
+	}
+}
+
+// Shorter IVs leave a shorter nonce and a longer length field.
+for (const ivl of [8, 12]) {
+	for (const n of [0, 17, 1000]) {
+		add(`iv${ivl}/len${n}`, 'password', pattern(n), {ivl: ivl, adata: Buffer.from('iv length')});
+	}
+}
+
+// UTF-8 passwords and text, long adata, other iteration counts.
+add('utf8', 'pässwörd ✓', Buffer.from('日本語のテキスト ✓'), {adata: Buffer.from('ädata')});
+add('adata/long', 'password', Buffer.from('long adata'), {ts: 128, adata: det('long adata', 700)});
+add('iter/100', 'password', Buffer.from('the fewest sjcl.encrypt() allows'), {iter: 100});
+add('iter/10000', 'password', Buffer.from('the sjcl.encrypt() default'), {iter: 10000});
+add('block/1024', 'password', pattern(1024), {ks: 256, ts: 128});
+
+// Either side of L = 2 / L = 3 (64 KiB) and L = 3 / L = 4 (16 MiB).
+for (const n of [65535, 65536, 65537]) {
+	add(`L/len${n}`, 'password', pattern(n), {});
+	add(`L/len${n}/ks256`, 'password', pattern(n), {ks: 256, ts: 128, adata: Buffer.from('adata')});
+}
+add('L/len65536/iv12', 'password', pattern(65536), {ivl: 12});
+for (const n of [16777215, 16777216]) {
+	add(`L/len${n}`, 'password', pattern(n), {});
+	add(`L/len${n}/ks192`, 'password', pattern(n), {ks: 192, ts: 96});
+}
+add('L/len16777216/iv8', 'password', pattern(16777216), {ivl: 8});
+
+const generator = sjcl ? 'sjcl.encrypt() from the sjcl npm package ' + require('sjcl/package.json').version :
+	'gencorpus.js sjclEncrypt, Node ' + process.version + ' crypto';
+process.stdout.write(JSON.stringify({generator: generator, vectors: vectors}, null, '\t') + '\n');
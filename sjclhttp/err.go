@@ -0,0 +1,11 @@
+package sjclhttp
+
+import "errors"
+
+var ErrNoKey = errors.New("SJCLHTTP: no key for the request")
+var ErrDecrypt = errors.New("SJCLHTTP: the request body did not decrypt")
+var ErrTooLarge = errors.New("SJCLHTTP: the request body is too large")
+var ErrKDF = errors.New("SJCLHTTP: the request's key derivation is not allowed")
+var ErrEncrypt = errors.New("SJCLHTTP: the response could not be encrypted")
+
+/* vim: set noai ts=4 sw=4: */
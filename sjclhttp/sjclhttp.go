@@ -0,0 +1,175 @@
+package sjclhttp
+
+// net/http middleware speaking SJCL JSON, the wire format of the Go-FTL AesSRP
+// middleware.
+//
+// A request body is the JSON sjcl.encrypt(key, text) makes in the browser; the
+// handler gets the plaintext as the body.  What the handler writes is encrypted
+// with the same key and sent back as SJCL JSON with the "status" and "msg" the
+// aesccm/restful clients look for:
+//
+//	{"iv":"...","v":1,"iter":10000,...,"ct":"...","status":"success","msg":""}
+//
+// The request names its own KDF and cost, and the key is derived before the tag
+// can be checked, so anyone can make the server do that work.  Options limits
+// the body size and the KDFs a request may ask for, and anything else is turned
+// away before a key is derived.  The response is encrypted with the KDF, key size
+// and tag size from Options, never the request's.
+//
+// Errors - no key, a body that is too big or does not decrypt, a handler status
+// of 400 or more - go back in the clear as {"status":"error","msg":"..."}, so a
+// client without the right key can still read them.  The msg of a handler error
+// is the body the handler wrote.
+//
+// MIT Licensed.
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/pschlump/AesCCM/kdf"
+	"github.com/pschlump/AesCCM/sjcl"
+	"github.com/pschlump/json"
+)
+
+// Options are what MiddlewareOptions accepts and sends.  Zero fields take the defaults.
+type Options struct {
+	MaxBodyBytes int64       // largest request body, DefaultMaxBodyBytes if 0
+	Limits       *kdf.Limits // KDFs and costs a request may use, DefaultLimits if nil
+	KDF          kdf.Params  // KDF for responses, PBKDF2-SHA256 with sjcl.DefaultIter if zero
+	KeySize      int         // response key size in bits, sjcl.DefaultKeySize if 0
+	TagSize      int         // response tag size in bits, sjcl.DefaultTagSize if 0
+}
+
+// DefaultMaxBodyBytes is the largest request body, JSON and all, accepted when
+// Options.MaxBodyBytes is 0.
+const DefaultMaxBodyBytes = 1 << 20
+
+// DefaultLimits allows only what sjcl.encrypt() uses, PBKDF2-HMAC-SHA256, with
+// up to ten times its default iteration count.
+var DefaultLimits = kdf.Limits{MaxIter: 10 * sjcl.DefaultIter, Allow: []string{kdf.PBKDF2SHA256}}
+
+// Middleware returns middleware that decrypts request bodies and encrypts
+// responses with the key keyLookup gives for the request.  The key is used as
+// the SJCL password, what the client passes to sjcl.encrypt().  It uses the
+// default Options: DefaultMaxBodyBytes, DefaultLimits and the SJCL defaults.
+func Middleware(keyLookup func(*http.Request) ([]byte, error)) func(http.Handler) http.Handler {
+	return MiddlewareOptions(keyLookup, Options{})
+}
+
+// MiddlewareOptions is Middleware with the body size, the KDF limits and the
+// response parameters taken from opts.
+func MiddlewareOptions(keyLookup func(*http.Request) ([]byte, error), opts Options) func(http.Handler) http.Handler {
+	if opts.MaxBodyBytes == 0 {
+		opts.MaxBodyBytes = DefaultMaxBodyBytes
+	}
+	if opts.Limits == nil {
+		opts.Limits = &DefaultLimits
+	}
+	if opts.KDF == (kdf.Params{}) {
+		opts.KDF = kdf.Params{Iter: sjcl.DefaultIter}
+	}
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			key, err := keyLookup(r)
+			if err != nil {
+				writeError(w, http.StatusUnauthorized, ErrNoKey.Error())
+				return
+			}
+
+			if hasBody(r) {
+				var pt bytes.Buffer
+				_, err := sjcl.DecryptStreamLimits(&pt, http.MaxBytesReader(w, r.Body, opts.MaxBodyBytes), key, "", *opts.Limits)
+				r.Body.Close()
+				var tooBig *http.MaxBytesError
+				switch {
+				case errors.As(err, &tooBig):
+					writeError(w, http.StatusRequestEntityTooLarge, ErrTooLarge.Error())
+					return
+				case errors.Is(err, kdf.ErrLimit) || errors.Is(err, kdf.ErrUnknownKDF) || errors.Is(err, kdf.ErrParams):
+					writeError(w, http.StatusBadRequest, ErrKDF.Error())
+					return
+				case err != nil:
+					writeError(w, http.StatusBadRequest, ErrDecrypt.Error())
+					return
+				}
+				r = r.Clone(r.Context())
+				r.Body = io.NopCloser(&pt)
+				r.ContentLength = int64(pt.Len())
+				r.Header.Set("Content-Length", strconv.Itoa(pt.Len()))
+			}
+
+			rw := &responseWriter{ResponseWriter: w, status: http.StatusOK}
+			next.ServeHTTP(rw, r)
+			switch {
+			case rw.status == http.StatusNoContent || rw.status == http.StatusNotModified:
+				w.WriteHeader(rw.status)
+				return
+			case rw.status >= 400:
+				writeError(w, rw.status, strings.TrimSpace(rw.buf.String()))
+				return
+			}
+			eBlob, err := sjcl.Encrypt(key, rw.buf.Bytes(), nil, opts.KDF, opts.KeySize, opts.TagSize)
+			if err != nil {
+				writeError(w, http.StatusInternalServerError, ErrEncrypt.Error())
+				return
+			}
+			eBlob.Status = "success"
+			buf, err := json.Marshal(eBlob)
+			if err != nil {
+				writeError(w, http.StatusInternalServerError, ErrEncrypt.Error())
+				return
+			}
+			writeJSON(w, rw.status, buf)
+		})
+	}
+}
+
+// hasBody is false for the GETs and HEADs that have nothing to decrypt.
+func hasBody(r *http.Request) bool {
+	return r.Body != nil && r.Body != http.NoBody && r.ContentLength != 0
+}
+
+// responseWriter holds on to the status and body until the handler is done, so
+// the whole body can be encrypted.  Headers go straight to the real writer.
+type responseWriter struct {
+	http.ResponseWriter
+	status      int
+	wroteHeader bool
+	buf         bytes.Buffer
+}
+
+func (rw *responseWriter) WriteHeader(status int) {
+	if !rw.wroteHeader {
+		rw.status, rw.wroteHeader = status, true
+	}
+}
+
+func (rw *responseWriter) Write(p []byte) (int, error) {
+	rw.wroteHeader = true
+	return rw.buf.Write(p)
+}
+
+type errorJSON struct {
+	Status string `json:"status"`
+	Msg    string `json:"msg"`
+}
+
+func writeError(w http.ResponseWriter, status int, msg string) {
+	buf, _ := json.Marshal(errorJSON{Status: "error", Msg: msg})
+	writeJSON(w, status, buf)
+}
+
+func writeJSON(w http.ResponseWriter, status int, buf []byte) {
+	h := w.Header()
+	h.Del("Content-Length") // any the handler set was for the plaintext
+	h.Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(status)
+	w.Write(buf)
+}
+
+/* vim: set noai ts=4 sw=4: */
@@ -0,0 +1,165 @@
+package sjclhttp
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/pschlump/AesCCM/kdf"
+	"github.com/pschlump/AesCCM/sjcl"
+)
+
+var keys = map[string][]byte{
+	"alice": []byte("alice's session key"),
+	"bob":   []byte("bob's session key"),
+}
+
+func keyLookup(r *http.Request) ([]byte, error) {
+	if key, ok := keys[r.Header.Get("X-Session")]; ok {
+		return key, nil
+	}
+	return nil, errors.New("no session")
+}
+
+// upper echoes the body in upper case, or answers /missing with a 404.
+func upper(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path == "/missing" {
+		http.Error(w, "nothing here", http.StatusNotFound)
+		return
+	}
+	body, _ := io.ReadAll(r.Body)
+	if int64(len(body)) != r.ContentLength {
+		http.Error(w, "bad Content-Length", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Length", "999")
+	w.WriteHeader(http.StatusCreated)
+	w.Write(bytes.ToUpper(body))
+	w.Write([]byte(" from " + r.Method))
+}
+
+func TestMiddleware(t *testing.T) {
+	srv := httptest.NewServer(Middleware(keyLookup)(http.HandlerFunc(upper)))
+	defer srv.Close()
+
+	encrypt := func(key []byte, text string, p kdf.Params) string {
+		eBlob, err := sjcl.Encrypt(key, []byte(text), nil, p, 256, 128)
+		if err != nil {
+			t.Fatal(err)
+		}
+		buf, _ := eBlob.MarshalSJCL()
+		return string(buf)
+	}
+	iter1000 := kdf.Params{Iter: 1000}
+
+	var testData = []struct {
+		method, path, session, body string
+		status                      int
+		expect                      string // the plaintext, or the msg of an error
+		iter                        int
+	}{
+		{method: "POST", path: "/", session: "alice", body: encrypt(keys["alice"], "hello", iter1000), status: http.StatusCreated, expect: "HELLO from POST", iter: sjcl.DefaultIter},
+		{method: "GET", path: "/", session: "bob", status: http.StatusCreated, expect: " from GET", iter: sjcl.DefaultIter},
+		{method: "POST", path: "/", session: "bob", body: encrypt(keys["alice"], "hello", iter1000), status: http.StatusBadRequest, expect: ErrDecrypt.Error()},
+		{method: "POST", path: "/", session: "bob", body: `{"iv":`, status: http.StatusBadRequest, expect: ErrDecrypt.Error()},
+		{method: "POST", path: "/", session: "eve", body: encrypt(keys["alice"], "hello", iter1000), status: http.StatusUnauthorized, expect: ErrNoKey.Error()},
+		{method: "POST", path: "/", session: "alice", body: encrypt(keys["alice"], "hello", kdf.Params{Name: kdf.Argon2id, Iter: 1, Memory: 64, P: 1}), status: http.StatusBadRequest, expect: ErrKDF.Error()},
+		{method: "POST", path: "/", session: "alice", body: strings.Replace(encrypt(keys["alice"], "hello", iter1000), `"iter":1000`, `"iter":2000000000`, 1), status: http.StatusBadRequest, expect: ErrKDF.Error()},
+		{method: "POST", path: "/", session: "alice", body: encrypt(keys["alice"], strings.Repeat("x", DefaultMaxBodyBytes), iter1000), status: http.StatusRequestEntityTooLarge, expect: ErrTooLarge.Error()},
+		// A huge "ks" would have the KDF make megabytes of key at the highest
+		// iteration count allowed.
+		{method: "POST", path: "/", session: "alice", body: strings.NewReplacer(`"iter":1000`, `"iter":100000`, `"ks":256`, `"ks":2621440`).Replace(encrypt(keys["alice"], "hello", iter1000)), status: http.StatusBadRequest, expect: ErrDecrypt.Error()},
+		{method: "GET", path: "/missing", session: "alice", status: http.StatusNotFound, expect: "nothing here"},
+	}
+
+	for ii, vv := range testData {
+		req, _ := http.NewRequest(vv.method, srv.URL+vv.path, strings.NewReader(vv.body))
+		req.Header.Set("X-Session", vv.session)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if resp.StatusCode != vv.status || resp.Header.Get("Content-Type") != "application/json; charset=utf-8" {
+			t.Errorf("Test %d: got %d %q, expected %d", ii, resp.StatusCode, resp.Header.Get("Content-Type"), vv.status)
+			continue
+		}
+
+		var eBlob sjcl.SJCL_DataStruct
+		if err := json.Unmarshal(body, &eBlob); err != nil {
+			t.Errorf("Test %d: %s %s", ii, body, err)
+			continue
+		}
+		if vv.status >= 400 {
+			if eBlob.Status != "error" || eBlob.Msg != vv.expect {
+				t.Errorf("Test %d: got %s, expected error %q", ii, body, vv.expect)
+			}
+			continue
+		}
+		if eBlob.Status != "success" || eBlob.Iter != vv.iter {
+			t.Errorf("Test %d: got status %q iter %d, expected success %d", ii, eBlob.Status, eBlob.Iter, vv.iter)
+		}
+		pt, err := sjcl.Decrypt(keys[vv.session], eBlob)
+		if err != nil || string(pt) != vv.expect {
+			t.Errorf("Test %d: response decrypts to %q %v, expected %q", ii, pt, err, vv.expect)
+		}
+	}
+}
+
+// The response is sealed with the server's choice of KDF and sizes, whatever the
+// request used.
+func TestMiddlewareOptions(t *testing.T) {
+	opts := Options{MaxBodyBytes: 512, KDF: kdf.Params{Name: kdf.Scrypt, N: 1024, R: 8, P: 1}, KeySize: 192, TagSize: 96}
+	h := MiddlewareOptions(keyLookup, opts)(http.HandlerFunc(upper))
+	for ii, vv := range []struct {
+		text   string
+		status int
+	}{
+		{text: "hello", status: http.StatusCreated},
+		{text: strings.Repeat("x", 512), status: http.StatusRequestEntityTooLarge},
+	} {
+		eBlob, _ := sjcl.Encrypt(keys["alice"], []byte(vv.text), nil, kdf.Params{Iter: 1000}, 128, 64)
+		body, _ := eBlob.MarshalSJCL()
+		req := httptest.NewRequest("POST", "/", bytes.NewReader(body))
+		req.Header.Set("X-Session", "alice")
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		if rec.Code != vv.status {
+			t.Errorf("Test %d: got %d %s, expected %d", ii, rec.Code, rec.Body.String(), vv.status)
+			continue
+		}
+		if vv.status >= 400 {
+			continue
+		}
+		var reply sjcl.SJCL_DataStruct
+		json.Unmarshal(rec.Body.Bytes(), &reply)
+		if reply.KDFParams() != opts.KDF || reply.KeySize != 192 || reply.TagSize != 96 {
+			t.Errorf("Test %d: reply sealed with %+v %d %d", ii, reply.KDFParams(), reply.KeySize, reply.TagSize)
+		}
+		if pt, err := sjcl.Decrypt(keys["alice"], reply); err != nil || string(pt) != "HELLO from POST" {
+			t.Errorf("Test %d: reply decrypts to %q %v", ii, pt, err)
+		}
+	}
+}
+
+// A 204 goes out as it is, with no body to encrypt.
+func TestMiddlewareNoContent(t *testing.T) {
+	h := Middleware(keyLookup)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	req := httptest.NewRequest("DELETE", "/", nil)
+	req.Header.Set("X-Session", "alice")
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	if rec.Code != http.StatusNoContent || rec.Body.Len() != 0 {
+		t.Errorf("Got %d %q", rec.Code, rec.Body.String())
+	}
+}
+
+/* vim: set noai ts=4 sw=4: */
@@ -0,0 +1,41 @@
+package sm4
+
+import (
+	"encoding/hex"
+	"testing"
+)
+
+// Test vectors from GB/T 32907-2016 Appendix A.
+func TestSM4(t *testing.T) {
+	key, _ := hex.DecodeString("0123456789abcdeffedcba9876543210")
+	c, err := NewCipher(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	out := make([]byte, BlockSize)
+	c.Encrypt(out, key)
+	if got := hex.EncodeToString(out); got != "681edf34d206965e86b3e94f536e4246" {
+		t.Errorf("Encrypt: got %s", got)
+	}
+	c.Decrypt(out, out)
+	if got := hex.EncodeToString(out); got != "0123456789abcdeffedcba9876543210" {
+		t.Errorf("Decrypt: got %s", got)
+	}
+
+	if testing.Short() {
+		return
+	}
+	copy(out, key)
+	for i := 0; i < 1000000; i++ {
+		c.Encrypt(out, out)
+	}
+	if got := hex.EncodeToString(out); got != "595298c7c6fd271f0402f804c33d3f66" {
+		t.Errorf("Encrypt 1,000,000 times: got %s", got)
+	}
+
+	if _, err := NewCipher(make([]byte, 24)); err != ErrKeySize {
+		t.Errorf("NewCipher with a 24 byte key: expected ErrKeySize, got %v", err)
+	}
+}
+
+/* vim: set noai ts=4 sw=4: */
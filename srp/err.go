@@ -0,0 +1,10 @@
+package srp
+
+import "errors"
+
+var ErrUnknownGroup = errors.New("SRP: not one of the RFC 5054 groups")
+var ErrBadPublic = errors.New("SRP: invalid public value")
+var ErrBadProof = errors.New("SRP: proof does not match")
+var ErrOrder = errors.New("SRP: handshake step out of order")
+
+/* vim: set noai ts=4 sw=4: */
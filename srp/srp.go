@@ -0,0 +1,290 @@
+package srp
+
+// SRP-6a password authenticated key exchange, compatible with
+// sjcl.keyexchange.srp.
+//
+// SJCL supplies the pieces a browser needs - the RFC 5054 groups, makeX and
+// makeVerifier - and the rest of the handshake follows RFC 5054, with SHA-1 as
+// SJCL's x uses:
+//
+//	x  = SHA1(s | SHA1(I | ":" | P))		sjcl.keyexchange.srp.makeX
+//	v  = g^x % N							sjcl.keyexchange.srp.makeVerifier
+//	k  = SHA1(N | PAD(g))
+//	A  = g^a % N							the client's public value
+//	B  = (k*v + g^b) % N					the server's public value
+//	u  = SHA1(PAD(A) | PAD(B))
+//	S  = (B - k*g^x)^(a + u*x) % N			on the client
+//	S  = (A * v^u)^b % N					on the server
+//	K  = SHA1(PAD(S))
+//	M1 = SHA1(SHA1(N) ^ SHA1(g) | SHA1(I) | s | PAD(A) | PAD(B) | K)
+//	M2 = SHA1(PAD(A) | M1 | K)
+//
+// PAD is big endian, filled out with zeros to the length of N.  The messages are
+//
+//	client -> server	I, A		Client.Public
+//	server -> client	s, B		Server.Public
+//	client -> server	M1			Client.Respond
+//	server -> client	M2			Server.Verify
+//
+// and once the other side's proof has checked out each side has a Session.  Its
+// Password is K in hex, what the browser passes to sjcl.encrypt() as
+// sjcl.codec.hex.fromBits(K), and what sjclhttp.Middleware wants from its
+// keyLookup; NewCCM gives a CCM for Go to Go traffic.
+//
+// MIT Licensed.
+
+import (
+	"crypto/aes"
+	"crypto/hkdf"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"io"
+	"math/big"
+
+	"github.com/pschlump/AesCCM"
+)
+
+const (
+	SaltSize    = 16 // bytes of salt NewVerifier picks
+	secretSize  = 32 // bytes of a and b
+	sessionInfo = "AESCCM SRP session key"
+)
+
+// Group is an SRP group: a safe prime N and a generator g.
+type Group struct {
+	Bits int
+	N    *big.Int
+	G    *big.Int
+}
+
+// KnownGroup returns the RFC 5054 group of bits bits, 1024, 1536, 2048, 3072,
+// 4096, 6144 or 8192, as sjcl.keyexchange.srp.knownGroup does.
+func KnownGroup(bits int) (*Group, error) {
+	kg, ok := knownGroups[bits]
+	if !ok {
+		return nil, ErrUnknownGroup
+	}
+	n, _ := new(big.Int).SetString(kg.n, 16)
+	return &Group{Bits: bits, N: n, G: big.NewInt(kg.g)}, nil
+}
+
+// pad is PAD: x big endian in as many bytes as N.
+func (grp *Group) pad(x *big.Int) []byte {
+	return x.FillBytes(make([]byte, (grp.Bits+7)/8))
+}
+
+// k is the SRP-6a multiplier, SHA1(N | PAD(g)).
+func (grp *Group) k() *big.Int {
+	return hashInt(grp.N.Bytes(), grp.pad(grp.G))
+}
+
+// public checks a public value from the other side: 0 mod N would let it fix S.
+func (grp *Group) public(b []byte) (*big.Int, error) {
+	x := new(big.Int).SetBytes(b)
+	if len(b) == 0 || new(big.Int).Mod(x, grp.N).Sign() == 0 {
+		return nil, ErrBadPublic
+	}
+	return x, nil
+}
+
+// MakeX is sjcl.keyexchange.srp.makeX, SHA1(salt | SHA1(I | ":" | P)).
+func MakeX(I, P string, salt []byte) []byte {
+	inner := sha1.Sum([]byte(I + ":" + P))
+	return hash(salt, inner[:])
+}
+
+// MakeVerifier is sjcl.keyexchange.srp.makeVerifier, g^x mod N, what the server
+// stores in place of the password.
+func MakeVerifier(I, P string, salt []byte, grp *Group) *big.Int {
+	x := new(big.Int).SetBytes(MakeX(I, P, salt))
+	return new(big.Int).Exp(grp.G, x, grp.N)
+}
+
+// NewVerifier picks a random salt and returns it with the verifier for I and P,
+// for the server to store when the user registers.
+func NewVerifier(I, P string, grp *Group) (salt []byte, v *big.Int, err error) {
+	salt = make([]byte, SaltSize)
+	if _, err = io.ReadFull(rand.Reader, salt); err != nil {
+		return nil, nil, err
+	}
+	return salt, MakeVerifier(I, P, salt, grp), nil
+}
+
+// Client is the user's side of one handshake.
+type Client struct {
+	grp  *Group
+	I, P string
+	a, A *big.Int
+	K    []byte
+	M1   []byte
+}
+
+// NewClient starts a handshake for user I with password P.
+func NewClient(grp *Group, I, P string) (*Client, error) {
+	a, err := randomSecret()
+	if err != nil {
+		return nil, err
+	}
+	return newClient(grp, I, P, a), nil
+}
+
+func newClient(grp *Group, I, P string, a *big.Int) *Client {
+	return &Client{grp: grp, I: I, P: P, a: a, A: new(big.Int).Exp(grp.G, a, grp.N)}
+}
+
+// Public returns A, to send to the server with I.
+func (c *Client) Public() []byte {
+	return c.grp.pad(c.A)
+}
+
+// Respond takes the salt and B from the server and returns M1, the client's
+// proof that it knows the password.
+func (c *Client) Respond(salt, B []byte) ([]byte, error) {
+	grp := c.grp
+	b, err := grp.public(B)
+	if err != nil {
+		return nil, err
+	}
+	u := hashInt(grp.pad(c.A), grp.pad(b))
+	if u.Sign() == 0 {
+		return nil, ErrBadPublic
+	}
+	x := new(big.Int).SetBytes(MakeX(c.I, c.P, salt))
+
+	// S = (B - k*g^x)^(a + u*x) % N
+	base := new(big.Int).Exp(grp.G, x, grp.N)
+	base.Mul(base, grp.k())
+	base.Sub(b, base)
+	base.Mod(base, grp.N)
+	exp := new(big.Int).Mul(u, x)
+	exp.Add(exp, c.a)
+	S := new(big.Int).Exp(base, exp, grp.N)
+
+	c.K = hash(grp.pad(S))
+	c.M1 = proof(grp, c.I, salt, c.A, b, c.K)
+	return c.M1, nil
+}
+
+// Verify checks M2, the server's proof, and returns the session.
+func (c *Client) Verify(M2 []byte) (*Session, error) {
+	if c.M1 == nil {
+		return nil, ErrOrder
+	}
+	if subtle.ConstantTimeCompare(M2, hash(c.grp.pad(c.A), c.M1, c.K)) != 1 {
+		return nil, ErrBadProof
+	}
+	return &Session{K: c.K}, nil
+}
+
+// Server is the server's side of one handshake.
+type Server struct {
+	grp  *Group
+	I    string
+	salt []byte
+	v    *big.Int
+	b, B *big.Int
+}
+
+// NewServer starts the server's side of a handshake with user I, whose salt and
+// verifier were stored when they registered.
+func NewServer(grp *Group, I string, salt []byte, v *big.Int) (*Server, error) {
+	b, err := randomSecret()
+	if err != nil {
+		return nil, err
+	}
+	return newServer(grp, I, salt, v, b), nil
+}
+
+func newServer(grp *Group, I string, salt []byte, v, b *big.Int) *Server {
+	// B = (k*v + g^b) % N
+	B := new(big.Int).Exp(grp.G, b, grp.N)
+	B.Add(B, new(big.Int).Mul(grp.k(), v))
+	B.Mod(B, grp.N)
+	return &Server{grp: grp, I: I, salt: salt, v: v, b: b, B: B}
+}
+
+// Public returns the salt and B, to send to the client.
+func (s *Server) Public() (salt, B []byte) {
+	return s.salt, s.grp.pad(s.B)
+}
+
+// Verify checks the client's A and M1 and returns M2, the server's proof, to
+// send back, and the session.  ErrBadProof means the password was wrong.
+func (s *Server) Verify(A, M1 []byte) ([]byte, *Session, error) {
+	grp := s.grp
+	a, err := grp.public(A)
+	if err != nil {
+		return nil, nil, err
+	}
+	u := hashInt(grp.pad(a), grp.pad(s.B))
+
+	// S = (A * v^u)^b % N
+	S := new(big.Int).Exp(s.v, u, grp.N)
+	S.Mul(S, a)
+	S.Exp(S, s.b, grp.N)
+
+	K := hash(grp.pad(S))
+	if subtle.ConstantTimeCompare(M1, proof(grp, s.I, s.salt, a, s.B, K)) != 1 {
+		return nil, nil, ErrBadProof
+	}
+	return hash(grp.pad(a), M1, K), &Session{K: K}, nil
+}
+
+// proof is M1 = SHA1(SHA1(N) ^ SHA1(g) | SHA1(I) | s | PAD(A) | PAD(B) | K).
+func proof(grp *Group, I string, salt []byte, A, B *big.Int, K []byte) []byte {
+	hn, hg := sha1.Sum(grp.N.Bytes()), sha1.Sum(grp.G.Bytes())
+	subtle.XORBytes(hn[:], hn[:], hg[:])
+	hi := sha1.Sum([]byte(I))
+	return hash(hn[:], hi[:], salt, grp.pad(A), grp.pad(B), K)
+}
+
+// Session is the key both sides of a handshake agreed on.
+type Session struct {
+	K []byte
+}
+
+// Password returns K in lower case hex, the SJCL password for the session: what
+// the browser gets from sjcl.codec.hex.fromBits(K).
+func (sess *Session) Password() []byte {
+	return []byte(hex.EncodeToString(sess.K))
+}
+
+// NewCCM returns an AES-CCM keyed from K.  The keySize byte AES key is
+// HKDF-SHA256(K, info = "AESCCM SRP session key").
+func (sess *Session) NewCCM(keySize, TagSize, NonceSize int) (aesccm.CCM, error) {
+	key, err := hkdf.Key(sha256.New, sess.K, nil, sessionInfo, keySize)
+	if err != nil {
+		return nil, err
+	}
+	defer clear(key)
+	blk, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return aesccm.NewCCM(blk, TagSize, NonceSize)
+}
+
+func randomSecret() (*big.Int, error) {
+	b := make([]byte, secretSize)
+	if _, err := io.ReadFull(rand.Reader, b); err != nil {
+		return nil, err
+	}
+	return new(big.Int).SetBytes(b), nil
+}
+
+func hash(b ...[]byte) []byte {
+	h := sha1.New()
+	for _, x := range b {
+		h.Write(x)
+	}
+	return h.Sum(nil)
+}
+
+func hashInt(b ...[]byte) *big.Int {
+	return new(big.Int).SetBytes(hash(b...))
+}
+
+/* vim: set noai ts=4 sw=4: */
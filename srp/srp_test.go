@@ -0,0 +1,211 @@
+package srp
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/pschlump/AesCCM/kdf"
+	"github.com/pschlump/AesCCM/sjcl"
+	"github.com/pschlump/AesCCM/sjclhttp"
+)
+
+func fromHex(s string) []byte {
+	b, err := hex.DecodeString(strings.Join(strings.Fields(s), ""))
+	if err != nil {
+		panic(err)
+	}
+	return b
+}
+
+// RFC 5054 appendix B.  K, M1 and M2 are not in the RFC; they were computed
+// independently from its S.
+func TestRFC5054(t *testing.T) {
+	grp, _ := KnownGroup(1024)
+	I, P := "alice", "password123"
+	salt := fromHex("BEB25379 D1A8581E B5A72767 3A2441EE")
+	a := new(big.Int).SetBytes(fromHex("60975527 035CF2AD 1989806F 0407210B C81EDC04 E2762A56 AFD529DD DA2D4393"))
+	b := new(big.Int).SetBytes(fromHex("E487CB59 D31AC550 471E81F0 0F6928E0 1DDA08E9 74A004F4 9E61F5D1 05284D20"))
+
+	c := newClient(grp, I, P, a)
+	s := newServer(grp, I, salt, MakeVerifier(I, P, salt, grp), b)
+	sSalt, B := s.Public()
+	M1, err := c.Respond(sSalt, B)
+	if err != nil {
+		t.Fatal(err)
+	}
+	M2, sess, err := s.Verify(c.Public(), M1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var testData = []struct {
+		name   string
+		got    []byte
+		expect string
+	}{
+		{name: "k", got: grp.k().Bytes(), expect: "7556AA04 5AEF2CDD 07ABAF0F 665C3E81 8913186F"},
+		{name: "x", got: MakeX(I, P, salt), expect: "94B7555A ABE9127C C58CCF49 93DB6CF8 4D16C124"},
+		{name: "v", got: MakeVerifier(I, P, salt, grp).Bytes(), expect: `
+			7E273DE8 696FFC4F 4E337D05 B4B375BE B0DDE156 9E8FA00A 9886D812
+			9BADA1F1 822223CA 1A605B53 0E379BA4 729FDC59 F105B478 7E5186F5
+			C671085A 1447B52A 48CF1970 B4FB6F84 00BBF4CE BFBB1681 52E08AB5
+			EA53D15C 1AFF87B2 B9DA6E04 E058AD51 CC72BFC9 033B564E 26480D78
+			E955A5E2 9E7AB245 DB2BE315 E2099AFB`},
+		{name: "A", got: c.Public(), expect: `
+			61D5E490 F6F1B795 47B0704C 436F523D D0E560F0 C64115BB 72557EC4
+			4352E890 3211C046 92272D8B 2D1A5358 A2CF1B6E 0BFCF99F 921530EC
+			8E393561 79EAE45E 42BA92AE ACED8251 71E1E8B9 AF6D9C03 E1327F44
+			BE087EF0 6530E69F 66615261 EEF54073 CA11CF58 58F0EDFD FE15EFEA
+			B349EF5D 76988A36 72FAC47B 0769447B`},
+		{name: "B", got: B, expect: `
+			BD0C6151 2C692C0C B6D041FA 01BB152D 4916A1E7 7AF46AE1 05393011
+			BAF38964 DC46A067 0DD125B9 5A981652 236F99D9 B681CBF8 7837EC99
+			6C6DA044 53728610 D0C6DDB5 8B318885 D7D82C7F 8DEB75CE 7BD4FBAA
+			37089E6F 9C6059F3 88838E7A 00030B33 1EB76840 910440B1 B27AAEAE
+			EB4012B7 D7665238 A8E3FB00 4B117B58`},
+		{name: "K", got: sess.K, expect: "017EEFA1 CEFC5C2E 626E2159 8987F31E 0F1B11BB"},
+		{name: "M1", got: M1, expect: "3F3BC671 69EA7130 2599CF1B 0F5D408B 7B65D347"},
+		{name: "M2", got: M2, expect: "9CAB3C57 5A11DE37 D3AC1421 A9F00923 6A48EB55"},
+	}
+
+	for ii, vv := range testData {
+		if !bytes.Equal(vv.got, fromHex(vv.expect)) {
+			t.Errorf("Test %d: %s got %X", ii, vv.name, vv.got)
+		}
+	}
+	if cs, err := c.Verify(M2); err != nil || !bytes.Equal(cs.K, sess.K) {
+		t.Errorf("Client Verify: %v", err)
+	}
+}
+
+// handshake runs the four messages between a new client and server.
+func handshake(grp *Group, I, P string, salt []byte, v *big.Int) (cs, ss *Session, err error) {
+	c, err := NewClient(grp, I, P)
+	if err != nil {
+		return nil, nil, err
+	}
+	s, err := NewServer(grp, I, salt, v)
+	if err != nil {
+		return nil, nil, err
+	}
+	M1, err := c.Respond(s.Public())
+	if err != nil {
+		return nil, nil, err
+	}
+	M2, ss, err := s.Verify(c.Public(), M1)
+	if err != nil {
+		return nil, nil, err
+	}
+	cs, err = c.Verify(M2)
+	return cs, ss, err
+}
+
+func TestGroups(t *testing.T) {
+	for _, bits := range []int{1024, 1536, 2048, 3072, 4096, 6144, 8192} {
+		grp, err := KnownGroup(bits)
+		if err != nil || grp.N.BitLen() != bits || !grp.N.ProbablyPrime(4) {
+			t.Errorf("Group %d: not a %d bit prime, err=%v", bits, bits, err)
+			continue
+		}
+		salt, v, err := NewVerifier("bob", "hunter2", grp)
+		if err != nil {
+			t.Fatal(err)
+		}
+		cs, ss, err := handshake(grp, "bob", "hunter2", salt, v)
+		if err != nil || !bytes.Equal(cs.K, ss.K) {
+			t.Errorf("Group %d: handshake failed, err=%v", bits, err)
+		}
+		if _, _, err := handshake(grp, "bob", "hunter3", salt, v); err != ErrBadProof {
+			t.Errorf("Group %d: wrong password got err=%v", bits, err)
+		}
+	}
+	if _, err := KnownGroup(1000); err != ErrUnknownGroup {
+		t.Errorf("KnownGroup(1000) got err=%v", err)
+	}
+}
+
+// A or B of 0 mod N would fix S whatever the password.
+func TestBadPublic(t *testing.T) {
+	grp, _ := KnownGroup(1024)
+	salt, v, _ := NewVerifier("carol", "secret", grp)
+	for _, bad := range [][]byte{nil, {0}, grp.N.Bytes(), new(big.Int).Lsh(grp.N, 1).Bytes()} {
+		c, _ := NewClient(grp, "carol", "secret")
+		if _, err := c.Respond(salt, bad); err != ErrBadPublic {
+			t.Errorf("Client took B=%x, err=%v", bad, err)
+		}
+		s, _ := NewServer(grp, "carol", salt, v)
+		if _, _, err := s.Verify(bad, make([]byte, 20)); err != ErrBadPublic {
+			t.Errorf("Server took A=%x, err=%v", bad, err)
+		}
+	}
+	c, _ := NewClient(grp, "carol", "secret")
+	if _, err := c.Verify(make([]byte, 20)); err != ErrOrder {
+		t.Errorf("Verify before Respond got err=%v", err)
+	}
+}
+
+// The whole AesSRP flow in process: register, handshake, then SJCL encrypted
+// requests and responses through sjclhttp, and the same key as a CCM.
+func TestSJCLSession(t *testing.T) {
+	grp, _ := KnownGroup(2048)
+	salt, v, _ := NewVerifier("dave", "correct horse", grp)
+	cs, ss, err := handshake(grp, "dave", "correct horse", salt, v)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sessions := map[string]*Session{"dave": ss}
+	keyLookup := func(r *http.Request) ([]byte, error) {
+		if sess, ok := sessions[r.Header.Get("X-User")]; ok {
+			return sess.Password(), nil
+		}
+		return nil, ErrBadProof
+	}
+	echo := func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		w.Write(append([]byte("got: "), body...))
+	}
+	srv := httptest.NewServer(sjclhttp.Middleware(keyLookup)(http.HandlerFunc(echo)))
+	defer srv.Close()
+
+	eBlob, err := sjcl.Encrypt(cs.Password(), []byte(`{"cmd":"balance"}`), nil, kdf.Params{Iter: 1000}, 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := eBlob.MarshalSJCL()
+	req, _ := http.NewRequest("POST", srv.URL, bytes.NewReader(body))
+	req.Header.Set("X-User", "dave")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ = io.ReadAll(resp.Body)
+	resp.Body.Close()
+	var reply sjcl.SJCL_DataStruct
+	if err := json.Unmarshal(body, &reply); err != nil || reply.Status != "success" {
+		t.Fatalf("Reply %s %v", body, err)
+	}
+	if pt, err := sjcl.Decrypt(cs.Password(), reply); err != nil || string(pt) != `got: {"cmd":"balance"}` {
+		t.Errorf("Reply decrypts to %q %v", pt, err)
+	}
+
+	cc, err := cs.NewCCM(32, 16, 12)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sc, _ := ss.NewCCM(32, 16, 12)
+	nonce := make([]byte, 12)
+	ct := cc.Seal(nil, nonce, []byte("hello server"), nil)
+	if pt, err := sc.Open(nil, nonce, ct, nil); err != nil || string(pt) != "hello server" {
+		t.Errorf("CCM from the session: %q %v", pt, err)
+	}
+}
+
+/* vim: set noai ts=4 sw=4: */
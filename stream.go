@@ -0,0 +1,128 @@
+// Sealing and opening messages too large to hold in memory.
+//
+// CCM writes the message length into B_0, the first block of the CBC-MAC, so it
+// cannot start until the length is known, and the tag comes after the whole
+// message.  SealStream and OpenStream take the length up front and read and
+// write a buffer at a time.  OpenStream can only tell whether the message is
+// genuine at the very end: the plaintext it has written by then must be thrown
+// away if it fails.  Where the ciphertext can be read twice, pass it through
+// OpenStream with io.Discard first, and then again for the plaintext.
+//
+// MIT Licensed
+//
+
+package aesccm
+
+import (
+	"crypto/cipher"
+	"crypto/subtle"
+	"io"
+)
+
+const streamBuffer = 64 << 10 // a multiple of CcmBlockSize
+
+// StreamCCM is a CCM that can also seal and open streams.
+type StreamCCM interface {
+	CCM
+
+	// SealStream reads exactly n bytes of plaintext from r and writes the
+	// ciphertext followed by the tag to w.
+	SealStream(w io.Writer, r io.Reader, n int64, nonce, adata []byte) error
+
+	// OpenStream reads exactly n bytes of ciphertext and tag from r and writes
+	// the plaintext to w as it goes.  It returns ErrOpenError if the tag does not
+	// match, after all of the plaintext has been written.
+	OpenStream(w io.Writer, r io.Reader, n int64, nonce, adata []byte) error
+}
+
+// NewStreamCCM is NewCCM returning the StreamCCM.
+func NewStreamCCM(blk cipher.Block, TagSize int, NonceSize int) (StreamCCM, error) {
+	return newCCMType(blk, TagSize, NonceSize)
+}
+
+// SealStream reads exactly n bytes of plaintext from r and writes the ciphertext
+// followed by the tag to w.  r ending early is io.ErrUnexpectedEOF.
+func (ccmt *CCMType) SealStream(w io.Writer, r io.Reader, n int64, nonce, adata []byte) error {
+	if n < 0 || n > int64(ccmt.MaxLength()) {
+		return ErrPlaintextTooLong
+	}
+	if NonceLength := ccmt.NonceSize(); len(nonce) > NonceLength {
+		nonce = nonce[0:NonceLength]
+	}
+	st := new(ccmState)
+	if err := ccmt.macStart(st, nonce, int(n), adata); err != nil {
+		return err
+	}
+	ccmt.counterStart(st, nonce)
+
+	buf := make([]byte, min(n, streamBuffer))
+	for n > 0 {
+		k := int(min(n, int64(len(buf))))
+		if _, err := io.ReadFull(r, buf[:k]); err != nil {
+			return unexpectedEOF(err)
+		}
+		ccmt.sealBlocks(st, buf[:k], buf[:k])
+		if _, err := w.Write(buf[:k]); err != nil {
+			return err
+		}
+		n -= int64(k)
+	}
+	subtle.XORBytes(st.tag[:ccmt.M], st.mac[:ccmt.M], st.s0[:])
+	_, err := w.Write(st.tag[:ccmt.M])
+	return err
+}
+
+// OpenStream reads exactly n bytes, the ciphertext and then the tag, from r and
+// writes the plaintext to w as it goes.  If the tag does not match it returns
+// ErrOpenError, once everything has been written; the caller must then discard
+// what was written.
+func (ccmt *CCMType) OpenStream(w io.Writer, r io.Reader, n int64, nonce, adata []byte) error {
+	if n > int64(ccmt.MaxLength()+ccmt.Overhead()) {
+		return ErrCiphertextTooLong
+	}
+	if n < int64(ccmt.M) {
+		return ErrCiphertextTooShort
+	}
+	if NonceLength := ccmt.NonceSize(); len(nonce) > NonceLength {
+		nonce = nonce[0:NonceLength]
+	}
+	n -= int64(ccmt.M)
+	st := new(ccmState)
+	if err := ccmt.macStart(st, nonce, int(n), adata); err != nil {
+		return err
+	}
+	ccmt.counterStart(st, nonce)
+
+	buf := make([]byte, min(n, streamBuffer))
+	for n > 0 {
+		k := int(min(n, int64(len(buf))))
+		if _, err := io.ReadFull(r, buf[:k]); err != nil {
+			return unexpectedEOF(err)
+		}
+		ccmt.openBlocks(st, buf[:k], buf[:k])
+		if _, err := w.Write(buf[:k]); err != nil {
+			return err
+		}
+		n -= int64(k)
+	}
+	clear(buf)
+	if _, err := io.ReadFull(r, st.tag[:ccmt.M]); err != nil {
+		return unexpectedEOF(err)
+	}
+	subtle.XORBytes(st.mac[:ccmt.M], st.mac[:ccmt.M], st.s0[:])
+	if subtle.ConstantTimeCompare(st.mac[:ccmt.M], st.tag[:ccmt.M]) != 1 {
+		return ErrOpenError
+	}
+	return nil
+}
+
+// unexpectedEOF turns io.EOF, a stream with nothing left, into
+// io.ErrUnexpectedEOF: the length said there was more.
+func unexpectedEOF(err error) error {
+	if err == io.EOF {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
+
+/* vim: set noai ts=4 sw=4: */
@@ -0,0 +1,73 @@
+package aesccm
+
+import (
+	"bytes"
+	"crypto/aes"
+	"io"
+	"testing"
+	"testing/iotest"
+)
+
+// SealStream and OpenStream give the same bytes as Seal and Open, across the
+// block, chunk and buffer boundaries and on the parallel path.
+func TestStream(t *testing.T) {
+	blk, _ := aes.NewCipher(make([]byte, 16))
+	seq, _ := newCCMType(blk, 16, 12)
+	par, _ := newCCMType(blk, 8, 12)
+	par.SetParallel(1, 3)
+	nonce := []byte("stream ccm..")
+	adata := []byte("adata")
+
+	for _, ccm := range []*CCMType{seq, par} {
+		for _, n := range []int{0, 1, 15, 16, 17, ccmChunk - 1, ccmChunk, ccmChunk + 1, streamBuffer - 1, streamBuffer, streamBuffer + 1, 2*streamBuffer + 600} {
+			plaintext := make([]byte, n)
+			for i := range plaintext {
+				plaintext[i] = byte(i * 13)
+			}
+			expect := ccm.Seal(nil, nonce, plaintext, adata)
+
+			var ct bytes.Buffer
+			if err := ccm.SealStream(&ct, iotest.HalfReader(bytes.NewReader(plaintext)), int64(n), nonce, adata); err != nil {
+				t.Errorf("Len %d: SealStream %s", n, err)
+				continue
+			}
+			if !bytes.Equal(ct.Bytes(), expect) {
+				t.Errorf("Len %d, parallel %d: SealStream differs from Seal", n, ccm.parallel)
+				continue
+			}
+
+			var pt bytes.Buffer
+			if err := ccm.OpenStream(&pt, iotest.HalfReader(bytes.NewReader(expect)), int64(len(expect)), nonce, adata); err != nil || !bytes.Equal(pt.Bytes(), plaintext) {
+				t.Errorf("Len %d, parallel %d: OpenStream failed, err=%v", n, ccm.parallel, err)
+			}
+
+			// Any change to the ciphertext or the tag fails.
+			for _, i := range []int{0, len(expect) - 1} {
+				bad := append([]byte(nil), expect...)
+				bad[i] ^= 0x40
+				if err := ccm.OpenStream(io.Discard, bytes.NewReader(bad), int64(len(bad)), nonce, adata); err != ErrOpenError {
+					t.Errorf("Len %d: byte %d changed, got err=%v", n, i, err)
+				}
+			}
+		}
+	}
+}
+
+func TestStreamShort(t *testing.T) {
+	blk, _ := aes.NewCipher(make([]byte, 16))
+	ccm, _ := NewStreamCCM(blk, 16, 13)
+	nonce := make([]byte, 13)
+
+	if err := ccm.SealStream(io.Discard, bytes.NewReader(make([]byte, 99)), 100, nonce, nil); err != io.ErrUnexpectedEOF {
+		t.Errorf("SealStream of a short reader got err=%v", err)
+	}
+	ct := ccm.Seal(nil, nonce, make([]byte, 100), nil)
+	if err := ccm.OpenStream(io.Discard, bytes.NewReader(ct[:len(ct)-1]), int64(len(ct)), nonce, nil); err != io.ErrUnexpectedEOF {
+		t.Errorf("OpenStream missing the last tag byte got err=%v", err)
+	}
+	if err := ccm.OpenStream(io.Discard, bytes.NewReader(ct), 15, nonce, nil); err != ErrCiphertextTooShort {
+		t.Errorf("OpenStream shorter than the tag got err=%v", err)
+	}
+}
+
+/* vim: set noai ts=4 sw=4: */
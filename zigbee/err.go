@@ -0,0 +1,14 @@
+package zigbee
+
+import "errors"
+
+var ErrKeySize = errors.New("ZIGBEE: key must be 16 bytes")
+var ErrShortFrame = errors.New("ZIGBEE: frame too short")
+var ErrSecurityLevel = errors.New("ZIGBEE: security level 0 does not secure frames")
+var ErrSealFailed = errors.New("ZIGBEE: unable to secure frame")
+var ErrNotSecured = errors.New("ZIGBEE: security bit not set in frame control")
+var ErrKeyID = errors.New("ZIGBEE: frame is not secured with the network key")
+var ErrKeySeqNumber = errors.New("ZIGBEE: key sequence number does not match")
+var ErrInstallCode = errors.New("ZIGBEE: invalid install code")
+
+/* vim: set noai ts=4 sw=4: */
@@ -0,0 +1,116 @@
+package zigbee
+
+// Matyas-Meyer-Oseas hash and the keyed hash built on it - Zigbee Specification
+// Annex B.6 and B.1.4.  These are used to derive the key-transport and key-load
+// keys from a link key and to turn an install code into a link key.
+//
+//	H_0 = 0^128,  H_j = E(H_j-1, M_j) XOR M_j
+//
+// MIT Licensed.
+
+import (
+	"crypto/aes"
+	"encoding/binary"
+)
+
+const mmoBlockSize = aes.BlockSize
+
+// MMOHash returns the 16 byte AES-MMO hash of msg.
+func MMOHash(msg []byte) []byte {
+	var h [mmoBlockSize]byte
+	bitlen := uint64(len(msg)) * 8
+
+	// Pad with a 1 bit, zeros, and the bit length in 16 bits - or for long messages
+	// the bit length in 32 bits followed by 16 zero bits.
+	padded := append(append([]byte(nil), msg...), 0x80)
+	if bitlen < 1<<16 {
+		for len(padded)%mmoBlockSize != mmoBlockSize-2 {
+			padded = append(padded, 0)
+		}
+		padded = binary.BigEndian.AppendUint16(padded, uint16(bitlen))
+	} else {
+		for len(padded)%mmoBlockSize != mmoBlockSize-6 {
+			padded = append(padded, 0)
+		}
+		padded = binary.BigEndian.AppendUint32(padded, uint32(bitlen))
+		padded = append(padded, 0, 0)
+	}
+
+	for i := 0; i < len(padded); i += mmoBlockSize {
+		blk, _ := aes.NewCipher(h[:]) // key is always 16 bytes
+		m := padded[i : i+mmoBlockSize]
+		blk.Encrypt(h[:], m)
+		for j := range h {
+			h[j] ^= m[j]
+		}
+	}
+	return h[:]
+}
+
+// KeyedHash is the HMAC construction over MMOHash used by Zigbee for key
+// derivation.  key must be 16 bytes.
+func KeyedHash(key, msg []byte) []byte {
+	var ipad, opad [mmoBlockSize]byte
+	for i := range ipad {
+		ipad[i] = key[i] ^ 0x36
+		opad[i] = key[i] ^ 0x5c
+	}
+	inner := MMOHash(append(ipad[:], msg...))
+	return MMOHash(append(opad[:], inner...))
+}
+
+// KeyTransportKey derives the key-transport key from a link key.
+func KeyTransportKey(linkKey []byte) []byte {
+	return KeyedHash(linkKey, []byte{0x00})
+}
+
+// KeyLoadKey derives the key-load key from a link key.
+func KeyLoadKey(linkKey []byte) []byte {
+	return KeyedHash(linkKey, []byte{0x02})
+}
+
+// APSKey returns the key that secures an APS frame with the given key identifier:
+// the link key itself for data frames, or the transform of it for key-transport
+// and key-load frames.  The network key is used as is.
+func APSKey(key []byte, keyID uint8) []byte {
+	switch keyID {
+	case KeyIDKeyTransport:
+		return KeyTransportKey(key)
+	case KeyIDKeyLoad:
+		return KeyLoadKey(key)
+	}
+	return key
+}
+
+// InstallCodeKey converts an install code, with its trailing 2 byte CRC, into the
+// preconfigured link key.  Install codes are 6, 8, 12 or 16 bytes plus the CRC.
+func InstallCodeKey(code []byte) ([]byte, error) {
+	switch len(code) - 2 {
+	case 6, 8, 12, 16:
+	default:
+		return nil, ErrInstallCode
+	}
+	l := len(code) - 2
+	if crc16X25(code[:l]) != binary.LittleEndian.Uint16(code[l:]) {
+		return nil, ErrInstallCode
+	}
+	return MMOHash(code), nil
+}
+
+// crc16X25 is the CRC-16 (CCITT, reflected, init and xor 0xffff) used on install codes.
+func crc16X25(data []byte) uint16 {
+	crc := uint16(0xffff)
+	for _, b := range data {
+		crc ^= uint16(b)
+		for i := 0; i < 8; i++ {
+			if crc&1 != 0 {
+				crc = crc>>1 ^ 0x8408
+			} else {
+				crc >>= 1
+			}
+		}
+	}
+	return ^crc
+}
+
+/* vim: set noai ts=4 sw=4: */
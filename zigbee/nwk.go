@@ -0,0 +1,127 @@
+package zigbee
+
+// NWK layer frames - header parsing and network key security.
+//
+//	Octets:  2              2         2         1       1         0/8        0/8       0/1        var
+//	         Frame Control  Dest Addr Src Addr  Radius  Seq Num   Dest IEEE  Src IEEE  Multicast  Source Route
+//
+// The NWK frame counter and key sequence number are carried in the auxiliary
+// header, which always has the extended nonce flag set at the NWK layer.
+//
+// MIT Licensed.
+
+import "encoding/binary"
+
+// NWK Frame Control bits
+const (
+	NWKFrameTypeMask   = 0x0003
+	NWKMulticast       = 0x0100
+	NWKSecurity        = 0x0200
+	NWKSourceRoute     = 0x0400
+	NWKDestIEEEPresent = 0x0800
+	NWKSrcIEEEPresent  = 0x1000
+)
+
+// NWKHeader is the parsed NWK header of a frame.
+type NWKHeader struct {
+	FrameControl uint16
+	DestAddr     uint16
+	SrcAddr      uint16
+	Radius       uint8
+	SeqNum       uint8
+	DestIEEE     uint64 // present if FrameControl&NWKDestIEEEPresent
+	SrcIEEE      uint64 // present if FrameControl&NWKSrcIEEEPresent
+	Len          int    // length of the header in bytes, including the multicast control and source route
+}
+
+// ParseNWKHeader parses the NWK header at the front of frame.
+func ParseNWKHeader(frame []byte) (h NWKHeader, err error) {
+	if len(frame) < 8 {
+		return h, ErrShortFrame
+	}
+	h.FrameControl = binary.LittleEndian.Uint16(frame[0:])
+	h.DestAddr = binary.LittleEndian.Uint16(frame[2:])
+	h.SrcAddr = binary.LittleEndian.Uint16(frame[4:])
+	h.Radius = frame[6]
+	h.SeqNum = frame[7]
+	n := 8
+	if h.FrameControl&NWKDestIEEEPresent != 0 {
+		if len(frame) < n+8 {
+			return h, ErrShortFrame
+		}
+		h.DestIEEE = binary.LittleEndian.Uint64(frame[n:])
+		n += 8
+	}
+	if h.FrameControl&NWKSrcIEEEPresent != 0 {
+		if len(frame) < n+8 {
+			return h, ErrShortFrame
+		}
+		h.SrcIEEE = binary.LittleEndian.Uint64(frame[n:])
+		n += 8
+	}
+	if h.FrameControl&NWKMulticast != 0 {
+		n++
+	}
+	if h.FrameControl&NWKSourceRoute != 0 {
+		if len(frame) < n+2 {
+			return h, ErrShortFrame
+		}
+		n += 2 + 2*int(frame[n]) // relay count, relay index, relay list
+	}
+	if len(frame) < n {
+		return h, ErrShortFrame
+	}
+	h.Len = n
+	return h, nil
+}
+
+// DecryptNWK checks and decrypts a secured NWK frame with the network key whose
+// sequence number is keySeq.  level is the network's nwkSecurityLevel (normally
+// DefaultSecLevel).  It returns the NWK header, the auxiliary header and the
+// plaintext NWK payload.
+func DecryptNWK(frame []byte, key []byte, keySeq uint8, level uint8) (h NWKHeader, aux AuxHeader, payload []byte, err error) {
+	if h, err = ParseNWKHeader(frame); err != nil {
+		return
+	}
+	if h.FrameControl&NWKSecurity == 0 {
+		return h, aux, nil, ErrNotSecured
+	}
+	if aux, _, err = ParseAuxHeader(frame[h.Len:]); err != nil {
+		return
+	}
+	if aux.KeyID() != KeyIDNetwork || aux.SecurityControl&ExtendedNonceFlag == 0 {
+		return h, aux, nil, ErrKeyID
+	}
+	if aux.KeySeqNumber != keySeq {
+		return h, aux, nil, ErrKeySeqNumber
+	}
+	payload, aux, err = Unsecure(frame, h.Len, key, level, aux.SourceAddress)
+	return
+}
+
+// EncryptNWK secures a NWK frame.  frame holds the NWK header, with the security
+// bit set in the frame control, followed by the plaintext payload.  The auxiliary
+// header is built from source (the sender's extended address), frameCounter and
+// keySeq and inserted after the NWK header.
+func EncryptNWK(frame []byte, key []byte, keySeq uint8, frameCounter uint32, source uint64, level uint8) ([]byte, error) {
+	h, err := ParseNWKHeader(frame)
+	if err != nil {
+		return nil, err
+	}
+	if h.FrameControl&NWKSecurity == 0 {
+		return nil, ErrNotSecured
+	}
+	aux := AuxHeader{
+		SecurityControl: KeyIDNetwork<<KeyIDShift | ExtendedNonceFlag,
+		FrameCounter:    frameCounter,
+		SourceAddress:   source,
+		KeySeqNumber:    keySeq,
+	}
+	buf := make([]byte, 0, len(frame)+aux.Len()+MICSize(level))
+	buf = append(buf, frame[:h.Len]...)
+	buf = aux.Encode(buf)
+	buf = append(buf, frame[h.Len:]...)
+	return Secure(buf, h.Len, key, level, source)
+}
+
+/* vim: set noai ts=4 sw=4: */
@@ -0,0 +1,295 @@
+package zigbee
+
+// Zigbee NWK and APS frame security (CCM*) on top of aesccm.
+//
+// Zigbee secures frames with CCM* using a 13 byte nonce made of the source extended
+// address, the frame counter and the security control field of the auxiliary
+// security header.  Over the air the security level bits of the security control
+// field are sent as zero; the receiver puts its configured level (nwkSecurityLevel,
+// almost always 5 - ENC-MIC-32) back before building the nonce and the additional
+// data.
+//
+// See: Zigbee Specification (05-3474), section 4.5 "Common Security Elements"
+// and Annex A "CCM* Mode of Operation".
+//
+// MIT Licensed.
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"encoding/binary"
+
+	"github.com/pschlump/AesCCM"
+)
+
+const KeySize = 16
+const NonceSize = 13 // Source Address (8) || Frame Counter (4) || Security Control (1)
+
+// Security levels - bits 0-2 of the security control field
+const (
+	LevelNone       = 0
+	LevelMIC32      = 1
+	LevelMIC64      = 2
+	LevelMIC128     = 3
+	LevelENC        = 4
+	LevelENCMIC32   = 5
+	LevelENCMIC64   = 6
+	LevelENCMIC128  = 7
+	DefaultSecLevel = LevelENCMIC32 // nwkSecurityLevel used by every Zigbee PRO network
+)
+
+// Security control field
+const (
+	SecLevelMask      = 0x07 // bits 0-2
+	KeyIDMask         = 0x18 // bits 3-4
+	KeyIDShift        = 3    //
+	ExtendedNonceFlag = 0x20 // bit 5 - Source Address is in the auxiliary header
+)
+
+// Key identifiers - bits 3-4 of the security control field
+const (
+	KeyIDData         = 0 // a data key (APS link key)
+	KeyIDNetwork      = 1 // the network key
+	KeyIDKeyTransport = 2 // key-transport key, derived from the link key
+	KeyIDKeyLoad      = 3 // key-load key, derived from the link key
+)
+
+// MICSize returns the length of the MIC in bytes for a security level.
+func MICSize(level uint8) int {
+	switch level & SecLevelMask {
+	case LevelMIC32, LevelENCMIC32:
+		return 4
+	case LevelMIC64, LevelENCMIC64:
+		return 8
+	case LevelMIC128, LevelENCMIC128:
+		return 16
+	}
+	return 0
+}
+
+// encrypted reports if a security level encrypts the payload.
+func encrypted(level uint8) bool {
+	return level&LevelENC != 0
+}
+
+// AuxHeader is the auxiliary security header that follows the NWK or APS header.
+type AuxHeader struct {
+	SecurityControl uint8  // security level, key identifier and extended nonce flag
+	FrameCounter    uint32 //
+	SourceAddress   uint64 // present if SecurityControl&ExtendedNonceFlag
+	KeySeqNumber    uint8  // present if the key identifier is KeyIDNetwork
+}
+
+// KeyID returns the key identifier from the security control field.
+func (a *AuxHeader) KeyID() uint8 {
+	return (a.SecurityControl & KeyIDMask) >> KeyIDShift
+}
+
+// Len returns the number of bytes the auxiliary header occupies on the wire.
+func (a *AuxHeader) Len() int {
+	n := 5
+	if a.SecurityControl&ExtendedNonceFlag != 0 {
+		n += 8
+	}
+	if a.KeyID() == KeyIDNetwork {
+		n++
+	}
+	return n
+}
+
+// Encode appends the wire format of the auxiliary header to dst.
+func (a *AuxHeader) Encode(dst []byte) []byte {
+	var tmp [8]byte
+	dst = append(dst, a.SecurityControl)
+	binary.LittleEndian.PutUint32(tmp[:4], a.FrameCounter)
+	dst = append(dst, tmp[:4]...)
+	if a.SecurityControl&ExtendedNonceFlag != 0 {
+		binary.LittleEndian.PutUint64(tmp[:], a.SourceAddress)
+		dst = append(dst, tmp[:]...)
+	}
+	if a.KeyID() == KeyIDNetwork {
+		dst = append(dst, a.KeySeqNumber)
+	}
+	return dst
+}
+
+// ParseAuxHeader reads an auxiliary security header from the front of b and
+// returns it with the number of bytes used.
+func ParseAuxHeader(b []byte) (a AuxHeader, n int, err error) {
+	if len(b) < 5 {
+		return a, 0, ErrShortFrame
+	}
+	a.SecurityControl = b[0]
+	if len(b) < a.Len() {
+		return a, 0, ErrShortFrame
+	}
+	a.FrameCounter = binary.LittleEndian.Uint32(b[1:5])
+	n = 5
+	if a.SecurityControl&ExtendedNonceFlag != 0 {
+		a.SourceAddress = binary.LittleEndian.Uint64(b[n:])
+		n += 8
+	}
+	if a.KeyID() == KeyIDNetwork {
+		a.KeySeqNumber = b[n]
+		n++
+	}
+	return a, n, nil
+}
+
+// Nonce builds the CCM* nonce.  source is the extended address of the frame's
+// originator - AuxHeader.SourceAddress when the extended nonce flag is set,
+// otherwise it comes from the NWK header or the device's address table.
+// securityControl must already carry the real security level.
+func Nonce(source uint64, frameCounter uint32, securityControl uint8) []byte {
+	nonce := make([]byte, NonceSize)
+	binary.LittleEndian.PutUint64(nonce[0:8], source)
+	binary.LittleEndian.PutUint32(nonce[8:12], frameCounter)
+	nonce[12] = securityControl
+	return nonce
+}
+
+// Nonce802154 builds the IEEE 802.15.4 style CCM* nonce used by Thread MLE and
+// the 802.15.4 MAC layer.  Unlike Zigbee the fields are big endian and only the
+// security level is included.
+func Nonce802154(extAddress uint64, frameCounter uint32, level uint8) []byte {
+	nonce := make([]byte, NonceSize)
+	binary.BigEndian.PutUint64(nonce[0:8], extAddress)
+	binary.BigEndian.PutUint32(nonce[8:12], frameCounter)
+	nonce[12] = level & SecLevelMask
+	return nonce
+}
+
+// Secure applies CCM* to frame, which must hold the NWK or APS header
+// (hdrLen bytes), a complete auxiliary header and the plaintext payload.  The
+// returned frame has the payload encrypted (for ENC levels), the MIC appended and
+// the security level bits of the security control field cleared for transmission.
+// source is the originator's extended address used for the nonce.
+func Secure(frame []byte, hdrLen int, key []byte, level uint8, source uint64) ([]byte, error) {
+	if hdrLen < 0 || len(frame) < hdrLen {
+		return nil, ErrShortFrame
+	}
+	aux, n, err := ParseAuxHeader(frame[hdrLen:])
+	if err != nil {
+		return nil, err
+	}
+	level &= SecLevelMask
+	if level == LevelNone {
+		return nil, ErrSecurityLevel
+	}
+	frame = append([]byte(nil), frame...)
+	hdr := frame[:hdrLen+n]
+	hdr[hdrLen] = hdr[hdrLen]&^SecLevelMask | level
+	nonce := Nonce(source, aux.FrameCounter, hdr[hdrLen])
+	payload := frame[hdrLen+n:]
+
+	var out []byte
+	switch {
+	case level == LevelENC:
+		out = append(hdr, payload...)
+		if err := ctrStar(key, nonce, out[len(hdr):]); err != nil {
+			return nil, err
+		}
+	case encrypted(level):
+		ccm, err := newCCM(key, level)
+		if err != nil {
+			return nil, err
+		}
+		out = ccm.Seal(append([]byte(nil), hdr...), nonce, payload, hdr)
+		if len(out) != len(hdr)+len(payload)+MICSize(level) {
+			return nil, ErrSealFailed
+		}
+	default: // MIC only - the whole frame is additional data
+		ccm, err := newCCM(key, level)
+		if err != nil {
+			return nil, err
+		}
+		out = ccm.Seal(frame, nonce, nil, frame)
+	}
+	out[hdrLen] &^= SecLevelMask // sent as zero over the air
+	return out, nil
+}
+
+// Unsecure reverses Secure.  frame holds the header (hdrLen bytes), the auxiliary
+// header, the payload and the MIC as received.  level is the receiver's configured
+// security level, which replaces the zeroed level bits.  source is used for the
+// nonce when the auxiliary header has no Source Address.  It returns the plaintext
+// payload and the auxiliary header.
+func Unsecure(frame []byte, hdrLen int, key []byte, level uint8, source uint64) (payload []byte, aux AuxHeader, err error) {
+	if hdrLen < 0 || len(frame) < hdrLen {
+		return nil, aux, ErrShortFrame
+	}
+	aux, n, err := ParseAuxHeader(frame[hdrLen:])
+	if err != nil {
+		return nil, aux, err
+	}
+	level &= SecLevelMask
+	if level == LevelNone {
+		return nil, aux, ErrSecurityLevel
+	}
+	mlen := MICSize(level)
+	if len(frame) < hdrLen+n+mlen {
+		return nil, aux, ErrShortFrame
+	}
+	if aux.SecurityControl&ExtendedNonceFlag != 0 {
+		source = aux.SourceAddress
+	}
+	frame = append([]byte(nil), frame...)
+	frame[hdrLen] = frame[hdrLen]&^SecLevelMask | level
+	aux.SecurityControl = frame[hdrLen]
+	hdr := frame[:hdrLen+n]
+	nonce := Nonce(source, aux.FrameCounter, aux.SecurityControl)
+
+	switch {
+	case level == LevelENC:
+		payload = frame[len(hdr):]
+		err = ctrStar(key, nonce, payload)
+	case encrypted(level):
+		var ccm aesccm.CCM
+		if ccm, err = newCCM(key, level); err == nil {
+			payload, err = ccm.Open(nil, nonce, frame[len(hdr):], hdr)
+		}
+	default:
+		var ccm aesccm.CCM
+		if ccm, err = newCCM(key, level); err == nil {
+			l := len(frame) - mlen
+			if _, err = ccm.Open(nil, nonce, frame[l:], frame[:l]); err == nil {
+				payload = frame[len(hdr):l]
+			}
+		}
+	}
+	if err != nil {
+		return nil, aux, err
+	}
+	return payload, aux, nil
+}
+
+func newCCM(key []byte, level uint8) (aesccm.CCM, error) {
+	if len(key) != KeySize {
+		return nil, ErrKeySize
+	}
+	blk, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return aesccm.NewCCM(blk, MICSize(level), NonceSize)
+}
+
+// ctrStar is CCM* with M=0 (security level 4): the counter mode half of CCM with
+// no authentication.  The keystream starts at counter 1 as in CCM.
+func ctrStar(key, nonce, data []byte) error {
+	if len(key) != KeySize {
+		return ErrKeySize
+	}
+	blk, err := aes.NewCipher(key)
+	if err != nil {
+		return err
+	}
+	var ctr [aesccm.CcmBlockSize]byte
+	ctr[0] = 15 - NonceSize - 1 // L' = L-1
+	copy(ctr[1:], nonce)
+	ctr[aesccm.CcmBlockSize-1] = 1
+	cipher.NewCTR(blk, ctr[:]).XORKeyStream(data, data)
+	return nil
+}
+
+/* vim: set noai ts=4 sw=4: */